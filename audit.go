@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/labstack/echo"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Audited operations.
+const (
+	OpGet           = "get"
+	OpLog           = "log"
+	OpPut           = "put"
+	OpKeys          = "keys"
+	OpChanges       = "changes"
+	OpStream        = "stream"
+	OpSubscribers   = "subscribers"
+	OpSubscribe     = "subscribe"
+	OpUnsubscribe   = "unsubscribe"
+	OpConfirm       = "confirm"
+	OpWebhooks      = "webhooks"
+	OpWebhookAdd    = "webhook.add"
+	OpWebhookRemove = "webhook.remove"
+	OpWebhookLog    = "webhook.log"
+	OpNotifyStatus  = "notifications.status"
+	OpTokenCreate   = "token.create"
+	OpTokenRevoke   = "token.revoke"
+	OpAudit         = "audit"
+	OpAuthenticate  = "authenticate"
+	OpRekey         = "rekey"
+	OpExport        = "export"
+	OpImport        = "import"
+	OpGraphQL       = "graphql"
+)
+
+// Default number of audit entries returned.
+const defaultAuditLimit = 100
+
+// Outcomes of audited operations.
+const (
+	AuditOK       = "ok"
+	AuditNotFound = "notfound"
+	AuditDenied   = "denied"
+	AuditFailed   = "failed"
+)
+
+// Client of operations performed with the command-line interface.
+const auditCLIClient = "cli"
+
+// AuditEntry records who performed an operation on which key and its outcome.
+type AuditEntry struct {
+	ID        bson.ObjectId `bson:"_id" json:"_id"`
+	Time      time.Time     `json:"time"`
+	Identity  string        `bson:",omitempty" json:"identity,omitempty"`
+	Operation string        `json:"operation"`
+	Key       string        `bson:",omitempty" json:"key,omitempty"`
+	Version   int           `bson:",omitempty" json:"version,omitempty"`
+	Client    string        `bson:",omitempty" json:"client,omitempty"`
+	Outcome   string        `json:"outcome"`
+	Error     string        `bson:",omitempty" json:"error,omitempty"`
+}
+
+// RecordAudit appends the entry to the audit log. Failing to record an entry
+// does not fail the operation, but is logged.
+func RecordAudit(cfg *Config, e *AuditEntry) {
+	e.ID = bson.NewObjectId()
+	e.Time = time.Now().UTC()
+
+	if e.Outcome == "" {
+		e.Outcome = AuditOK
+	}
+
+	if err := cfg.Mongo.Audit().Insert(e); err != nil {
+		fmt.Fprintln(os.Stderr, "[audit] error recording entry:", err)
+	}
+}
+
+// AuditQuery filters the audit log. Empty fields are ignored.
+type AuditQuery struct {
+	Identity  string
+	Operation string
+	Key       string
+	Since     time.Time
+	Limit     int
+}
+
+// QueryAudit returns the most recent audit entries matching the query.
+func QueryAudit(cfg *Config, aq AuditQuery) ([]*AuditEntry, error) {
+	q := bson.M{}
+
+	if aq.Identity != "" {
+		q["identity"] = aq.Identity
+	}
+
+	if aq.Operation != "" {
+		q["operation"] = aq.Operation
+	}
+
+	if aq.Key != "" {
+		q["key"] = aq.Key
+	}
+
+	if !aq.Since.IsZero() {
+		q["time"] = bson.M{"$gte": aq.Since}
+	}
+
+	if aq.Limit <= 0 {
+		aq.Limit = defaultAuditLimit
+	}
+
+	var entries []*AuditEntry
+
+	if err := cfg.Mongo.Audit().Find(q).Sort("-time").Limit(aq.Limit).All(&entries); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// auditCmd records an operation performed with the command-line interface.
+// The identity is the user running the command.
+func auditCmd(cfg *Config, e *AuditEntry, err error) {
+	if u, uerr := user.Current(); uerr == nil {
+		e.Identity = u.Username
+	}
+
+	e.Client = auditCLIClient
+
+	if err != nil {
+		e.Outcome = auditOutcome(AsError(err).Status)
+		e.Error = err.Error()
+	}
+
+	RecordAudit(cfg, e)
+}
+
+// auditEntry returns the audit entry of the request so handlers can set the
+// version and outcome.
+func auditEntry(c echo.Context) *AuditEntry {
+	if e, ok := c.Get("audit").(*AuditEntry); ok {
+		return e
+	}
+
+	return &AuditEntry{}
+}
+
+// auditRead records a record read by a request that returns several
+// records, such as a GraphQL query or the change feed. The request itself is
+// recorded by the route.
+func auditRead(c echo.Context, op, key string, version int, err error) {
+	// Records read outside of a request are not audited.
+	if c == nil {
+		return
+	}
+
+	e := AuditEntry{
+		Identity:  identityName(c),
+		Operation: op,
+		Key:       key,
+		Version:   version,
+		Client:    c.Request().RemoteAddress(),
+		Outcome:   AuditOK,
+	}
+
+	if err != nil {
+		e.Outcome = auditOutcome(AsError(err).Status)
+		e.Error = err.Error()
+	}
+
+	RecordAudit(c.Get("config").(*Config), &e)
+}
+
+// auditOutcome returns the outcome of a request from the response status.
+func auditOutcome(status int) string {
+	switch {
+	case status == http.StatusUnauthorized, status == http.StatusForbidden:
+		return AuditDenied
+
+	case status == http.StatusNotFound:
+		return AuditNotFound
+
+	case status >= http.StatusBadRequest:
+		return AuditFailed
+	}
+
+	return AuditOK
+}
+
+// audit returns middleware that records the operation of the route.
+func audit(op string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			cfg := c.Get("config").(*Config)
+
+			e := &AuditEntry{
+				Identity:  identityName(c),
+				Operation: op,
+				Key:       c.Param("key"),
+				Client:    c.Request().RemoteAddress(),
+			}
+
+			c.Set("audit", e)
+
+			err := next(c)
+
+			// Errors are written to the response after the middleware
+			// returns.
+			if err != nil {
+				e.Error = err.Error()
+
+				if e.Outcome == "" {
+					e.Outcome = auditOutcome(AsError(err).Status)
+				}
+			} else if e.Outcome == "" {
+				e.Outcome = auditOutcome(c.Response().Status())
+			}
+
+			RecordAudit(cfg, e)
+
+			return err
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestAuditOutcome(t *testing.T) {
+	tests := map[int]string{
+		http.StatusOK:                  AuditOK,
+		http.StatusNoContent:           AuditOK,
+		http.StatusNotModified:         AuditOK,
+		http.StatusUnauthorized:        AuditDenied,
+		http.StatusForbidden:           AuditDenied,
+		http.StatusNotFound:            AuditNotFound,
+		http.StatusBadRequest:          AuditFailed,
+		http.StatusInternalServerError: AuditFailed,
+	}
+
+	for status, outcome := range tests {
+		if o := auditOutcome(status); o != outcome {
+			t.Errorf("%d: expected %s, got %s", status, outcome, o)
+		}
+	}
+}
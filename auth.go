@@ -0,0 +1,481 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/labstack/echo.v2/engine/standard"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Authentication methods.
+const (
+	AuthToken = "token"
+	AuthBasic = "basic"
+	AuthJWT   = "jwt"
+	AuthCert  = "cert"
+)
+
+var ErrUnauthenticated = errors.New("Invalid credentials")
+
+// Password hash compared against for unknown users.
+const dummyPasswordHash = "$2a$10$00000000000000000000000000000000000000000000000000000"
+
+// Paths that do not require authentication. Confirmation and unsubscribe
+// links are opened from emails and are authorized by their token.
+var publicPaths = []string{
+	"/confirm/",
+	"/unsubscribe/",
+	"/openapi.json",
+}
+
+// Identity is an authenticated caller.
+type Identity struct {
+	Name   string   `json:"name"`
+	Method string   `json:"method"`
+	Roles  []string `json:"roles,omitempty"`
+}
+
+// Token is an API token managed with the token command. Only the hash of
+// the token is stored.
+type Token struct {
+	ID   bson.ObjectId `bson:"_id" json:"_id"`
+	Name string        `json:"name"`
+	Hash string        `json:"-"`
+	Time time.Time     `json:"time"`
+}
+
+// hashToken returns the hex-encoded SHA-256 hash of the token. Tokens are
+// random so a fast hash is sufficient.
+func hashToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+// CreateToken creates an API token with the name. The returned string is the
+// token which cannot be retrieved later.
+func CreateToken(cfg *Config, name string) (string, error) {
+	if name == "" {
+		return "", errors.New("Token name required")
+	}
+
+	token, err := newSecret()
+
+	if err != nil {
+		return "", err
+	}
+
+	t := Token{
+		ID:   bson.NewObjectId(),
+		Name: name,
+		Hash: hashToken(token),
+		Time: time.Now().UTC(),
+	}
+
+	if err = cfg.Mongo.Tokens().Insert(&t); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// AllTokens returns the API tokens.
+func AllTokens(cfg *Config) ([]*Token, error) {
+	var tokens []*Token
+
+	if err := cfg.Mongo.Tokens().Find(nil).Sort("time").All(&tokens); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// RevokeToken removes the API tokens with the name. Returns the number of
+// tokens removed.
+func RevokeToken(cfg *Config, name string) (int, error) {
+	info, err := cfg.Mongo.Tokens().RemoveAll(bson.M{"name": name})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return info.Removed, nil
+}
+
+// HashPassword returns the bcrypt hash of the password for use in the
+// auth.users option.
+func HashPassword(password string) (string, error) {
+	b, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+// JWTConfig defines how JWT bearer tokens are verified. Tokens are signed
+// with the HMAC key or the private key of the public key file. The name of
+// the identity is the subject of the token.
+type JWTConfig struct {
+	Key      string
+	KeyFile  string
+	Issuer   string
+	Audience string
+
+	// Parsed public key.
+	publicKey interface{}
+}
+
+// Enabled returns true if JWTs are accepted.
+func (c *JWTConfig) Enabled() bool {
+	return c.Key != "" || c.KeyFile != ""
+}
+
+// Load parses the public key file.
+func (c *JWTConfig) Load() error {
+	if c.KeyFile == "" {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(c.KeyFile)
+
+	if err != nil {
+		return err
+	}
+
+	if c.publicKey, err = jwt.ParseRSAPublicKeyFromPEM(b); err == nil {
+		return nil
+	}
+
+	if c.publicKey, err = jwt.ParseECPublicKeyFromPEM(b); err == nil {
+		return nil
+	}
+
+	return fmt.Errorf("No RSA or ECDSA public key found in %s", c.KeyFile)
+}
+
+// keyFunc returns the key to verify the token with. The signing method must
+// match the type of key so an HMAC token cannot be signed with the public
+// key.
+func (c *JWTConfig) keyFunc(t *jwt.Token) (interface{}, error) {
+	switch t.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		if c.Key != "" {
+			return []byte(c.Key), nil
+		}
+
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+		if c.publicKey != nil {
+			return c.publicKey, nil
+		}
+	}
+
+	return nil, fmt.Errorf("Unexpected signing method: %s", t.Method.Alg())
+}
+
+// Verify verifies the token and returns the identity of its subject.
+func (c *JWTConfig) Verify(s string) (*Identity, error) {
+	t, err := jwt.Parse(s, c.keyFunc)
+
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := t.Claims.(jwt.MapClaims)
+
+	if !ok || !t.Valid {
+		return nil, ErrUnauthenticated
+	}
+
+	if c.Issuer != "" && !claims.VerifyIssuer(c.Issuer, true) {
+		return nil, errors.New("Invalid token issuer")
+	}
+
+	if c.Audience != "" && !claims.VerifyAudience(c.Audience, true) {
+		return nil, errors.New("Invalid token audience")
+	}
+
+	sub, _ := claims["sub"].(string)
+
+	if sub == "" {
+		return nil, errors.New("Token has no subject")
+	}
+
+	id := Identity{
+		Name:   sub,
+		Method: AuthJWT,
+	}
+
+	// Roles issued by the identity provider.
+	roles, _ := claims["roles"].([]interface{})
+
+	for _, r := range roles {
+		if s, ok := r.(string); ok {
+			id.Roles = append(id.Roles, s)
+		}
+	}
+
+	return &id, nil
+}
+
+// AuthConfig defines configuration fields for authenticating HTTP requests.
+type AuthConfig struct {
+	// If true, requests must be authenticated.
+	Enabled bool
+
+	// Static API tokens keyed by name.
+	Tokens map[string]string
+
+	// Bcrypt password hashes for basic auth keyed by user name.
+	Users map[string]string
+
+	JWT JWTConfig
+
+	// Roles keyed by name and the roles of identities keyed by name.
+	Roles      map[string]*Role
+	Identities map[string][]string
+
+	// Identities of client certificate subjects. By default, the common
+	// name of the subject is the identity.
+	Subjects []*SubjectIdentity
+}
+
+// SubjectIdentity maps the distinguished name of a client certificate
+// subject, e.g. "CN=billing,OU=Services,O=CHOP", to an identity.
+type SubjectIdentity struct {
+	Subject  string
+	Identity string
+}
+
+// certIdentity returns the identity of a verified client certificate.
+func (c *AuthConfig) certIdentity(cert *x509.Certificate) *Identity {
+	subject := cert.Subject.String()
+
+	id := Identity{
+		Name:   cert.Subject.CommonName,
+		Method: AuthCert,
+	}
+
+	for _, s := range c.Subjects {
+		if strings.EqualFold(s.Subject, subject) {
+			id.Name = s.Identity
+			break
+		}
+	}
+
+	if id.Name == "" {
+		return nil
+	}
+
+	return &id
+}
+
+// staticToken returns the identity of the static token.
+func (c *AuthConfig) staticToken(token string) *Identity {
+	var id *Identity
+
+	// Compare all tokens to not leak which token matched.
+	for name, t := range c.Tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			id = &Identity{
+				Name:   name,
+				Method: AuthToken,
+			}
+		}
+	}
+
+	return id
+}
+
+// AuthenticateToken returns the identity of a bearer token. The token is
+// either a JWT, a static token, or a token managed with the token command.
+func AuthenticateToken(cfg *Config, token string) (*Identity, error) {
+	if token == "" {
+		return nil, ErrUnauthenticated
+	}
+
+	// JWTs have three dot-delimited parts.
+	if cfg.Auth.JWT.Enabled() && strings.Count(token, ".") == 2 {
+		return cfg.Auth.JWT.Verify(token)
+	}
+
+	if id := cfg.Auth.staticToken(token); id != nil {
+		return id, nil
+	}
+
+	var t Token
+
+	err := cfg.Mongo.Tokens().Find(bson.M{"hash": hashToken(token)}).One(&t)
+
+	if err == mgo.ErrNotFound {
+		return nil, ErrUnauthenticated
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Identity{
+		Name:   t.Name,
+		Method: AuthToken,
+	}, nil
+}
+
+// AuthenticatePassword returns the identity of the user if the password
+// matches.
+func AuthenticatePassword(cfg *Config, user, password string) (*Identity, error) {
+	hash, ok := cfg.Auth.Users[user]
+
+	// Compare against a hash anyway so unknown users take as long.
+	if !ok {
+		hash = dummyPasswordHash
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil || !ok {
+		return nil, ErrUnauthenticated
+	}
+
+	return &Identity{
+		Name:   user,
+		Method: AuthBasic,
+	}, nil
+}
+
+// authenticateHeader returns the identity of the bearer token or basic auth
+// credentials of an Authorization header.
+func authenticateHeader(cfg *Config, header string) (*Identity, error) {
+	switch {
+	case strings.HasPrefix(header, "Bearer "):
+		return AuthenticateToken(cfg, strings.TrimSpace(header[7:]))
+
+	case strings.HasPrefix(header, "Basic "):
+		b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(header[6:]))
+
+		if err != nil {
+			return nil, ErrUnauthenticated
+		}
+
+		creds := strings.SplitN(string(b), ":", 2)
+
+		if len(creds) != 2 {
+			return nil, ErrUnauthenticated
+		}
+
+		return AuthenticatePassword(cfg, creds[0], creds[1])
+	}
+
+	return nil, ErrUnauthenticated
+}
+
+// authenticate returns the identity of the request credentials.
+func authenticate(cfg *Config, c echo.Context) (*Identity, error) {
+	header := c.Request().Header().Get("Authorization")
+
+	if strings.HasPrefix(header, "Bearer ") || strings.HasPrefix(header, "Basic ") {
+		return authenticateHeader(cfg, header)
+	}
+
+	// EventSource cannot set headers so the stream accepts tokens as a
+	// query parameter. Other routes do not so tokens are not leaked in
+	// links and logs.
+	if c.Request().URL().Path() == streamPath {
+		if token := c.QueryParam("access_token"); token != "" {
+			return AuthenticateToken(cfg, token)
+		}
+	}
+
+	// Client certificate verified by the listener.
+	if req, ok := c.Request().(*standard.Request); ok && req.TLS != nil && len(req.TLS.VerifiedChains) > 0 {
+		if id := cfg.Auth.certIdentity(req.TLS.VerifiedChains[0][0]); id != nil {
+			return id, nil
+		}
+	}
+
+	return nil, ErrUnauthenticated
+}
+
+// identityName returns the name of the identity of the request or an empty
+// string if the request is not authenticated.
+func identityName(c echo.Context) string {
+	if id, ok := c.Get("identity").(*Identity); ok {
+		return id.Name
+	}
+
+	return ""
+}
+
+func isPublicPath(p string) bool {
+	if p == "/" {
+		return true
+	}
+
+	for _, prefix := range publicPaths {
+		if strings.HasPrefix(p, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// authMiddleware requires requests to be authenticated and sets the identity
+// on the context.
+func authMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		cfg := c.Get("config").(*Config)
+
+		if isPublicPath(c.Request().URL().Path()) {
+			return next(c)
+		}
+
+		id, err := authenticate(cfg, c)
+
+		// Credentials are optional if authentication is disabled, but
+		// are still used to identify the author of revisions.
+		if err != nil && !cfg.Auth.Enabled {
+			return next(c)
+		}
+
+		if err != nil {
+			RecordAudit(cfg, &AuditEntry{
+				Operation: OpAuthenticate,
+				Client:    c.Request().RemoteAddress(),
+				Outcome:   AuditDenied,
+				Error:     err.Error(),
+			})
+
+			if len(cfg.Auth.Users) > 0 {
+				c.Response().Header().Set("WWW-Authenticate", `Basic realm="scds"`)
+			} else {
+				c.Response().Header().Set("WWW-Authenticate", `Bearer realm="scds"`)
+			}
+
+			return &Error{
+				Status:  http.StatusUnauthorized,
+				Code:    CodeUnauthenticated,
+				Message: "Authentication required",
+				Details: err.Error(),
+			}
+		}
+
+		id.Roles = append(id.Roles, cfg.Auth.Identities[id.Name]...)
+
+		c.Set("identity", id)
+
+		return next(c)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestAuthenticatePassword(t *testing.T) {
+	hash, err := HashPassword("secret")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Config{
+		Auth: AuthConfig{
+			Users: map[string]string{"jane": hash},
+		},
+	}
+
+	if id, err := AuthenticatePassword(c, "jane", "secret"); err != nil || id.Name != "jane" {
+		t.Errorf("expected jane to be authenticated, got %v (%v)", id, err)
+	}
+
+	if _, err := AuthenticatePassword(c, "jane", "wrong"); err != ErrUnauthenticated {
+		t.Errorf("expected wrong password to fail, got %v", err)
+	}
+
+	if _, err := AuthenticatePassword(c, "bob", "secret"); err != ErrUnauthenticated {
+		t.Errorf("expected unknown user to fail, got %v", err)
+	}
+}
+
+func TestAuthenticateToken(t *testing.T) {
+	c := &Config{
+		Auth: AuthConfig{
+			Tokens: map[string]string{"billing": "abc123"},
+			JWT: JWTConfig{
+				Key:    "jwt-secret",
+				Issuer: "idp",
+			},
+		},
+	}
+
+	if id, err := AuthenticateToken(c, "abc123"); err != nil || id.Name != "billing" || id.Method != AuthToken {
+		t.Errorf("expected static token to be authenticated, got %v (%v)", id, err)
+	}
+
+	sign := func(claims jwt.MapClaims, key string) string {
+		s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(key))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return s
+	}
+
+	exp := time.Now().Add(time.Hour).Unix()
+
+	tok := sign(jwt.MapClaims{"sub": "jane", "iss": "idp", "exp": exp}, "jwt-secret")
+
+	if id, err := AuthenticateToken(c, tok); err != nil || id.Name != "jane" || id.Method != AuthJWT {
+		t.Errorf("expected jwt to be authenticated, got %v (%v)", id, err)
+	}
+
+	invalid := []string{
+		sign(jwt.MapClaims{"sub": "jane", "iss": "idp", "exp": exp}, "other"),
+		sign(jwt.MapClaims{"sub": "jane", "iss": "other", "exp": exp}, "jwt-secret"),
+		sign(jwt.MapClaims{"sub": "jane", "iss": "idp", "exp": time.Now().Add(-time.Hour).Unix()}, "jwt-secret"),
+		sign(jwt.MapClaims{"iss": "idp", "exp": exp}, "jwt-secret"),
+	}
+
+	for i, tok := range invalid {
+		if id, err := AuthenticateToken(c, tok); err == nil {
+			t.Errorf("test %d: expected jwt to be rejected, got %v", i, id)
+		}
+	}
+}
+
+func TestIsPublicPath(t *testing.T) {
+	tests := map[string]bool{
+		"/":                true,
+		"/confirm/abc":     true,
+		"/unsubscribe/abc": true,
+		"/openapi.json":    true,
+		"/objects/bob":     false,
+		"/subscribers":     false,
+	}
+
+	for p, public := range tests {
+		if isPublicPath(p) != public {
+			t.Errorf("%s: expected public to be %v", p, public)
+		}
+	}
+}
+
+func TestCertIdentity(t *testing.T) {
+	c := AuthConfig{
+		Subjects: []*SubjectIdentity{
+			{Subject: "CN=billing,OU=Services,O=CHOP", Identity: "billing-pipeline"},
+		},
+	}
+
+	cert := &x509.Certificate{
+		Subject: pkix.Name{
+			CommonName:         "billing",
+			OrganizationalUnit: []string{"Services"},
+			Organization:       []string{"CHOP"},
+		},
+	}
+
+	if id := c.certIdentity(cert); id == nil || id.Name != "billing-pipeline" || id.Method != AuthCert {
+		t.Errorf("expected mapped identity, got %v", id)
+	}
+
+	// Defaults to the common name.
+	cert.Subject.Organization = []string{"Other"}
+
+	if id := c.certIdentity(cert); id == nil || id.Name != "billing" {
+		t.Errorf("expected common name identity, got %v", id)
+	}
+
+	cert.Subject.CommonName = ""
+
+	if id := c.certIdentity(cert); id != nil {
+		t.Errorf("expected no identity, got %v", id)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo"
+)
+
+// Permissions granted by roles.
+const (
+	PermRead  = "read"
+	PermWrite = "write"
+	PermAdmin = "admin"
+)
+
+// Role grants permissions to read and write keys matching the patterns. Admins
+// can read and write all keys and manage subscribers, webhooks, and tokens.
+type Role struct {
+	Read  []string
+	Write []string
+	Admin bool
+}
+
+// Validate checks the key patterns of the role.
+func (r *Role) Validate() error {
+	for _, ps := range [][]string{r.Read, r.Write} {
+		for _, p := range ps {
+			if err := checkKeyPattern(p); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Allowed returns true if the identity has the permission on the key. The key
+// is ignored for the admin permission. All requests are allowed if
+// authentication is disabled and all identities are allowed everything if no
+// roles are defined.
+func (c *AuthConfig) Allowed(id *Identity, perm, key string) bool {
+	if !c.Enabled {
+		return true
+	}
+
+	if id == nil {
+		return false
+	}
+
+	if len(c.Roles) == 0 {
+		return true
+	}
+
+	for _, name := range id.Roles {
+		r, ok := c.Roles[name]
+
+		if !ok {
+			continue
+		}
+
+		if r.Admin {
+			return true
+		}
+
+		switch perm {
+		case PermRead:
+			if matchKeyPatterns(r.Read, key) {
+				return true
+			}
+
+		case PermWrite:
+			if matchKeyPatterns(r.Write, key) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// allowed returns true if the identity of the request has the permission on
+// the key.
+func allowed(c echo.Context, perm, key string) bool {
+	cfg := c.Get("config").(*Config)
+	id, _ := c.Get("identity").(*Identity)
+
+	return cfg.Auth.Allowed(id, perm, key)
+}
+
+func forbidden(perm, key string) error {
+	msg := fmt.Sprintf("%s permission required", perm)
+
+	if key != "" {
+		msg = fmt.Sprintf("%s permission on %s required", perm, key)
+	}
+
+	return &Error{
+		Status:  http.StatusForbidden,
+		Code:    CodeForbidden,
+		Message: "Permission denied",
+		Details: msg,
+	}
+}
+
+// requirePerm returns middleware that requires the permission on the key
+// parameter of the route.
+func requirePerm(perm string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := c.Param("key")
+
+			if !allowed(c, perm, key) {
+				return forbidden(perm, key)
+			}
+
+			return next(c)
+		}
+	}
+}
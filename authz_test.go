@@ -0,0 +1,58 @@
+package main
+
+import "testing"
+
+func TestAuthConfigAllowed(t *testing.T) {
+	c := AuthConfig{
+		Enabled: true,
+		Roles: map[string]*Role{
+			"billing":  {Read: []string{"billing.*"}, Write: []string{"billing.*"}},
+			"research": {Read: []string{"study.*"}},
+			"ops":      {Admin: true},
+		},
+	}
+
+	billing := &Identity{Name: "pipeline", Roles: []string{"billing"}}
+	research := &Identity{Name: "jane", Roles: []string{"research"}}
+	ops := &Identity{Name: "bob", Roles: []string{"ops"}}
+	none := &Identity{Name: "eve"}
+
+	tests := []struct {
+		Identity *Identity
+		Perm     string
+		Key      string
+		Allowed  bool
+	}{
+		{billing, PermWrite, "billing.123", true},
+		{billing, PermRead, "billing.123", true},
+		{billing, PermWrite, "study.1", false},
+		{billing, PermAdmin, "", false},
+		{research, PermRead, "study.1", true},
+		{research, PermWrite, "study.1", false},
+		{research, PermRead, "billing.123", false},
+		{ops, PermWrite, "study.1", true},
+		{ops, PermAdmin, "", true},
+		{none, PermRead, "study.1", false},
+		{nil, PermRead, "study.1", false},
+	}
+
+	for i, test := range tests {
+		if c.Allowed(test.Identity, test.Perm, test.Key) != test.Allowed {
+			t.Errorf("test %d: expected allowed to be %v", i, test.Allowed)
+		}
+	}
+
+	// Without roles, authenticated identities are allowed everything.
+	c.Roles = nil
+
+	if !c.Allowed(none, PermAdmin, "") || c.Allowed(nil, PermRead, "study.1") {
+		t.Error("expected only authenticated identities to be allowed")
+	}
+
+	// Without authentication, everything is allowed.
+	c.Enabled = false
+
+	if !c.Allowed(nil, PermWrite, "study.1") {
+		t.Error("expected all requests to be allowed")
+	}
+}
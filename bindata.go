@@ -64,7 +64,27 @@ func (fi bindata_file_info) Sys() interface{} {
 	return nil
 }
 
-var _email_changed_object_email_body_txt = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\xf2\x4e\xad\xb4\x52\xa8\xae\xd6\x03\xd2\xb5\xb5\x5c\x61\xa9\x45\xc5\x99\xf9\x79\x60\x11\x28\x1b\x28\x1a\x92\x99\x9b\x0a\x16\x02\x31\x80\xfc\xd0\x20\x1f\x30\x17\x48\x23\xf4\x28\xc0\x44\xa1\x7c\x88\x24\x57\x75\x75\x66\x9a\x82\x9e\x73\x46\x62\x5e\x7a\x6a\x31\x50\x40\x59\x01\xca\x06\x49\x21\xc4\xab\xab\x53\xf3\x52\x40\x14\x48\xb5\x63\x4a\x4a\x66\x09\xd0\x08\x88\x7a\x38\x0f\xac\x03\x49\x0e\x45\x4f\x50\x6a\x6e\x7e\x59\x62\x0e\x44\x0b\x8c\x03\xd6\x81\x90\x81\x6a\xe0\x02\x04\x00\x00\xff\xff\x3f\x78\xb2\x1d\xf4\x00\x00\x00")
+var _email_changed_object_email_body_html = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\xd5\x54\x4d\x8f\xd3\x30\x10\xbd\xef\xaf\x18\xb2\x7b\xa4\x0d\x20\x84\xaa\x36\x8d\xb4\x2c\x70\x01\x69\x51\xb5\x20\x71\x74\xe2\x71\x6a\x70\xec\xc8\x76\xab\x96\x90\xff\xbe\xe3\xb8\xe9\xf6\x63\x91\x40\x20\x24\x4e\x19\xcf\xe7\x7b\xcf\x13\x67\x4f\xde\xdc\xde\xdc\x7d\xf9\xf8\x16\x96\xbe\x56\xf9\x45\xb6\xfb\x14\x86\x6f\xc1\xf9\xad\xc2\x79\x22\x8c\xf6\x23\xc1\x6a\xa9\xb6\x53\x70\x4c\xbb\x91\x43\x2b\xc5\x0c\xfa\x80\x93\xdf\x71\x0a\xcf\x5f\x36\x9b\x59\x42\x85\x4d\x7e\x01\x90\x39\x6f\x8d\xae\xf2\xb6\x1d\xbf\xc7\x6d\xd7\x65\xe9\xce\x01\xe5\x92\xe9\x0a\x39\x30\x0f\x14\xbc\x93\x35\x76\xdd\x38\x54\x30\x58\x5a\x14\xf3\x84\xbc\x9f\x16\x1f\xba\x2e\xc9\x6f\x8b\xaf\x58\xfa\x2c\x65\x39\xfc\x38\x8a\x7f\x46\xeb\xa4\xd1\xbb\xb4\xdd\x09\x1e\x02\x61\x1e\x23\x28\x29\x61\x69\x5b\x8f\x75\xa3\x98\x47\x48\xb8\x14\x22\x81\xf1\x02\xd7\x32\xa6\x11\xda\x81\x63\x69\x94\xb1\x53\xb8\x9c\x4c\x26\xc7\xbc\x5e\xf4\xbc\x8e\xe0\x69\xb7\x2a\x5c\x69\x65\x81\x11\xc2\x63\x3d\x92\xfc\x20\x2d\xc0\xe9\xd1\x64\x69\xd0\x35\x7c\xa3\xcc\x6d\xcb\x51\x48\x3d\x60\x23\xe0\x9e\x15\x0a\xa1\x44\xa5\x1a\xc6\xb9\xd4\xd5\x3c\x79\xb5\x1f\x50\x18\xcb\xd1\x8e\x68\x8e\x62\x8d\x23\x74\x83\x15\x94\x27\x0d\xfd\x12\x19\x0f\x56\xb0\xed\xbe\x8a\x95\xdf\x2a\x6b\x56\x9a\x13\x36\x44\x9c\x81\xc7\x8d\x1f\x31\x25\x2b\x3d\x05\x85\xc2\xc7\xf2\x58\xb6\xcc\xdf\x49\x54\x3c\x4b\xc9\x3a\x70\xbe\x46\x61\x2c\x9e\x7a\xaf\x85\x47\xfb\xe0\x24\xcb\xf6\x40\xd2\x3d\x92\xcc\x47\xc6\x21\xdc\xb6\x36\x5c\x3e\x5c\x89\x30\xe1\x29\x5c\xc5\x65\x80\xe9\x1c\xc6\x37\xbd\xe9\x82\x02\xf6\x84\xae\x37\x0d\xdd\x43\xb3\x01\x67\x94\xe4\x70\xc9\x39\x9f\xc1\x1a\xad\x97\x25\x53\x03\x0d\x4a\x3a\x64\xc1\xf3\xac\x34\x1c\x69\x01\xe3\xb0\xb0\x12\xbd\x83\xa0\xf1\x83\xb4\x47\x35\x12\x34\x80\xae\xbc\xb1\x38\x84\x6b\x66\x2b\x49\x53\x9e\x91\xbf\x6d\xb7\xac\x56\x03\xf8\x71\x14\x26\xf4\xa7\xfc\x5f\x6a\xcf\xc5\x6f\xb4\xef\x15\x3e\xef\x3e\x28\x1d\x44\x45\x4d\xf4\xce\xb4\x5d\x33\xb5\x8a\xd2\x5e\xd3\x1e\x79\xda\xf7\x7f\x2e\xee\x5f\x54\xa3\x67\xf3\x67\x32\x2c\xb0\x36\x74\xfa\x9f\x56\xec\x27\xac\x4f\xc5\x3d\x53\x21\xfe\x82\xc3\x53\xd3\x3f\x29\xf9\x10\xba\x07\xc1\x62\x63\x79\xf1\x05\x00\x00")
+
+func email_changed_object_email_body_html_bytes() ([]byte, error) {
+	return bindata_read(
+		_email_changed_object_email_body_html,
+		"email/changed_object_email_body.html",
+	)
+}
+
+func email_changed_object_email_body_html() (*asset, error) {
+	bytes, err := email_changed_object_email_body_html_bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindata_file_info{name: "email/changed_object_email_body.html", size: 1521, mode: os.FileMode(420), modTime: time.Unix(1792423414, 0)}
+	a := &asset{bytes: bytes, info:  info}
+	return a, nil
+}
+
+var _email_changed_object_email_body_txt = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\xf3\x4e\xad\xb4\x52\xa8\xae\xd6\xf3\x4e\xad\xac\xad\xe5\x0a\x4b\x2d\x2a\xce\xcc\xcf\x03\x8b\x40\xd9\x40\xd1\x90\xcc\xdc\x54\xb0\x10\x88\x01\xe4\x87\x06\xf9\x80\xb9\x40\x1a\xa1\x47\x01\x26\x0a\xe5\x43\x24\xb9\xaa\xab\x33\xd3\x14\xf4\x9c\x33\x12\xf3\xd2\x53\x8b\x81\x02\xca\x0a\x50\x36\x48\x0a\x21\x5e\x5d\x9d\x9a\x97\x02\xa2\x40\xaa\x1d\x53\x52\x32\x4b\x80\x46\x40\xd4\xc3\x79\x60\x1d\x48\x72\x28\x7a\x82\x52\x73\xf3\xcb\x12\x73\x20\x5a\x60\x1c\xb0\x0e\x84\x0c\x54\x03\x17\x97\xae\x2e\x57\x68\x5e\x71\x69\x52\x71\x72\x51\x66\x12\xc4\x6b\x48\x7c\x88\xcb\x01\xc3\x48\xb7\x4e\x19\x01\x00\x00")
 
 func email_changed_object_email_body_txt_bytes() ([]byte, error) {
 	return bindata_read(
@@ -79,12 +99,112 @@ func email_changed_object_email_body_txt() (*asset, error) {
 		return nil, err
 	}
 
-	info := bindata_file_info{name: "email/changed_object_email_body.txt", size: 244, mode: os.FileMode(420), modTime: time.Unix(1438253661, 0)}
+	info := bindata_file_info{name: "email/changed_object_email_body.txt", size: 281, mode: os.FileMode(420), modTime: time.Unix(1792423414, 0)}
+	a := &asset{bytes: bytes, info:  info}
+	return a, nil
+}
+
+var _email_confirm_email_body_html = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\x55\x91\x31\x4f\xc3\x30\x10\x85\x77\x7e\xc5\x11\x56\x9a\x08\xc4\x50\xa5\x6e\x96\xd2\x01\x09\x09\x84\xca\xc0\xe8\x38\xe7\xe4\x24\xc7\x0e\xb6\x43\x09\x55\xfe\x3b\x76\x92\x0e\x99\x4e\xe7\x7b\xcf\xfe\xde\x99\xdd\x3e\xbf\x1d\x4e\x5f\xef\x47\x68\x7c\xab\x8a\x1b\xb6\x94\xd2\x54\x03\x38\x3f\x28\xdc\x27\xd2\x68\xbf\x91\xbc\x25\x35\xe4\xe0\xb8\x76\x1b\x87\x96\xe4\x0e\xa6\x81\xa3\x3f\xcc\xe1\xe1\xa9\xfb\xdd\x25\xc1\xd8\x15\xcc\x79\x6b\x74\x5d\x5c\x2e\xe9\xb1\xe5\xa4\xc6\x91\x65\xcb\x11\x9c\xb9\x03\xd7\x97\x4e\x58\x2a\xb1\x02\x6f\x40\x34\x5c\xd7\x08\xda\x78\x92\x24\xb8\x27\xa3\x5d\x0a\x27\x13\x1e\xe7\xd6\x83\x45\x81\xf4\x43\xba\x5e\x2b\xee\x41\x18\x2d\xc9\xb6\xe0\x1b\xbc\xde\xd8\xc5\x51\xca\xb2\x6e\xc6\xe0\xd0\x58\x94\xfb\x24\x70\x1c\x66\xf1\xe7\xc7\xeb\x38\x26\xc5\xd2\xad\x6c\x2c\xe3\xc5\xe2\xbc\xc6\x16\x46\x19\x9b\xc3\xdd\x76\xbb\x5d\x47\x7d\x9c\xa2\xbe\x48\x18\x4c\x0f\x15\x55\x11\x2d\x80\x7e\xf7\xe8\x7c\xe0\xa1\x40\x47\xb5\x36\x16\xa7\x06\x30\x2e\x01\xb8\x8e\xba\x75\x0a\x38\x93\x52\x50\x86\x00\xa8\xfd\x02\x9e\xc5\xcd\xc7\x3a\x7f\xc4\x3f\x90\x27\xcf\x74\xa0\x01\x00\x00")
+
+func email_confirm_email_body_html_bytes() ([]byte, error) {
+	return bindata_read(
+		_email_confirm_email_body_html,
+		"email/confirm_email_body.html",
+	)
+}
+
+func email_confirm_email_body_html() (*asset, error) {
+	bytes, err := email_confirm_email_body_html_bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindata_file_info{name: "email/confirm_email_body.html", size: 416, mode: os.FileMode(420), modTime: time.Unix(1792423414, 0)}
+	a := &asset{bytes: bytes, info:  info}
+	return a, nil
+}
+
+var _email_confirm_email_body_txt = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\x55\x8e\x31\x0e\xc2\x30\x14\x43\xf7\x9c\xc2\x07\x40\x39\x00\x2b\x62\x40\x62\x42\x70\x80\x34\xfd\x2d\x5f\x6a\x7f\x20\xf9\xa5\x42\x51\xee\x4e\x02\x62\xe8\x68\xd9\x7e\x76\xce\xf6\x38\x3b\x9e\x4a\xc1\xea\x12\xd2\xd2\x25\x1f\xb9\xa3\x1e\x1a\xe0\xef\x4e\x46\x82\x04\xe5\x81\xbd\x53\x0e\x92\x2c\xae\x01\x49\x5d\x54\x44\xf2\xc4\x2f\x96\xd1\x6c\x12\x3b\xf8\x20\x03\xc7\x19\x7a\xa7\x3f\xf1\xd1\xac\xbd\x31\x39\xdb\xc3\xcf\xbd\x5d\xce\xa5\x18\x73\x1a\xf0\x0e\x0b\x7a\xee\xdb\x4e\x65\x3e\x17\x4a\x5a\xab\x5c\x41\x3c\x4a\x88\xf4\x15\xa0\x76\x13\x4e\x5a\x6e\x7b\xc9\xac\x3c\x4d\xe8\xea\x16\x89\x5a\xf3\x01\xc0\x1c\x4f\x11\xd3\x00\x00\x00")
+
+func email_confirm_email_body_txt_bytes() ([]byte, error) {
+	return bindata_read(
+		_email_confirm_email_body_txt,
+		"email/confirm_email_body.txt",
+	)
+}
+
+func email_confirm_email_body_txt() (*asset, error) {
+	bytes, err := email_confirm_email_body_txt_bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindata_file_info{name: "email/confirm_email_body.txt", size: 211, mode: os.FileMode(420), modTime: time.Unix(1792423414, 0)}
+	a := &asset{bytes: bytes, info:  info}
+	return a, nil
+}
+
+var _email_digest_email_body_html = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\xd5\x55\x51\x6f\xd3\x30\x10\x7e\xdf\xaf\x38\xb2\x3d\x80\x44\x93\x0d\x10\xaa\x5a\x37\xd2\x18\x43\x42\x43\x02\x95\x81\xc4\xa3\x13\x5f\x5a\x83\x63\x47\x8e\xdb\xb5\x44\xf9\xef\x9c\xe3\xa6\xcb\xb6\x0a\x21\x04\x48\x3c\xf5\x72\xfe\x2e\xf7\xdd\xf7\x39\x57\xf6\xe8\xf5\xfb\x8b\xeb\x2f\x1f\x2e\x61\xe9\x4a\x95\x1e\xb1\xdd\x4f\x66\xc4\x16\x6a\xb7\x55\x38\x8b\x0a\xa3\xdd\xa8\xe0\xa5\x54\xdb\x09\xd4\x5c\xd7\xa3\x1a\xad\x2c\xa6\xd0\x1d\xd4\xf2\x3b\x4e\xe0\xec\x45\xb5\x99\x46\x54\x58\xa5\x4d\xa3\x50\x43\xfc\xd6\x61\x59\xb7\x2d\x68\xbc\x01\xae\x05\xe4\x4b\xae\x17\x28\xc0\x64\x5f\x31\x77\x35\x64\xe8\x6e\x90\x80\x4d\x13\x7f\x74\xdc\x3a\x82\x7a\x18\x3d\x5e\x6a\xd1\xb6\x31\x4b\xaa\xf4\xa8\x69\xac\xaf\xda\xbf\x8d\xf8\x3d\x4f\x19\x87\xa5\xc5\x62\x16\x11\xf6\xd3\xfc\x5d\xdb\x46\xd4\x33\xbe\xc2\x6d\xdb\xb2\x84\xa7\x2c\x21\x8c\x27\x32\xc4\x7d\x46\x5b\x4b\xa3\x77\xf0\xdd\x13\xdc\x1e\x84\x52\xe0\xce\xe7\xae\x65\x89\x3e\x41\x04\x98\xe3\x99\x42\xc8\x51\xa9\x8a\x0b\x21\xf5\x62\x16\xbd\x8c\x7a\x65\x32\x63\x05\xda\x51\x6e\x94\xe2\x55\x4d\x32\xf4\x91\x97\x02\x80\xb9\x25\x72\xe1\x23\x1f\xdb\x7d\x15\xcf\xbf\x2d\xac\x59\x69\x31\x81\x63\x44\x9c\x82\xc3\x8d\x1b\x71\x25\x17\x7a\x02\x0a\x0b\x17\xca\x43\xd9\x32\x7d\x23\x51\x09\x96\x50\x34\x48\xbe\xc2\xc2\x58\xbc\x9f\x3d\x2f\x1c\xda\xdb\x24\x45\xb6\x23\x92\xec\x99\x30\xe7\xad\x0d\xc7\xbd\xba\x27\x85\xef\xf0\x14\x4e\x82\x47\x30\x99\x41\x3c\xc7\xb5\xf4\xc2\xc4\x17\x5d\x8e\xb4\x1f\x4e\x10\xe6\x76\xa6\x22\xe7\xab\x0d\xd4\x46\x49\x01\xc7\x42\x88\x29\xac\xd1\x3a\x99\x73\xd5\xcf\x43\xa0\xe1\x38\x22\x65\xb9\x11\x48\x8e\x85\xae\x5e\xe7\x2e\x41\x1c\xc5\x00\x76\x50\xac\x82\x1a\x44\x29\xab\x2c\xf6\xc7\x25\xb7\x0b\x49\x5d\x4e\xa7\xfe\x12\xf0\x2c\xb3\xc4\x9b\x3b\x84\xc7\x5b\x5e\xaa\x7e\xa2\x38\xa8\xf5\x04\xce\x4e\x3b\x5f\xed\xaf\xb5\x13\xc5\x6f\xb6\xeb\x6c\x38\xdc\xad\xb7\xc4\xab\x8f\xfe\xa2\x3f\x30\x61\xcd\xd5\xea\x9e\x07\xe7\x74\xf3\x1c\x05\xff\xdc\x85\xbf\x24\x53\x37\xe2\x1f\xd4\x67\x8e\xa5\xa1\xf4\xff\x7a\x49\x7f\x22\xc7\x7d\x17\x1e\xc8\x13\xbe\xee\xf0\x4d\x53\xe0\xb7\x95\x5f\x9b\xe1\x8c\x55\x3d\x05\x5a\x4c\xc6\x12\xb9\xf1\x78\x7c\x77\x6f\x3f\xeb\xf6\xf6\x9d\x95\xaa\xeb\x55\x56\xe7\x56\x66\x18\xd6\xe5\xa1\x77\x44\xe9\x00\x16\xb6\xae\xdf\x96\x49\x4f\x24\xfc\x8d\xfc\x00\x39\x14\x0f\x2a\x5e\x06\x00\x00")
+
+func email_digest_email_body_html_bytes() ([]byte, error) {
+	return bindata_read(
+		_email_digest_email_body_html,
+		"email/digest_email_body.html",
+	)
+}
+
+func email_digest_email_body_html() (*asset, error) {
+	bytes, err := email_digest_email_body_html_bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindata_file_info{name: "email/digest_email_body.html", size: 1630, mode: os.FileMode(420), modTime: time.Unix(1792423414, 0)}
+	a := &asset{bytes: bytes, info:  info}
+	return a, nil
+}
+
+var _email_digest_email_body_txt = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\x55\x4f\xbd\x0e\x82\x30\x10\xde\xfb\x14\x97\x30\xd3\x07\x70\x33\xc6\xc1\xe8\x84\xe2\x4e\xe9\xa9\x35\x50\x12\x5a\x25\xe6\xc2\xbb\x7b\x6d\x11\x70\xea\xf7\x9f\x2b\x51\x83\x16\xe4\xc1\x63\xeb\xc6\x11\x2c\x0e\x50\x59\x0d\xf5\xa3\xb2\x77\xd4\xd0\xa9\x27\xd6\xde\x81\x42\x3f\x20\x07\x89\xe4\xd9\x57\xbd\xe7\x68\x88\x31\xdd\x5b\x3d\x8e\x52\x10\xf5\xa1\x31\x2f\x89\x2c\x0b\xee\x11\x3f\x8c\xc5\x15\x7b\x67\x3a\xbb\x09\xd2\x84\x59\xbe\x98\x16\xa3\x14\x00\xf3\xc9\x81\xb2\x38\xad\x93\x4c\xd9\x24\x32\x37\x90\xbb\x78\x57\xdc\x87\x09\x0b\xb6\x16\x9d\x08\xc3\x41\x29\xbd\xd5\xda\x78\x5e\x48\xf9\x99\xc5\xc6\xca\xfb\xeb\x14\xd8\x76\xef\xaa\x49\x95\x1f\x89\x8d\xc5\x99\x0b\xf1\x11\x22\xcf\x45\x69\xdd\x4b\xb9\xba\x37\x2a\x7d\x69\xc5\xd3\xfd\x5f\x53\x6a\x5d\x9a\x69\x01\x00\x00")
+
+func email_digest_email_body_txt_bytes() ([]byte, error) {
+	return bindata_read(
+		_email_digest_email_body_txt,
+		"email/digest_email_body.txt",
+	)
+}
+
+func email_digest_email_body_txt() (*asset, error) {
+	bytes, err := email_digest_email_body_txt_bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindata_file_info{name: "email/digest_email_body.txt", size: 361, mode: os.FileMode(420), modTime: time.Unix(1792423414, 0)}
 	a := &asset{bytes: bytes, info:  info}
 	return a, nil
 }
 
-var _email_new_object_email_body_txt = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\xf2\x4e\xad\xb4\x52\xa8\xae\xd6\x03\xd2\xb5\xb5\x5c\x61\xa9\x45\xc5\x99\xf9\x79\x60\x11\x28\x1b\x28\x1a\x92\x99\x9b\x0a\x16\x02\x31\x80\xfc\xd0\x20\x1f\x30\x17\x48\x23\xf4\x28\xc0\x44\xa1\x7c\x88\x24\x97\xb2\x82\x7f\x52\x56\x6a\x72\x09\x17\x17\x50\x0a\xc2\x04\x0a\x03\x02\x00\x00\xff\xff\x5e\xe9\x44\x05\x76\x00\x00\x00")
+var _email_new_object_email_body_html = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\x6d\x53\xc1\x6e\x9c\x40\x0c\xbd\xe7\x2b\x5c\x92\x63\x77\x69\xab\xaa\x5a\xb1\x2c\x97\xb4\xbd\xb4\x52\xaa\x2a\x8d\xd4\xa3\x61\x0c\x3b\xcd\x30\x83\x66\x66\xd3\xa5\x94\x7f\xaf\x87\x81\x84\x95\x7a\xc2\xd8\x7e\xcf\xef\x61\x93\xbf\xfa\x78\x77\x7b\xff\xf3\xdb\x27\x38\xfa\x56\x15\x57\xf9\xfc\x28\x8d\xe8\xc1\xf9\x5e\xd1\x21\xa9\x8d\xf6\x9b\x1a\x5b\xa9\xfa\x0c\x1c\x6a\xb7\x71\x64\x65\xbd\x87\xa9\xe0\xe4\x1f\xca\xe0\xed\xfb\xee\xbc\x4f\x18\xd8\x15\x57\x00\xb9\xf3\xd6\xe8\xa6\x18\x86\xed\x17\xea\xc7\x31\x4f\xe7\x04\xfc\x46\x07\x95\x25\xf4\x24\x00\x3d\x70\xc3\xbd\x6c\x69\x1c\xb7\x01\x85\x70\xb4\x54\x1f\x12\xce\xfe\xf8\xfe\x75\x1c\x93\xe2\xae\xfc\x45\x95\xcf\x53\x2c\xe0\xef\x45\xfd\x81\xac\x93\x46\xcf\x6d\xf3\x1b\xbc\x14\xc2\x4c\x64\x39\x29\xeb\xc9\x3d\x96\x8a\xa0\x22\xa5\x3a\x14\x42\xea\xe6\x90\x7c\x48\x16\x77\xa5\xb1\x82\xec\xa6\x32\x4a\x61\xe7\xd8\xca\x12\x05\x3b\x2c\xca\x1f\x09\x45\x88\x42\x6c\x9f\x51\x58\x3d\x36\xd6\x9c\xb4\xc8\xe0\x9a\x88\xf6\xe0\xe9\xec\x37\xa8\x64\xa3\x33\x50\x54\xfb\x08\x8f\xb0\x63\xf1\x59\x92\x12\x79\xca\xd1\x2a\xf9\x80\xea\x44\x2f\x49\x8e\xec\x34\x32\x7d\x9e\x99\xfb\xb0\x88\x58\x1e\x06\x8b\xba\x21\xb8\xa9\x03\xd7\x6b\xb8\x79\x0a\x70\xc8\x0e\xb0\x9d\x88\xd8\xf2\x4a\x5f\x74\xe5\x4d\xc7\xbb\xe9\xce\xe0\x8c\x92\x02\xae\x85\x10\x7b\x78\x22\xeb\x65\x85\x6a\x51\xcb\x4d\x6b\xb1\xa2\xc8\x2b\x23\x88\x97\x17\x27\x85\x4f\x39\x25\x58\x97\xb8\x68\xeb\x2c\x2d\xf3\x5a\xb4\x8d\x64\xae\x37\xcc\x34\x0c\x3d\xb6\x6a\xd6\x17\xd0\xdc\xb7\x02\x2f\x36\x83\x23\xd2\x4c\x1f\x2d\x47\xa3\x1c\x84\x65\x85\x43\x5a\xa8\x79\x1f\xc6\xf2\x57\xde\xed\x76\x97\x27\xf7\x6e\x3a\xb9\x8b\xab\xd1\xee\x54\xba\xca\xca\x92\xe2\x65\xfc\x8f\x23\x29\x56\x6d\xe1\x4a\xe2\x91\xa4\x8b\x80\xf8\x07\xfc\x03\x87\xe1\x26\xd9\x19\x03\x00\x00")
+
+func email_new_object_email_body_html_bytes() ([]byte, error) {
+	return bindata_read(
+		_email_new_object_email_body_html,
+		"email/new_object_email_body.html",
+	)
+}
+
+func email_new_object_email_body_html() (*asset, error) {
+	bytes, err := email_new_object_email_body_html_bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindata_file_info{name: "email/new_object_email_body.html", size: 793, mode: os.FileMode(420), modTime: time.Unix(1792423414, 0)}
+	a := &asset{bytes: bytes, info:  info}
+	return a, nil
+}
+
+var _email_new_object_email_body_txt = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\xf3\x4e\xad\xb4\x52\xa8\xae\xd6\xf3\x4e\xad\xac\xad\xe5\x0a\x4b\x2d\x2a\xce\xcc\xcf\x03\x8b\x40\xd9\x40\xd1\x90\xcc\xdc\x54\xb0\x10\x88\x01\xe4\x87\x06\xf9\x80\xb9\x40\x1a\xa1\x47\x01\x26\x0a\xe5\x43\x24\xb9\x94\x15\xfc\x93\xb2\x52\x93\x4b\xb8\xb8\x80\x52\x10\x26\x48\x58\x57\x97\x2b\x34\xaf\xb8\x34\xa9\x38\xb9\x28\x33\x09\x62\x38\x12\x1f\xa2\x17\x00\x34\x30\x94\x7a\x9b\x00\x00\x00")
 
 func email_new_object_email_body_txt_bytes() ([]byte, error) {
 	return bindata_read(
@@ -99,7 +219,7 @@ func email_new_object_email_body_txt() (*asset, error) {
 		return nil, err
 	}
 
-	info := bindata_file_info{name: "email/new_object_email_body.txt", size: 118, mode: os.FileMode(420), modTime: time.Unix(1438253632, 0)}
+	info := bindata_file_info{name: "email/new_object_email_body.txt", size: 155, mode: os.FileMode(420), modTime: time.Unix(1792423414, 0)}
 	a := &asset{bytes: bytes, info:  info}
 	return a, nil
 }
@@ -156,7 +276,13 @@ func AssetNames() []string {
 
 // _bindata is a table, holding each asset generator, mapped to its name.
 var _bindata = map[string]func() (*asset, error){
+	"email/changed_object_email_body.html": email_changed_object_email_body_html,
 	"email/changed_object_email_body.txt": email_changed_object_email_body_txt,
+	"email/confirm_email_body.html": email_confirm_email_body_html,
+	"email/confirm_email_body.txt": email_confirm_email_body_txt,
+	"email/digest_email_body.html": email_digest_email_body_html,
+	"email/digest_email_body.txt": email_digest_email_body_txt,
+	"email/new_object_email_body.html": email_new_object_email_body_html,
 	"email/new_object_email_body.txt": email_new_object_email_body_txt,
 }
 
@@ -201,8 +327,20 @@ type _bintree_t struct {
 }
 var _bintree = &_bintree_t{nil, map[string]*_bintree_t{
 	"email": &_bintree_t{nil, map[string]*_bintree_t{
+		"changed_object_email_body.html": &_bintree_t{email_changed_object_email_body_html, map[string]*_bintree_t{
+		}},
 		"changed_object_email_body.txt": &_bintree_t{email_changed_object_email_body_txt, map[string]*_bintree_t{
 		}},
+		"confirm_email_body.html": &_bintree_t{email_confirm_email_body_html, map[string]*_bintree_t{
+		}},
+		"confirm_email_body.txt": &_bintree_t{email_confirm_email_body_txt, map[string]*_bintree_t{
+		}},
+		"digest_email_body.html": &_bintree_t{email_digest_email_body_html, map[string]*_bintree_t{
+		}},
+		"digest_email_body.txt": &_bintree_t{email_digest_email_body_txt, map[string]*_bintree_t{
+		}},
+		"new_object_email_body.html": &_bintree_t{email_new_object_email_body_html, map[string]*_bintree_t{
+		}},
 		"new_object_email_body.txt": &_bintree_t{email_new_object_email_body_txt, map[string]*_bintree_t{
 		}},
 	}},
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Default number of events returned by a single changes request.
+const defaultChangesLimit = 1000
+
+// Event is an entry in the change feed. It pairs a revision with the key of
+// the object it was applied to.
+type Event struct {
+	Key      string    `json:"key"`
+	Revision *Revision `json:"revision"`
+}
+
+// Cursor returns the position of the event in the change feed.
+func (e *Event) Cursor() Cursor {
+	return Cursor{
+		Seq: e.Revision.Seq,
+	}
+}
+
+// Cursor is a position in the change feed. Events are ordered by the
+// sequence number of their revision. A cursor with a sequence number is
+// exclusive, reading from it returns the events that follow it. Otherwise it
+// includes all events at or after the time.
+type Cursor struct {
+	Seq  int64
+	Time int64
+}
+
+// String returns the opaque token representation of the cursor.
+func (c Cursor) String() string {
+	s := fmt.Sprintf("seq:%d", c.Seq)
+
+	if c.Seq == 0 {
+		s = fmt.Sprintf("time:%d", c.Time)
+	}
+
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+// ParseCursor parses a cursor token produced by Cursor.String. Cursors of
+// the format ordered by time, key, and version resume from the time of the
+// event, so events in the same second may be read again.
+func ParseCursor(s string) (Cursor, error) {
+	var c Cursor
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+
+	if err != nil {
+		return c, fmt.Errorf("[changes] invalid cursor %s", s)
+	}
+
+	toks := strings.SplitN(string(b), ":", 3)
+
+	switch {
+	case len(toks) == 2 && toks[0] == "seq":
+		c.Seq, err = strconv.ParseInt(toks[1], 10, 64)
+
+	case len(toks) == 2 && toks[0] == "time":
+		c.Time, err = strconv.ParseInt(toks[1], 10, 64)
+
+	// Time, version, and key.
+	case len(toks) == 3 && (toks[2] == "" || checkKey(toks[2])):
+		if _, err = strconv.Atoi(toks[1]); err == nil {
+			c.Time, err = strconv.ParseInt(toks[0], 10, 64)
+		}
+
+	default:
+		err = errors.New("unknown format")
+	}
+
+	if err != nil {
+		return Cursor{}, fmt.Errorf("[changes] invalid cursor %s", s)
+	}
+
+	return c, nil
+}
+
+// ParseSince parses a value that is either a cursor token or a time string
+// supported by ParseTimeString. A time produces a cursor that includes all
+// events at or after that time.
+func ParseSince(s string) (Cursor, error) {
+	if s == "" {
+		return Cursor{}, nil
+	}
+
+	if c, err := ParseCursor(s); err == nil {
+		return c, nil
+	}
+
+	// A duration is relative to now, but "since 24h" reads as 24 hours
+	// ago rather than in the future.
+	if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		s = "-" + s
+	}
+
+	t, err := ParseTimeString(s)
+
+	if err != nil {
+		return Cursor{}, err
+	}
+
+	return Cursor{Time: t}, nil
+}
+
+// Counter of the sequence numbers of revisions.
+const revisionsCounter = "revisions"
+
+// nextSeq allocates n sequence numbers of revisions and returns the first.
+func nextSeq(db *mgo.Database, n int) (int64, error) {
+	var doc struct {
+		Seq int64
+	}
+
+	chg := mgo.Change{
+		Update:    bson.M{"$inc": bson.M{"seq": n}},
+		Upsert:    true,
+		ReturnNew: true,
+	}
+
+	if _, err := db.C(mongoCounters).FindId(revisionsCounter).Apply(chg, &doc); err != nil {
+		return 0, err
+	}
+
+	return doc.Seq - int64(n) + 1, nil
+}
+
+// Duration of the lease on sequencing revisions. Leases of processes that
+// did not finish expire.
+const sequenceLease = time.Minute
+
+// Maximum number of revisions sequenced while holding the lease.
+const sequenceBatch = 1000
+
+// claimSequence leases sequencing revisions so only one process does it.
+// Returns false if another process holds the lease.
+func claimSequence(db *mgo.Database, now time.Time) (bool, error) {
+	_, err := db.C(mongoCounters).Upsert(bson.M{
+		"_id": revisionsCounter,
+		"$or": []bson.M{
+			{"lease": bson.M{"$exists": false}},
+			{"lease": bson.M{"$lte": now}},
+		},
+	}, bson.M{
+		"$set": bson.M{"lease": now.Add(sequenceLease)},
+	})
+
+	// The counter exists but is leased.
+	if mgo.IsDup(err) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// releaseSequence releases the lease on sequencing revisions.
+func releaseSequence(db *mgo.Database) {
+	err := db.C(mongoCounters).UpdateId(revisionsCounter, bson.M{
+		"$unset": bson.M{"lease": 1},
+	})
+
+	// The lease expires if it cannot be released.
+	if err != nil && err != mgo.ErrNotFound {
+		log.Printf("[changes] error releasing sequence lease: %s", err)
+	}
+}
+
+// sequence sets the sequence numbers of revisions that were written
+// without one in the order of their time, key, and version. Revisions are
+// only numbered after they are written and by one process at a time, so
+// they appear in the change feed in the order of their numbers. Returns the
+// number of revisions sequenced, which is zero if another process holds
+// the lease.
+func sequence(db *mgo.Database) (int, error) {
+	c := db.C(mongoObjects)
+
+	// Avoid taking the lease if there is nothing to sequence.
+	n, err := c.Find(bson.M{"unsequenced": true}).Limit(1).Count()
+
+	if err != nil || n == 0 {
+		return 0, err
+	}
+
+	ok, err := claimSequence(db, time.Now().UTC())
+
+	if err != nil || !ok {
+		return 0, err
+	}
+
+	defer releaseSequence(db)
+
+	pipe := []bson.M{
+		{"$match": bson.M{"unsequenced": true}},
+		{"$project": bson.M{"_id": 1, "key": 1, "history.version": 1, "history.time": 1, "history.seq": 1}},
+		{"$unwind": "$history"},
+		{"$match": bson.M{"history.seq": bson.M{"$exists": false}}},
+		{"$sort": bson.D{
+			{Name: "history.time", Value: 1},
+			{Name: "key", Value: 1},
+			{Name: "history.version", Value: 1},
+		}},
+		{"$limit": sequenceBatch},
+	}
+
+	var doc struct {
+		ID      bson.ObjectId `bson:"_id"`
+		History *Revision
+	}
+
+	n = 0
+	it := c.Pipe(pipe).AllowDiskUse().Iter()
+
+	for it.Next(&doc) {
+		// A number is skipped if the process stops before it is set.
+		seq, err := nextSeq(db, 1)
+
+		if err != nil {
+			it.Close()
+			return n, err
+		}
+
+		q := bson.M{
+			"_id": doc.ID,
+			"history": bson.M{"$elemMatch": bson.M{
+				"version": doc.History.Version,
+				"seq":     bson.M{"$exists": false},
+			}},
+		}
+
+		err = c.Update(q, bson.M{"$set": bson.M{"history.$.seq": seq}})
+
+		if err != nil && err != mgo.ErrNotFound {
+			it.Close()
+			return n, err
+		}
+
+		if err == nil {
+			n++
+		}
+	}
+
+	if err = it.Close(); err != nil {
+		return n, err
+	}
+
+	// Objects are only matched if no revision was written since they
+	// were sequenced.
+	_, err = c.UpdateAll(bson.M{
+		"unsequenced": true,
+		"history": bson.M{"$not": bson.M{"$elemMatch": bson.M{
+			"seq": bson.M{"$exists": false},
+		}}},
+	}, bson.M{
+		"$unset": bson.M{"unsequenced": 1},
+	})
+
+	return n, err
+}
+
+// sequenceRevisions marks objects with revisions put before revisions were
+// sequenced and sequences them. Only one process sequences them, the others
+// start without waiting for it to finish.
+func sequenceRevisions(db *mgo.Database) error {
+	cc := db.C(mongoCounters)
+
+	n, err := cc.Find(bson.M{"_id": revisionsCounter, "sequenced": true}).Count()
+
+	if err != nil || n > 0 {
+		return err
+	}
+
+	_, err = db.C(mongoObjects).UpdateAll(bson.M{
+		"history": bson.M{"$elemMatch": bson.M{"seq": bson.M{"$exists": false}}},
+	}, bson.M{
+		"$set": bson.M{"unsequenced": true},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if _, err = cc.UpsertId(revisionsCounter, bson.M{"$set": bson.M{"sequenced": true}}); err != nil {
+		return err
+	}
+
+	for {
+		if n, err = sequence(db); err != nil || n == 0 {
+			return err
+		}
+	}
+}
+
+// ChangesSince returns up to limit events that occurred after the cursor
+// ordered by their sequence numbers. The returned cursor points to the last
+// event and can be used to resume reading. If there are no new events, the
+// passed cursor is returned.
+//
+// Revisions that were written since the last read are sequenced first.
+// Revisions are numbered after they are written, so a revision is never
+// written after one with a greater number was read.
+func ChangesSince(cfg *Config, since Cursor, limit int) ([]*Event, Cursor, error) {
+	if limit <= 0 {
+		limit = defaultChangesLimit
+	}
+
+	c := cfg.Mongo.Objects()
+
+	n, err := sequence(c.Database)
+
+	if err != nil {
+		return nil, since, err
+	}
+
+	// Wake streams waiting for the revisions, which may have been put by
+	// other processes.
+	if n > 0 {
+		cfg.broker.Publish()
+	}
+
+	// Events strictly after the cursor. Revisions that are not sequenced
+	// yet are excluded.
+	after := bson.M{"history.seq": bson.M{"$gt": since.Seq}}
+
+	if since.Seq == 0 {
+		after["history.time"] = bson.M{"$gte": since.Time}
+	}
+
+	pipe := []bson.M{
+		// Narrow down the objects using the index before unwinding.
+		{"$match": after},
+		{"$project": bson.M{"_id": 0, "key": 1, "history": 1}},
+		{"$unwind": "$history"},
+		{"$match": after},
+		{"$sort": bson.M{"history.seq": 1}},
+		{"$limit": limit},
+	}
+
+	var docs []struct {
+		Key     string
+		History *Revision
+	}
+
+	if err := c.Pipe(pipe).All(&docs); err != nil {
+		return nil, since, err
+	}
+
+	events := make([]*Event, 0, len(docs))
+
+	for _, d := range docs {
+		if err := cfg.Encryption.DecryptRevision(d.History); err != nil {
+			return nil, since, fmt.Errorf("%s v%d: %s", d.Key, d.History.Version, err)
+		}
+
+		events = append(events, &Event{
+			Key:      d.Key,
+			Revision: d.History,
+		})
+
+		since = Cursor{Seq: d.History.Seq}
+	}
+
+	return events, since, nil
+}
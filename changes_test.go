@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestCursor(t *testing.T) {
+	for _, c := range []Cursor{{Seq: 42}, {Time: 1436960622}} {
+		p, err := ParseCursor(c.String())
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if p != c {
+			t.Errorf("expected %v, got %v", c, p)
+		}
+	}
+
+	// Cursors ordered by time, key, and version resume from the time.
+	p, err := ParseCursor(base64.RawURLEncoding.EncodeToString([]byte("1436960622:3:users.1")))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p != (Cursor{Time: 1436960622}) {
+		t.Errorf("expected time cursor, got %v", p)
+	}
+
+	if _, err = ParseCursor("not a cursor"); err == nil {
+		t.Error("expected error for invalid cursor")
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	c := Cursor{Seq: 10}
+
+	p, err := ParseSince(c.String())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p != c {
+		t.Errorf("cursor: expected %v, got %v", c, p)
+	}
+
+	p, err = ParseSince("1436960622")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Time != 1436960622 || p.Seq != 0 {
+		t.Errorf("timestamp: unexpected cursor %v", p)
+	}
+
+	// Durations are relative to the past.
+	p, err = ParseSince("24h")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Time > time.Now().Add(-23*time.Hour).Unix() {
+		t.Errorf("duration: expected time in the past, got %d", p.Time)
+	}
+}
+
+func TestChangesSince(t *testing.T) {
+	defer cfg.Mongo.Close()
+	resetDB()
+
+	for _, k := range []string{"bob", "sue", "bob"} {
+		if _, err := Put(cfg, k, map[string]interface{}{"time": time.Now().UnixNano()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Revisions are sequenced when the feed is read.
+	n, err := cfg.Mongo.Objects().Find(bson.M{"unsequenced": true}).Count()
+
+	if err != nil || n != 2 {
+		t.Fatalf("expected 2 unsequenced objects, got %d (%v)", n, err)
+	}
+
+	events, c, err := ChangesSince(cfg, Cursor{}, 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(events))
+	}
+
+	for i, e := range events {
+		if e.Revision.Seq != events[0].Revision.Seq+int64(i) {
+			t.Errorf("expected consecutive sequence numbers, got %d at %d", e.Revision.Seq, i)
+		}
+	}
+
+	if n, _ = cfg.Mongo.Objects().Find(bson.M{"unsequenced": true}).Count(); n != 0 {
+		t.Errorf("expected all objects to be sequenced, got %d", n)
+	}
+
+	if events, _, err = ChangesSince(cfg, c, 0); err != nil || len(events) != 0 {
+		t.Errorf("expected no events after the cursor, got %d (%v)", len(events), err)
+	}
+}
@@ -0,0 +1,452 @@
+// Package client is a client of the SCDS HTTP API. The API is described by
+// the OpenAPI document served at /openapi.json. The requests and types of
+// the client are checked against it by the tests of the server.
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Change is the before and after value of a changed field.
+type Change struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Revision is a change to an object.
+type Revision struct {
+	Version   int                    `json:"version"`
+	Time      int64                  `json:"time"`
+	Additions map[string]interface{} `json:"additions,omitempty"`
+	Removals  map[string]interface{} `json:"removals,omitempty"`
+	Changes   map[string]Change      `json:"changes,omitempty"`
+	Author    string                 `json:"author,omitempty"`
+	Hash      string                 `json:"hash,omitempty"`
+	URL       string                 `json:"url,omitempty"`
+}
+
+// Object is the state of an object at a version.
+type Object struct {
+	Key     string                 `json:"key"`
+	Value   map[string]interface{} `json:"value"`
+	Version int                    `json:"version"`
+	Time    int64                  `json:"time"`
+	Hash    string                 `json:"hash,omitempty"`
+	URL     string                 `json:"url,omitempty"`
+}
+
+// Event is a revision of an object.
+type Event struct {
+	Key      string    `json:"key"`
+	Revision *Revision `json:"revision"`
+}
+
+// Changes is a page of events and the cursor of the next page.
+type Changes struct {
+	Changes []*Event `json:"changes"`
+	Cursor  string   `json:"cursor"`
+}
+
+// Subscription defines the notifications subscribers receive.
+type Subscription struct {
+	Patterns []string `json:"patterns,omitempty"`
+	Events   []string `json:"events,omitempty"`
+	Fields   []string `json:"fields,omitempty"`
+	Digest   string   `json:"digest,omitempty"`
+	Quiet    string   `json:"quiet,omitempty"`
+}
+
+// Subscriber is an email subscribed to notifications.
+type Subscriber struct {
+	ID      string    `json:"_id,omitempty"`
+	Email   string    `json:"email"`
+	Time    time.Time `json:"time"`
+	Pending bool      `json:"pending,omitempty"`
+
+	Subscription
+}
+
+// Webhook is a URL notified of changes.
+type Webhook struct {
+	ID     string    `json:"_id,omitempty"`
+	URL    string    `json:"url"`
+	Secret string    `json:"secret,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// Delivery is an attempt to send a payload to a webhook.
+type Delivery struct {
+	ID      string    `json:"_id,omitempty"`
+	Webhook string    `json:"webhook"`
+	Event   string    `json:"event"`
+	Key     string    `json:"key"`
+	Version int       `json:"version"`
+	Attempt int       `json:"attempt"`
+	Status  int       `json:"status,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// AuditEntry is an operation recorded in the audit log.
+type AuditEntry struct {
+	ID        string    `json:"_id"`
+	Time      time.Time `json:"time"`
+	Identity  string    `json:"identity,omitempty"`
+	Operation string    `json:"operation"`
+	Key       string    `json:"key,omitempty"`
+	Version   int       `json:"version,omitempty"`
+	Client    string    `json:"client,omitempty"`
+	Outcome   string    `json:"outcome"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// AuditQuery filters the audit log. Zero values match all entries.
+type AuditQuery struct {
+	Identity  string
+	Operation string
+	Key       string
+
+	// Time (or duration relative to now) to read entries after.
+	Since string
+
+	Limit int
+}
+
+// Error is an error response of the API.
+type Error struct {
+	StatusCode int             `json:"-"`
+	Code       string          `json:"code"`
+	Message    string          `json:"message"`
+	Details    json.RawMessage `json:"details,omitempty"`
+}
+
+func (e *Error) Error() string {
+	var d string
+
+	if json.Unmarshal(e.Details, &d) == nil && d != "" {
+		return fmt.Sprintf("%s: %s", e.Message, d)
+	}
+
+	return e.Message
+}
+
+// IsNotFound returns true if the error is a not found response.
+func IsNotFound(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.StatusCode == http.StatusNotFound
+}
+
+// Client is a client of an SCDS service.
+type Client struct {
+	// URL of the service, e.g. http://localhost:5000.
+	URL string
+
+	// Token authenticates requests with a bearer token.
+	Token string
+
+	// User and Password authenticate requests with basic auth if
+	// no token is set.
+	User     string
+	Password string
+
+	// HTTP is the client used to send requests. Defaults to
+	// http.DefaultClient.
+	HTTP *http.Client
+}
+
+// New returns a client of the service at the URL.
+func New(url string) *Client {
+	return &Client{
+		URL: strings.TrimSuffix(url, "/"),
+	}
+}
+
+// do sends the request and decodes the response into out. Error responses
+// are returned as *Error.
+func (c *Client) do(method, path string, query url.Values, in, out interface{}) (int, error) {
+	var body io.Reader
+
+	if in != nil {
+		b, err := json.Marshal(in)
+
+		if err != nil {
+			return 0, err
+		}
+
+		body = bytes.NewReader(b)
+	}
+
+	u := strings.TrimSuffix(c.URL, "/") + path
+
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(method, u, body)
+
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	} else if c.User != "" {
+		req.SetBasicAuth(c.User, c.Password)
+	}
+
+	hc := c.HTTP
+
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+
+	resp, err := hc.Do(req)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		e := &Error{StatusCode: resp.StatusCode}
+		b, _ := ioutil.ReadAll(resp.Body)
+
+		if json.Unmarshal(b, e) != nil || e.Message == "" {
+			e.Message = http.StatusText(resp.StatusCode)
+		}
+
+		return resp.StatusCode, e
+	}
+
+	if out != nil && resp.StatusCode != http.StatusNoContent {
+		if err = json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, err
+		}
+	}
+
+	return resp.StatusCode, nil
+}
+
+// Put puts the value of the object. The revision is nil if the value did
+// not change.
+func (c *Client) Put(key string, value map[string]interface{}) (*Revision, error) {
+	var r Revision
+
+	code, err := c.do(http.MethodPut, "/objects/"+key, nil, value, &r)
+
+	if err != nil || code == http.StatusNoContent {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+func (c *Client) getObject(path string) (*Object, error) {
+	var o Object
+
+	if _, err := c.do(http.MethodGet, path, nil, nil, &o); err != nil {
+		if IsNotFound(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return &o, nil
+}
+
+// Get returns the latest state of the object. The object is nil if it does
+// not exist.
+func (c *Client) Get(key string) (*Object, error) {
+	return c.getObject("/objects/" + key)
+}
+
+// GetVersion returns the state of the object at the version. The object is
+// nil if it or the version does not exist.
+func (c *Client) GetVersion(key string, version int) (*Object, error) {
+	return c.getObject("/objects/" + key + "/v/" + strconv.Itoa(version))
+}
+
+// GetTime returns the state of the object at the time. The object is nil if
+// it did not exist at the time.
+func (c *Client) GetTime(key string, t time.Time) (*Object, error) {
+	return c.getObject("/objects/" + key + "/t/" + t.Format(time.RFC3339))
+}
+
+// Log returns the revisions of the object. The log is nil if the object
+// does not exist.
+func (c *Client) Log(key string) ([]*Revision, error) {
+	var log []*Revision
+
+	if _, err := c.do(http.MethodGet, "/log/"+key, nil, nil, &log); err != nil {
+		if IsNotFound(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return log, nil
+}
+
+// Keys returns the keys of the objects.
+func (c *Client) Keys() ([]string, error) {
+	var keys []string
+
+	_, err := c.do(http.MethodGet, "/keys", nil, nil, &keys)
+
+	return keys, err
+}
+
+// Changes returns up to limit events after the cursor. Use the cursor of the
+// returned changes to get the next page. A limit of zero uses the default
+// of the service.
+func (c *Client) Changes(since string, limit int) (*Changes, error) {
+	var chgs Changes
+
+	q := url.Values{}
+
+	if since != "" {
+		q.Set("since", since)
+	}
+
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+
+	if _, err := c.do(http.MethodGet, "/changes", q, nil, &chgs); err != nil {
+		return nil, err
+	}
+
+	return &chgs, nil
+}
+
+// Subscribers returns the subscribers.
+func (c *Client) Subscribers() ([]*Subscriber, error) {
+	var subs []*Subscriber
+
+	_, err := c.do(http.MethodGet, "/subscribers", nil, nil, &subs)
+
+	return subs, err
+}
+
+// Subscribe subscribes the emails. Subscribers must confirm their
+// subscription. It returns the number of subscribed emails.
+func (c *Client) Subscribe(s Subscription, emails ...string) (int, error) {
+	body := struct {
+		Emails []string `json:"emails"`
+		Subscription
+	}{
+		Emails:       emails,
+		Subscription: s,
+	}
+
+	var out struct {
+		Subscribed int `json:"subscribed"`
+	}
+
+	_, err := c.do(http.MethodPost, "/subscribers", nil, &body, &out)
+
+	return out.Subscribed, err
+}
+
+// Unsubscribe removes the subscriber by id or token.
+func (c *Client) Unsubscribe(token string) error {
+	_, err := c.do(http.MethodDelete, "/subscriber/"+token, nil, nil, nil)
+	return err
+}
+
+// Webhooks returns the registered webhooks.
+func (c *Client) Webhooks() ([]*Webhook, error) {
+	var hooks []*Webhook
+
+	_, err := c.do(http.MethodGet, "/webhooks", nil, nil, &hooks)
+
+	return hooks, err
+}
+
+// AddWebhook registers a webhook. A secret is generated if not provided.
+func (c *Client) AddWebhook(url, secret string) (*Webhook, error) {
+	w := Webhook{
+		URL:    url,
+		Secret: secret,
+	}
+
+	if _, err := c.do(http.MethodPost, "/webhooks", nil, &w, &w); err != nil {
+		return nil, err
+	}
+
+	return &w, nil
+}
+
+// RemoveWebhook removes the webhook. It returns false if the webhook does
+// not exist.
+func (c *Client) RemoveWebhook(id string) (bool, error) {
+	if _, err := c.do(http.MethodDelete, "/webhook/"+id, nil, nil, nil); err != nil {
+		if IsNotFound(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Deliveries returns up to limit of the most recent deliveries of the
+// webhook.
+func (c *Client) Deliveries(id string, limit int) ([]*Delivery, error) {
+	var ds []*Delivery
+
+	q := url.Values{}
+
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+
+	_, err := c.do(http.MethodGet, "/webhook/"+id+"/deliveries", q, nil, &ds)
+
+	return ds, err
+}
+
+// Audit returns the most recent entries of the audit log matching the query.
+func (c *Client) Audit(aq AuditQuery) ([]*AuditEntry, error) {
+	var entries []*AuditEntry
+
+	q := url.Values{}
+
+	for k, v := range map[string]string{
+		"identity":  aq.Identity,
+		"operation": aq.Operation,
+		"key":       aq.Key,
+		"since":     aq.Since,
+	} {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+
+	if aq.Limit > 0 {
+		q.Set("limit", strconv.Itoa(aq.Limit))
+	}
+
+	_, err := c.do(http.MethodGet, "/audit", q, nil, &entries)
+
+	return entries, err
+}
@@ -0,0 +1,80 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClient(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.Method + " " + r.URL.EscapedPath() {
+		case "PUT /objects/bob":
+			var v map[string]interface{}
+
+			json.NewDecoder(r.Body).Decode(&v)
+
+			if v["name"] == "Bob" {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			json.NewEncoder(w).Encode(&Revision{Version: 2})
+
+		case "GET /objects/bob/v/1":
+			json.NewEncoder(w).Encode(&Object{Key: "bob", Version: 1})
+
+		case "GET /keys":
+			json.NewEncoder(w).Encode([]string{"bob"})
+
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"code": "not_found", "message": "Object does not exist"}`))
+		}
+	}))
+
+	defer ts.Close()
+
+	c := New(ts.URL)
+
+	if _, err := c.Keys(); err == nil || err.(*Error).StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected unauthorized error, got %v", err)
+	}
+
+	c.Token = "secret"
+
+	r, err := c.Put("bob", map[string]interface{}{"name": "Bob Smith"})
+
+	if err != nil || r == nil || r.Version != 2 {
+		t.Errorf("expected revision 2, got %v (%v)", r, err)
+	}
+
+	// Unchanged.
+	if r, err = c.Put("bob", map[string]interface{}{"name": "Bob"}); err != nil || r != nil {
+		t.Errorf("expected no revision, got %v (%v)", r, err)
+	}
+
+	if o, err := c.GetVersion("bob", 1); err != nil || o.Version != 1 {
+		t.Errorf("expected version 1, got %v (%v)", o, err)
+	}
+
+	if o, err := c.Get("alice"); err != nil || o != nil {
+		t.Errorf("expected no object, got %v (%v)", o, err)
+	}
+
+	if keys, err := c.Keys(); err != nil || len(keys) != 1 {
+		t.Errorf("expected one key, got %v (%v)", keys, err)
+	}
+
+	_, err = c.Subscribers()
+
+	if !IsNotFound(err) || err.Error() != "Object does not exist" {
+		t.Errorf("expected not found error, got %v", err)
+	}
+}
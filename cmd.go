@@ -1,16 +1,23 @@
 package main
 
 import (
+	"bufio"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/blang/semver"
 	"github.com/spf13/viper"
 	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 	"gopkg.in/yaml.v2"
 )
 
@@ -53,20 +60,37 @@ func putCmd(args []string) {
 	}
 
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
 
 	cfg := GetConfig()
 
+	if rc := cfg.Remote.Client(); rc != nil {
+		remotePut(rc, args[0], val)
+		return
+	}
+
 	defer cfg.Mongo.Close()
 	o, err := Put(cfg, args[0], val)
 
+	e := AuditEntry{
+		Operation: OpPut,
+		Key:       args[0],
+	}
+
+	if o != nil {
+		e.Version = o.Version
+	}
+
+	auditCmd(cfg, &e, err)
+
 	if err != nil {
 		if x, ok := err.(ResultErrors); ok {
-			log.Fatalf("validation error\n%s", x)
+			log.Printf("validation error\n%s", x)
+			os.Exit(ExitValidation)
 		}
 
-		log.Fatal(err)
+		fatal(err)
 	}
 
 	if o == nil {
@@ -76,7 +100,7 @@ func putCmd(args []string) {
 	b, err := json.MarshalIndent(o, "", "  ")
 
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
 
 	fmt.Fprintf(os.Stdout, "%s\n", b)
@@ -110,26 +134,44 @@ func getCmd(args []string) {
 
 	cfg := GetConfig()
 
+	if rc := cfg.Remote.Client(); rc != nil {
+		remoteGet(rc, args[0], v, t, ts)
+		return
+	}
+
 	defer cfg.Mongo.Close()
 
 	o, err := get(cfg, args[0], true)
 
-	if err != nil {
-		log.Fatal(err)
+	if err == nil && o == nil {
+		err = NotFoundError("Object %s does not exist", args[0])
+	} else if err == nil {
+		if v > o.Version {
+			err = NotFoundError("Version %d of %s does not exist", v, args[0])
+		} else if v > 0 {
+			o = o.AtVersion(v)
+		} else if t > 0 {
+			o = o.AtTime(t)
+
+			if o == nil {
+				err = NotFoundError("Object %s did not exist at %s", args[0], ts)
+			}
+		}
 	}
 
-	if o == nil {
-		return
+	e := AuditEntry{
+		Operation: OpGet,
+		Key:       args[0],
 	}
 
-	if v > 0 {
-		o = o.AtVersion(v)
-	} else if t > 0 {
-		o = o.AtTime(t)
+	if err == nil {
+		e.Version = o.Version
 	}
 
-	if o == nil {
-		return
+	auditCmd(cfg, &e, err)
+
+	if err != nil {
+		fatal(err)
 	}
 
 	o.History = nil
@@ -137,7 +179,7 @@ func getCmd(args []string) {
 	b, err := json.MarshalIndent(o, "", "  ")
 
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
 
 	fmt.Fprintf(os.Stdout, "%s\n", b)
@@ -146,12 +188,19 @@ func getCmd(args []string) {
 func keysCmd(args []string) {
 	cfg := GetConfig()
 
+	if rc := cfg.Remote.Client(); rc != nil {
+		remoteKeys(rc)
+		return
+	}
+
 	defer cfg.Mongo.Close()
 
 	keys, err := Keys(cfg)
 
+	auditCmd(cfg, &AuditEntry{Operation: OpKeys}, err)
+
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
 
 	if len(keys) == 0 {
@@ -168,22 +217,86 @@ func logCmd(args []string) {
 
 	cfg := GetConfig()
 
+	if rc := cfg.Remote.Client(); rc != nil {
+		remoteLog(rc, args[0])
+		return
+	}
+
 	defer cfg.Mongo.Close()
 
 	l, err := Log(cfg, args[0])
 
+	if err == nil && l == nil {
+		err = NotFoundError("Object %s does not exist", args[0])
+	}
+
+	e := AuditEntry{
+		Operation: OpLog,
+		Key:       args[0],
+	}
+
+	if len(l) > 0 {
+		e.Version = l[len(l)-1].Version
+	}
+
+	auditCmd(cfg, &e, err)
+
+	if err != nil {
+		fatal(err)
+	}
+
+	b, err := json.MarshalIndent(l, "", "  ")
+
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
 
-	if l == nil {
+	fmt.Fprintf(os.Stdout, "%s\n", b)
+}
+
+func changesCmd(args []string) {
+	var (
+		since string
+		limit int
+	)
+
+	fs := flag.NewFlagSet("changes", flag.ExitOnError)
+
+	fs.StringVar(&since, "since", "", "Time or cursor to read changes after.")
+	fs.IntVar(&limit, "limit", defaultChangesLimit, "Maximum number of changes to return.")
+
+	fs.Parse(args)
+
+	c, err := ParseSince(since)
+
+	if err != nil {
+		fatal(err)
+	}
+
+	cfg := GetConfig()
+
+	if rc := cfg.Remote.Client(); rc != nil {
+		remoteChanges(rc, since, limit)
 		return
 	}
 
-	b, err := json.MarshalIndent(l, "", "  ")
+	defer cfg.Mongo.Close()
+
+	events, c, err := ChangesSince(cfg, c, limit)
+
+	auditCmd(cfg, &AuditEntry{Operation: OpChanges}, err)
+
+	if err != nil {
+		fatal(err)
+	}
+
+	b, err := json.MarshalIndent(map[string]interface{}{
+		"changes": events,
+		"cursor":  c.String(),
+	}, "", "  ")
 
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
 
 	fmt.Fprintf(os.Stdout, "%s\n", b)
@@ -194,6 +307,7 @@ func httpCmd(args []string) {
 
 	fs.String("host", "localhost", "Host to bind to.")
 	fs.Int("port", 5000, "Port to bind to.")
+	fs.String("public_url", "", "Base URL used in links.")
 
 	fs.Parse(args)
 
@@ -204,27 +318,112 @@ func httpCmd(args []string) {
 	cfg := GetConfig()
 
 	defer cfg.Mongo.Close()
+	defer cfg.SMTP.Close()
 
 	runHTTP(cfg)
 }
 
+func grpcCmd(args []string) {
+	fs := flag.NewFlagSet("grpc", flag.ExitOnError)
+
+	fs.String("host", viper.GetString("grpc.host"), "Host to bind to.")
+	fs.Int("port", viper.GetInt("grpc.port"), "Port to bind to.")
+
+	fs.Parse(args)
+
+	fs.Visit(func(f *flag.Flag) {
+		viper.Set(fmt.Sprintf("grpc.%s", f.Name), f.Value.(flag.Getter).Get())
+	})
+
+	cfg := GetConfig()
+
+	defer cfg.Mongo.Close()
+	defer cfg.SMTP.Close()
+
+	runGRPC(cfg)
+}
+
+func notifyWorkerCmd(args []string) {
+	fs := flag.NewFlagSet("notify-worker", flag.ExitOnError)
+
+	fs.Int("workers", viper.GetInt("notify.workers"), "Number of workers.")
+
+	fs.Parse(args)
+
+	fs.Visit(func(f *flag.Flag) {
+		viper.Set(fmt.Sprintf("notify.%s", f.Name), f.Value.(flag.Getter).Get())
+	})
+
+	cfg := GetConfig()
+
+	defer cfg.Mongo.Close()
+	defer cfg.SMTP.Close()
+
+	// Stop the workers on interrupt.
+	quit := make(chan struct{})
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-sig
+		close(quit)
+	}()
+
+	log.Printf("* [notify] Running %d workers", cfg.Notify.Workers)
+
+	RunWorkers(cfg, cfg.Notify.Workers, quit)
+}
+
 func configCmd(args []string) {
-	b, _ := yaml.Marshal(GetConfig())
+	b, _ := yaml.Marshal(GetConfig().Redacted())
 
 	fmt.Fprintf(os.Stdout, string(b))
 }
 
+// stringsFlag is a flag that can be specified multiple times.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
 func subscribeCmd(args []string) {
+	var s Subscription
+
+	fs := flag.NewFlagSet("subscribe", flag.ExitOnError)
+
+	fs.Var((*stringsFlag)(&s.Patterns), "pattern", "Key pattern to be notified about. May be repeated.")
+	fs.Var((*stringsFlag)(&s.Events), "event", "Event type (new or changed) to be notified about. May be repeated.")
+	fs.Var((*stringsFlag)(&s.Fields), "field", "Field path that must be affected by a change. May be repeated.")
+	fs.StringVar(&s.Digest, "digest", "", "Digest mode: hourly, daily, or quiet.")
+	fs.StringVar(&s.Quiet, "quiet", "", "Quiet period of the quiet digest mode.")
+
+	fs.Parse(args)
+
+	args = fs.Args()
+
 	if len(args) == 0 {
 		fmt.Fprintf(os.Stderr, "No emails provided.")
 	}
 
 	cfg := GetConfig()
 
-	subs, err := SubscribeEmail(cfg, args...)
+	if rc := cfg.Remote.Client(); rc != nil {
+		remoteSubscribe(rc, s, args)
+		return
+	}
+
+	subs, err := SubscribeEmailWith(cfg, s, args...)
+
+	auditCmd(cfg, &AuditEntry{Operation: OpSubscribe}, err)
 
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
 
 	if len(subs) == 1 {
@@ -241,10 +440,21 @@ func unsubscribeCmd(args []string) {
 
 	cfg := GetConfig()
 
+	if rc := cfg.Remote.Client(); rc != nil {
+		remoteUnsubscribe(rc, args)
+		return
+	}
+
 	n, err := UnsubscribeEmail(cfg, args...)
 
-	if err != nil && err != mgo.ErrNotFound {
-		log.Fatal(err)
+	if err == mgo.ErrNotFound {
+		err = nil
+	}
+
+	auditCmd(cfg, &AuditEntry{Operation: OpUnsubscribe}, err)
+
+	if err != nil {
+		fatal(err)
 	}
 
 	if n == 1 {
@@ -253,3 +463,565 @@ func unsubscribeCmd(args []string) {
 		fmt.Fprintf(os.Stdout, "Unsubscribed %d emails\n", n)
 	}
 }
+
+func webhookCmd(args []string) {
+	if len(args) == 0 {
+		PrintUsage("webhook")
+	}
+
+	switch args[0] {
+	case "add":
+		webhookAddCmd(args[1:])
+
+	case "remove":
+		webhookRemoveCmd(args[1:])
+
+	case "list":
+		webhookListCmd(args[1:])
+
+	case "log":
+		webhookLogCmd(args[1:])
+
+	default:
+		PrintUsage("webhook")
+	}
+}
+
+func webhookAddCmd(args []string) {
+	var secret string
+
+	fs := flag.NewFlagSet("webhook add", flag.ExitOnError)
+
+	fs.StringVar(&secret, "secret", "", "Secret used to sign payloads. One is generated if not provided.")
+
+	fs.Parse(args)
+
+	args = fs.Args()
+
+	if len(args) != 1 {
+		PrintUsage("webhook")
+	}
+
+	cfg := GetConfig()
+
+	if rc := cfg.Remote.Client(); rc != nil {
+		remoteWebhookAdd(rc, args[0], secret)
+		return
+	}
+
+	defer cfg.Mongo.Close()
+
+	w, err := AddWebhook(cfg, args[0], secret)
+
+	auditCmd(cfg, &AuditEntry{Operation: OpWebhookAdd}, err)
+
+	if err != nil {
+		fatal(err)
+	}
+
+	b, err := json.MarshalIndent(w, "", "  ")
+
+	if err != nil {
+		fatal(err)
+	}
+
+	fmt.Fprintf(os.Stdout, "%s\n", b)
+}
+
+func webhookRemoveCmd(args []string) {
+	if len(args) != 1 {
+		PrintUsage("webhook")
+	}
+
+	if !bson.IsObjectIdHex(args[0]) {
+		fatal(&Error{
+			Status:  http.StatusBadRequest,
+			Code:    CodeInvalidParameter,
+			Message: fmt.Sprintf("Invalid webhook id: %s", args[0]),
+		})
+	}
+
+	cfg := GetConfig()
+
+	if rc := cfg.Remote.Client(); rc != nil {
+		remoteWebhookRemove(rc, args[0])
+		return
+	}
+
+	defer cfg.Mongo.Close()
+
+	ok, err := RemoveWebhook(cfg, bson.ObjectIdHex(args[0]))
+
+	auditCmd(cfg, &AuditEntry{Operation: OpWebhookRemove}, err)
+
+	if err != nil {
+		fatal(err)
+	}
+
+	if ok {
+		fmt.Fprintln(os.Stdout, "Removed 1 webhook")
+	} else {
+		fmt.Fprintln(os.Stdout, "Removed 0 webhooks")
+	}
+}
+
+func webhookListCmd(args []string) {
+	cfg := GetConfig()
+
+	if rc := cfg.Remote.Client(); rc != nil {
+		remoteWebhookList(rc)
+		return
+	}
+
+	defer cfg.Mongo.Close()
+
+	hooks, err := AllWebhooks(cfg)
+
+	auditCmd(cfg, &AuditEntry{Operation: OpWebhooks}, err)
+
+	if err != nil {
+		fatal(err)
+	}
+
+	for _, w := range hooks {
+		fmt.Fprintf(os.Stdout, "%s\t%s\n", w.ID.Hex(), w.URL)
+	}
+}
+
+func webhookLogCmd(args []string) {
+	var limit int
+
+	fs := flag.NewFlagSet("webhook log", flag.ExitOnError)
+
+	fs.IntVar(&limit, "limit", 20, "Maximum number of deliveries to return.")
+
+	fs.Parse(args)
+
+	args = fs.Args()
+
+	if len(args) != 1 {
+		PrintUsage("webhook")
+	}
+
+	if !bson.IsObjectIdHex(args[0]) {
+		fatal(&Error{
+			Status:  http.StatusBadRequest,
+			Code:    CodeInvalidParameter,
+			Message: fmt.Sprintf("Invalid webhook id: %s", args[0]),
+		})
+	}
+
+	cfg := GetConfig()
+
+	if rc := cfg.Remote.Client(); rc != nil {
+		remoteWebhookLog(rc, args[0], limit)
+		return
+	}
+
+	defer cfg.Mongo.Close()
+
+	ds, err := Deliveries(cfg, bson.ObjectIdHex(args[0]), limit)
+
+	auditCmd(cfg, &AuditEntry{Operation: OpWebhookLog}, err)
+
+	if err != nil {
+		fatal(err)
+	}
+
+	b, err := json.MarshalIndent(ds, "", "  ")
+
+	if err != nil {
+		fatal(err)
+	}
+
+	fmt.Fprintf(os.Stdout, "%s\n", b)
+}
+
+func tokenCmd(args []string) {
+	if len(args) == 0 {
+		PrintUsage("token")
+	}
+
+	switch args[0] {
+	case "create":
+		tokenCreateCmd(args[1:])
+
+	case "list":
+		tokenListCmd(args[1:])
+
+	case "revoke":
+		tokenRevokeCmd(args[1:])
+
+	case "hash":
+		tokenHashCmd(args[1:])
+
+	default:
+		PrintUsage("token")
+	}
+}
+
+func tokenCreateCmd(args []string) {
+	if len(args) != 1 {
+		PrintUsage("token")
+	}
+
+	cfg := GetConfig()
+
+	defer cfg.Mongo.Close()
+
+	token, err := CreateToken(cfg, args[0])
+
+	auditCmd(cfg, &AuditEntry{Operation: OpTokenCreate}, err)
+
+	if err != nil {
+		fatal(err)
+	}
+
+	fmt.Fprintln(os.Stdout, token)
+}
+
+func tokenListCmd(args []string) {
+	cfg := GetConfig()
+
+	defer cfg.Mongo.Close()
+
+	tokens, err := AllTokens(cfg)
+
+	if err != nil {
+		fatal(err)
+	}
+
+	for _, t := range tokens {
+		fmt.Fprintf(os.Stdout, "%s\t%s\n", t.Name, t.Time.Format(time.RFC3339))
+	}
+}
+
+func tokenRevokeCmd(args []string) {
+	if len(args) != 1 {
+		PrintUsage("token")
+	}
+
+	cfg := GetConfig()
+
+	defer cfg.Mongo.Close()
+
+	n, err := RevokeToken(cfg, args[0])
+
+	auditCmd(cfg, &AuditEntry{Operation: OpTokenRevoke}, err)
+
+	if err != nil {
+		fatal(err)
+	}
+
+	if n == 1 {
+		fmt.Fprintln(os.Stdout, "Revoked 1 token")
+	} else {
+		fmt.Fprintf(os.Stdout, "Revoked %d tokens\n", n)
+	}
+}
+
+func tokenHashCmd(args []string) {
+	// Read the password from stdin to keep it out of the shell history.
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+
+	if err != nil && err != io.EOF {
+		fatal(err)
+	}
+
+	password = strings.TrimRight(password, "\r\n")
+
+	if password == "" {
+		log.Fatal("no password provided")
+	}
+
+	hash, err := HashPassword(password)
+
+	if err != nil {
+		fatal(err)
+	}
+
+	fmt.Fprintln(os.Stdout, hash)
+}
+
+func auditLogCmd(args []string) {
+	var (
+		since string
+		q     AuditQuery
+	)
+
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+
+	fs.StringVar(&q.Identity, "identity", "", "Identity that performed the operations.")
+	fs.StringVar(&q.Operation, "op", "", "Operation, e.g. get or put.")
+	fs.StringVar(&q.Key, "key", "", "Key the operations were performed on.")
+	fs.StringVar(&since, "since", "", "Time (or duration relative to now) to read entries after.")
+	fs.IntVar(&q.Limit, "limit", defaultAuditLimit, "Maximum number of entries to return.")
+
+	fs.Parse(args)
+
+	if since != "" {
+		c, err := ParseSince(since)
+
+		if err != nil {
+			fatal(err)
+		}
+
+		q.Since = time.Unix(c.Time, 0)
+	}
+
+	cfg := GetConfig()
+
+	if rc := cfg.Remote.Client(); rc != nil {
+		remoteAudit(rc, q, since)
+		return
+	}
+
+	defer cfg.Mongo.Close()
+
+	entries, err := QueryAudit(cfg, q)
+
+	auditCmd(cfg, &AuditEntry{Operation: OpAudit}, err)
+
+	if err != nil {
+		fatal(err)
+	}
+
+	b, err := json.MarshalIndent(entries, "", "  ")
+
+	if err != nil {
+		fatal(err)
+	}
+
+	fmt.Fprintf(os.Stdout, "%s\n", b)
+}
+
+func rekeyCmd(args []string) {
+	fs := flag.NewFlagSet("rekey", flag.ExitOnError)
+	fs.Parse(args)
+
+	cfg := GetConfig()
+
+	defer cfg.Mongo.Close()
+
+	res, err := Rekey(cfg)
+
+	auditCmd(cfg, &AuditEntry{Operation: OpRekey}, err)
+
+	if err != nil {
+		fatal(err)
+	}
+
+	fmt.Fprintf(os.Stdout, "Re-encrypted %d objects with key %s\n", res.Objects, cfg.Encryption.keys.Active())
+
+	if res.SkippedJobs > 0 {
+		fmt.Fprintf(os.Stderr, "Skipped %d notifications that could not be decrypted\n", res.SkippedJobs)
+	}
+
+	if len(res.Skipped) > 0 {
+		fmt.Fprintf(os.Stderr, "Objects modified during the rekey, run it again:\n%s\n", strings.Join(res.Skipped, "\n"))
+		os.Exit(ExitConflict)
+	}
+}
+
+func exportCmd(args []string) {
+	var out string
+
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+
+	fs.StringVar(&out, "o", "", "File to write the export to.")
+
+	fs.Parse(args)
+
+	w := os.Stdout
+
+	if out != "" {
+		f, err := os.Create(out)
+
+		if err != nil {
+			fatal(err)
+		}
+
+		defer f.Close()
+
+		w = f
+	}
+
+	cfg := GetConfig()
+
+	defer cfg.Mongo.Close()
+
+	bw := bufio.NewWriter(w)
+
+	res, err := Export(cfg, bw)
+
+	if err == nil {
+		err = bw.Flush()
+	}
+
+	auditCmd(cfg, &AuditEntry{Operation: OpExport}, err)
+
+	if err != nil {
+		fatal(err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Exported %d objects and %d subscribers\n", res.Objects, res.Subscribers)
+}
+
+func importCmd(args []string) {
+	var merge, check bool
+
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+
+	fs.BoolVar(&merge, "merge", false, "Merge into a store that has objects.")
+	fs.BoolVar(&check, "check", false, "Only validate the export.")
+
+	fs.Parse(args)
+
+	args = fs.Args()
+
+	if len(args) > 1 {
+		PrintUsage("import")
+	}
+
+	r := os.Stdin
+
+	if len(args) == 1 {
+		f, err := os.Open(args[0])
+
+		if err != nil {
+			fatal(err)
+		}
+
+		defer f.Close()
+
+		r = f
+	}
+
+	cfg := GetConfig()
+
+	defer cfg.Mongo.Close()
+
+	res, err := Import(cfg, r, merge, check)
+
+	if !check {
+		auditCmd(cfg, &AuditEntry{Operation: OpImport}, err)
+	}
+
+	if err != nil {
+		if res != nil && res.Objects > 0 && !check {
+			fmt.Fprintf(os.Stderr, "Imported %d objects before the error\n", res.Objects)
+		}
+
+		fatal(err)
+	}
+
+	if check {
+		fmt.Fprintf(os.Stdout, "Export is valid with %d objects and %d subscribers\n", res.Objects, res.Subscribers)
+		return
+	}
+
+	fmt.Fprintf(os.Stdout, "Imported %d objects and %d subscribers, %d objects unchanged, %d conflicts\n", res.Objects, res.Subscribers, res.Unchanged, len(res.Conflicts))
+
+	if len(res.Conflicts) > 0 {
+		fmt.Fprintf(os.Stderr, "Objects with a different history:\n%s\n", strings.Join(res.Conflicts, "\n"))
+		os.Exit(ExitConflict)
+	}
+}
+
+func loadCmd(args []string) {
+	var (
+		file    string
+		keyCol  string
+		keyTmpl string
+		columns string
+		infer   bool
+	)
+
+	fs := flag.NewFlagSet("load", flag.ExitOnError)
+
+	fs.StringVar(&file, "csv", "", "CSV file to load.")
+	fs.StringVar(&keyCol, "key-column", "", "Column of the key.")
+	fs.StringVar(&keyTmpl, "key-template", "", "Template of the key, e.g. patients.{mrn}.")
+	fs.StringVar(&columns, "columns", "", "Comma-separated list of columns to include.")
+	fs.BoolVar(&infer, "infer", false, "Infer numbers, booleans, and nulls.")
+
+	fs.Parse(args)
+
+	if file == "" || (keyCol == "" && keyTmpl == "") {
+		PrintUsage("load")
+	}
+
+	opts := LoadOptions{
+		KeyTemplate: keyTmpl,
+		Infer:       infer,
+	}
+
+	if opts.KeyTemplate == "" {
+		opts.KeyTemplate = fmt.Sprintf("{%s}", keyCol)
+	}
+
+	if columns != "" {
+		opts.Columns = strings.Split(columns, ",")
+	}
+
+	f, err := os.Open(file)
+
+	if err != nil {
+		fatal(err)
+	}
+
+	defer f.Close()
+
+	cfg := GetConfig()
+
+	var put loadPut
+
+	if rc := cfg.Remote.Client(); rc != nil {
+		put = func(key string, val map[string]interface{}) (int, error) {
+			r, err := rc.Put(key, val)
+
+			if r == nil {
+				return 0, err
+			}
+
+			return r.Version, err
+		}
+	} else {
+		defer cfg.Mongo.Close()
+
+		put = func(key string, val map[string]interface{}) (int, error) {
+			r, err := Put(cfg, key, val)
+
+			e := AuditEntry{
+				Operation: OpPut,
+				Key:       key,
+			}
+
+			if r != nil {
+				e.Version = r.Version
+			}
+
+			auditCmd(cfg, &e, err)
+
+			if r == nil {
+				return 0, err
+			}
+
+			return r.Version, err
+		}
+	}
+
+	res, err := LoadCSV(f, &opts, put, func(row int, key string, err error) {
+		log.Printf("row %d %s: %s", row, key, err)
+	})
+
+	if err != nil {
+		fatal(err)
+	}
+
+	fmt.Fprintf(os.Stdout, "%d new, %d changed, %d unchanged, %d invalid\n", res.New, res.Changed, res.Unchanged, res.Invalid)
+
+	if res.Invalid > 0 {
+		os.Exit(ExitValidation)
+	}
+}
@@ -1,12 +1,20 @@
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"net"
 	"net/smtp"
+	"net/url"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/chop-dbhi/scds/client"
 	"github.com/spf13/viper"
 	"gopkg.in/mgo.v2"
 )
@@ -14,6 +22,13 @@ import (
 const (
 	mongoObjects     = "objects"
 	mongoSubscribers = "subcribers"
+	mongoWebhooks    = "webhooks"
+	mongoDeliveries  = "deliveries"
+
+	mongoNotifications = "notifications"
+	mongoTokens        = "tokens"
+	mongoCounters      = "counters"
+	mongoAudit         = "audit"
 )
 
 // Safety mode of the MongoDB instance.
@@ -44,9 +59,28 @@ func InitConfig() {
 		"port": 5000,
 	})
 
-	viper.SetDefault("smtp", map[string]interface{}{
+	viper.SetDefault("grpc", map[string]interface{}{
 		"host": "localhost",
-		"port": 25,
+		"port": 5001,
+	})
+
+	viper.SetDefault("smtp", map[string]interface{}{
+		"host":  "localhost",
+		"port":  25,
+		"conns": 2,
+		"idle":  "30s",
+	})
+
+	viper.SetDefault("webhooks", map[string]interface{}{
+		"timeout": "10s",
+	})
+
+	viper.SetDefault("notify", map[string]interface{}{
+		"workers": 2,
+		"retries": 5,
+		"backoff": "30s",
+		"poll":    "5s",
+		"quiet":   "15m",
 	})
 
 	// Read the default config file from the working directory.
@@ -111,7 +145,85 @@ func GetConfig() *Config {
 		schemas = append(schemas, &s)
 	}
 
-	return &Config{
+	// Parse email template overrides.
+	templates := make(map[string]*EmailTemplateConfig)
+
+	for _, name := range []string{templateNew, templateChanged, templateDigest, templateConfirm} {
+		t := EmailTemplateConfig{
+			Subject: viper.GetString(fmt.Sprintf("email.templates.%s.subject", name)),
+			Text:    viper.GetString(fmt.Sprintf("email.templates.%s.text", name)),
+			HTML:    viper.GetString(fmt.Sprintf("email.templates.%s.html", name)),
+		}
+
+		if t.Subject == "" && t.Text == "" && t.HTML == "" {
+			continue
+		}
+
+		if err := t.Load(name); err != nil {
+			log.Fatalf("email template %s: %s", name, err)
+		}
+
+		templates[name] = &t
+	}
+
+	auth := AuthConfig{
+		Enabled: viper.GetBool("auth.enabled"),
+		Tokens:  viper.GetStringMapString("auth.tokens"),
+		Users:   viper.GetStringMapString("auth.users"),
+
+		JWT: JWTConfig{
+			Key:      viper.GetString("auth.jwt.key"),
+			KeyFile:  viper.GetString("auth.jwt.keyfile"),
+			Issuer:   viper.GetString("auth.jwt.issuer"),
+			Audience: viper.GetString("auth.jwt.audience"),
+		},
+	}
+
+	if err := auth.JWT.Load(); err != nil {
+		log.Fatalf("auth jwt: %s", err)
+	}
+
+	if err := viper.UnmarshalKey("auth.roles", &auth.Roles); err != nil {
+		log.Fatalf("auth roles: %s", err)
+	}
+
+	for name, r := range auth.Roles {
+		if err := r.Validate(); err != nil {
+			log.Fatalf("auth role %s: %s", name, err)
+		}
+	}
+
+	if err := viper.UnmarshalKey("auth.identities", &auth.Identities); err != nil {
+		log.Fatalf("auth identities: %s", err)
+	}
+
+	if err := viper.UnmarshalKey("auth.subjects", &auth.Subjects); err != nil {
+		log.Fatalf("auth subjects: %s", err)
+	}
+
+	enc := EncryptionConfig{
+		KeyFile:    viper.GetString("encryption.keyfile"),
+		Fields:     viper.GetStringSlice("encryption.fields"),
+		HashSecret: viper.GetString("encryption.hash_secret"),
+	}
+
+	if err := enc.Load(); err != nil {
+		log.Fatalf("encryption: %s", err)
+	}
+
+	var redact RedactConfig
+
+	if err := viper.UnmarshalKey("redact.rules", &redact.Rules); err != nil {
+		log.Fatalf("redact rules: %s", err)
+	}
+
+	for i, r := range redact.Rules {
+		if err := r.Validate(); err != nil {
+			log.Fatalf("redact rule %d: %s", i+1, err)
+		}
+	}
+
+	cfg := &Config{
 		Debug:  viper.GetBool("debug"),
 		Config: viper.GetString("config"),
 
@@ -125,6 +237,18 @@ func GetConfig() *Config {
 			CORS:    viper.GetBool("http.cors"),
 			TLSCert: viper.GetString("http.tlscert"),
 			TLSKey:  viper.GetString("http.tlskey"),
+
+			PublicURL: viper.GetString("http.public_url"),
+
+			ClientCA:   viper.GetString("http.client_ca"),
+			ClientAuth: viper.GetString("http.client_auth"),
+		},
+
+		GRPC: GRPCConfig{
+			Host:    viper.GetString("grpc.host"),
+			Port:    viper.GetInt("grpc.port"),
+			TLSCert: viper.GetString("grpc.tlscert"),
+			TLSKey:  viper.GetString("grpc.tlskey"),
 		},
 
 		SMTP: SMTPConfig{
@@ -133,10 +257,47 @@ func GetConfig() *Config {
 			User:     viper.GetString("smtp.user"),
 			Password: viper.GetString("smtp.password"),
 			From:     viper.GetString("smtp.from"),
+			TLS:      viper.GetString("smtp.tls"),
+			CA:       viper.GetString("smtp.ca"),
+			Insecure: viper.GetBool("smtp.insecure"),
+			Conns:    viper.GetInt("smtp.conns"),
+			Idle:     viper.GetDuration("smtp.idle"),
+		},
+
+		Email: EmailConfig{
+			Templates: templates,
+		},
+
+		Webhooks: WebhooksConfig{
+			Timeout: viper.GetDuration("webhooks.timeout"),
+		},
+
+		Auth: auth,
+
+		Encryption: enc,
+		Redact:     redact,
+
+		Notify: NotifyConfig{
+			Workers: viper.GetInt("notify.workers"),
+			Retries: viper.GetInt("notify.retries"),
+			Backoff: viper.GetDuration("notify.backoff"),
+			Poll:    viper.GetDuration("notify.poll"),
+			Quiet:   viper.GetDuration("notify.quiet"),
+		},
+
+		Remote: RemoteConfig{
+			URL:      viper.GetString("remote.url"),
+			Token:    viper.GetString("remote.token"),
+			User:     viper.GetString("remote.user"),
+			Password: viper.GetString("remote.password"),
 		},
 
 		Schemas: schemas,
 	}
+
+	cfg.SMTP.pool = newSMTPPool(&cfg.SMTP)
+
+	return cfg
 }
 
 // SMTPConfig defines configuration fields for communicating with an SMTP server.
@@ -148,7 +309,23 @@ type SMTPConfig struct {
 	Password string
 	From     string
 
-	client *smtp.Client
+	// TLS mode: starttls, tls (implicit), or none. By default, STARTTLS
+	// is used if the server supports it.
+	TLS string
+
+	// Path to a PEM bundle of CA certificates used to verify the server.
+	// If not set, the system CAs are used.
+	CA string
+
+	// Skip verification of the server certificate.
+	Insecure bool
+
+	// Maximum number of idle connections kept open and how long they
+	// are kept open.
+	Conns int
+	Idle  time.Duration
+
+	pool *smtpPool
 }
 
 // Addr returns the address of the SMTP host.
@@ -162,7 +339,33 @@ func (s *SMTPConfig) Auth() smtp.Auth {
 		return nil
 	}
 
-	return smtp.PlainAuth("", s.User, s.Password, s.Addr())
+	return smtp.PlainAuth("", s.User, s.Password, s.Host)
+}
+
+// WebhooksConfig defines configuration fields for delivering webhooks.
+type WebhooksConfig struct {
+	// Timeout of each delivery request.
+	Timeout time.Duration
+}
+
+// NotifyConfig defines configuration fields for the notification queue.
+type NotifyConfig struct {
+	// Number of workers the HTTP server runs to deliver notifications.
+	Workers int
+
+	// Number of times a failed delivery is retried before the
+	// notification is dead-lettered.
+	Retries int
+
+	// Delay before the first retry. The delay doubles for each
+	// subsequent retry.
+	Backoff time.Duration
+
+	// Interval workers check the queue for due notifications.
+	Poll time.Duration
+
+	// Default quiet period of subscribers using the quiet digest mode.
+	Quiet time.Duration
 }
 
 // HTTPConfig defines configuration fields running the HTTP service.
@@ -172,6 +375,15 @@ type HTTPConfig struct {
 	CORS    bool
 	TLSCert string
 	TLSKey  string
+
+	// Base URL clients use to reach the service, such as the URL of a
+	// reverse proxy. Used for building links.
+	PublicURL string
+
+	// Path to a PEM bundle of CA certificates client certificates are
+	// verified against. ClientAuth is require (default) or optional.
+	ClientCA   string
+	ClientAuth string
 }
 
 // Addr returns the HTTP address of the SCDS service.
@@ -179,6 +391,123 @@ func (s *HTTPConfig) Addr() string {
 	return fmt.Sprintf("%s:%d", s.Host, s.Port)
 }
 
+// GRPCConfig defines configuration fields running the gRPC service.
+type GRPCConfig struct {
+	Host    string
+	Port    int
+	TLSCert string
+	TLSKey  string
+}
+
+// Addr returns the gRPC address of the SCDS service.
+func (s *GRPCConfig) Addr() string {
+	return fmt.Sprintf("%s:%d", s.Host, s.Port)
+}
+
+// TLSConfig returns the TLS configuration of the server including the
+// verification of client certificates.
+func (s *HTTPConfig) TLSConfig() (*tls.Config, error) {
+	if s.TLSCert == "" || s.TLSKey == "" {
+		return nil, errors.New("Client certificates require http.tlscert and http.tlskey")
+	}
+
+	cert, err := tls.LoadX509KeyPair(s.TLSCert, s.TLSKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	t := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"http/1.1"},
+	}
+
+	switch s.ClientAuth {
+	case "", "require":
+		t.ClientAuth = tls.RequireAndVerifyClientCert
+
+	case "optional":
+		t.ClientAuth = tls.VerifyClientCertIfGiven
+
+	default:
+		return nil, fmt.Errorf("Unknown client auth mode: %s", s.ClientAuth)
+	}
+
+	b, err := ioutil.ReadFile(s.ClientCA)
+
+	if err != nil {
+		return nil, err
+	}
+
+	t.ClientCAs = x509.NewCertPool()
+
+	if !t.ClientCAs.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("No certificates found in %s", s.ClientCA)
+	}
+
+	return t, nil
+}
+
+// Listener returns a TLS listener that verifies client certificates.
+func (s *HTTPConfig) Listener() (net.Listener, error) {
+	t, err := s.TLSConfig()
+
+	if err != nil {
+		return nil, err
+	}
+
+	ln, err := net.Listen("tcp", s.Addr())
+
+	if err != nil {
+		return nil, err
+	}
+
+	return tls.NewListener(ln, t), nil
+}
+
+// URL returns the absolute URL of the path. If the public URL is not set,
+// it is derived from the bind address.
+func (s *HTTPConfig) URL(path string) string {
+	base := s.PublicURL
+
+	if base == "" {
+		scheme := "http"
+
+		if s.TLSKey != "" {
+			scheme = "https"
+		}
+
+		base = fmt.Sprintf("%s://%s", scheme, s.Addr())
+	}
+
+	return strings.TrimRight(base, "/") + path
+}
+
+// ObjectURL returns the URL of the object.
+func (s *HTTPConfig) ObjectURL(key string) string {
+	return s.URL(fmt.Sprintf("/objects/%s", key))
+}
+
+// VersionURL returns the URL of the object at the version.
+func (s *HTTPConfig) VersionURL(key string, version int) string {
+	return s.URL(fmt.Sprintf("/objects/%s/v/%d", key, version))
+}
+
+// LogURL returns the URL of the log of the object.
+func (s *HTTPConfig) LogURL(key string) string {
+	return s.URL(fmt.Sprintf("/log/%s", key))
+}
+
+// ConfirmURL returns the URL a subscriber confirms their subscription with.
+func (s *HTTPConfig) ConfirmURL(token string) string {
+	return s.URL(fmt.Sprintf("/confirm/%s", token))
+}
+
+// UnsubscribeURL returns the one-click URL a subscriber unsubscribes with.
+func (s *HTTPConfig) UnsubscribeURL(token string) string {
+	return s.URL(fmt.Sprintf("/unsubscribe/%s", token))
+}
+
 // MongoConfig defines configuration fields for connecting to a MongoDB server.
 type MongoConfig struct {
 	URI string
@@ -205,10 +534,63 @@ func (c *MongoConfig) Session() *mgo.Session {
 			log.Fatal(err)
 		}
 
+		// Supports reading the change feed.
+		if err = session.DB("").C(mongoObjects).EnsureIndexKey("history.time"); err != nil {
+			log.Fatal(err)
+		}
+
+		if err = session.DB("").C(mongoObjects).EnsureIndexKey("history.seq"); err != nil {
+			log.Fatal(err)
+		}
+
+		// Supports finding revisions to sequence.
+		err = session.DB("").C(mongoObjects).EnsureIndex(mgo.Index{
+			Key:    []string{"unsequenced"},
+			Sparse: true,
+		})
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if err = sequenceRevisions(session.DB("")); err != nil {
+			log.Fatal(err)
+		}
+
 		if err = session.DB("").C(mongoSubscribers).EnsureIndexKey("email"); err != nil {
 			log.Fatal(err)
 		}
 
+		// Supports confirming and unsubscribing by token.
+		if err = session.DB("").C(mongoSubscribers).EnsureIndexKey("token"); err != nil {
+			log.Fatal(err)
+		}
+
+		if err = session.DB("").C(mongoDeliveries).EnsureIndexKey("webhook", "-time"); err != nil {
+			log.Fatal(err)
+		}
+
+		if err = session.DB("").C(mongoNotifications).EnsureIndexKey("status", "next"); err != nil {
+			log.Fatal(err)
+		}
+
+		if err = session.DB("").C(mongoTokens).EnsureIndexKey("hash"); err != nil {
+			log.Fatal(err)
+		}
+
+		// Supports querying the audit log by identity and key.
+		if err = session.DB("").C(mongoAudit).EnsureIndexKey("-time"); err != nil {
+			log.Fatal(err)
+		}
+
+		if err = session.DB("").C(mongoAudit).EnsureIndexKey("identity", "-time"); err != nil {
+			log.Fatal(err)
+		}
+
+		if err = session.DB("").C(mongoAudit).EnsureIndexKey("key", "-time"); err != nil {
+			log.Fatal(err)
+		}
+
 		c.mongoSession = session
 	}
 
@@ -232,12 +614,118 @@ func (c *MongoConfig) Subscribers() *mgo.Collection {
 	return c.Session().DB("").C(mongoSubscribers)
 }
 
+// Webhooks returns the webhooks collection.
+func (c *MongoConfig) Webhooks() *mgo.Collection {
+	return c.Session().DB("").C(mongoWebhooks)
+}
+
+// Deliveries returns the webhook delivery log collection.
+func (c *MongoConfig) Deliveries() *mgo.Collection {
+	return c.Session().DB("").C(mongoDeliveries)
+}
+
+// Notifications returns the notification queue collection.
+func (c *MongoConfig) Notifications() *mgo.Collection {
+	return c.Session().DB("").C(mongoNotifications)
+}
+
+// Audit returns the audit log collection.
+func (c *MongoConfig) Audit() *mgo.Collection {
+	return c.Session().DB("").C(mongoAudit)
+}
+
+// Tokens returns the API tokens collection.
+func (c *MongoConfig) Tokens() *mgo.Collection {
+	return c.Session().DB("").C(mongoTokens)
+}
+
+// RemoteConfig defines the SCDS HTTP server commands are sent to instead of
+// connecting to MongoDB.
+type RemoteConfig struct {
+	URL      string
+	Token    string
+	User     string
+	Password string
+}
+
+// Client returns a client of the remote server or nil if no server is set.
+func (c *RemoteConfig) Client() *client.Client {
+	if c.URL == "" {
+		return nil
+	}
+
+	rc := client.New(c.URL)
+
+	rc.Token = c.Token
+	rc.User = c.User
+	rc.Password = c.Password
+
+	return rc
+}
+
 // Config contains all configuration options.
 type Config struct {
-	Debug   bool
-	Config  string
-	Mongo   MongoConfig
-	HTTP    HTTPConfig
-	SMTP    SMTPConfig
-	Schemas []*Schema
+	Debug    bool
+	Config   string
+	Mongo    MongoConfig
+	HTTP     HTTPConfig
+	GRPC     GRPCConfig
+	SMTP     SMTPConfig
+	Email    EmailConfig
+	Webhooks WebhooksConfig
+	Notify   NotifyConfig
+	Auth     AuthConfig
+	Remote   RemoteConfig
+	Schemas  []*Schema
+
+	Encryption EncryptionConfig
+	Redact     RedactConfig
+
+	broker *Broker
+}
+
+// Value of secrets in the redacted configuration.
+const redactedSecret = "<redacted>"
+
+// redactSecret returns the redacted value of a secret or an empty string if
+// it is not set.
+func redactSecret(s string) string {
+	if s == "" {
+		return ""
+	}
+
+	return redactedSecret
+}
+
+// Redacted returns a copy of the configuration that can be printed. Tokens,
+// passwords, keys, and the credentials in the MongoDB URI are redacted.
+func (c *Config) Redacted() *Config {
+	r := *c
+
+	r.Auth.Tokens = make(map[string]string, len(c.Auth.Tokens))
+
+	for name, token := range c.Auth.Tokens {
+		r.Auth.Tokens[name] = redactSecret(token)
+	}
+
+	r.Auth.Users = make(map[string]string, len(c.Auth.Users))
+
+	for name, hash := range c.Auth.Users {
+		r.Auth.Users[name] = redactSecret(hash)
+	}
+
+	r.Auth.JWT.Key = redactSecret(c.Auth.JWT.Key)
+	r.Encryption.HashSecret = redactSecret(c.Encryption.HashSecret)
+	r.SMTP.Password = redactSecret(c.SMTP.Password)
+	r.Remote.Token = redactSecret(c.Remote.Token)
+	r.Remote.Password = redactSecret(c.Remote.Password)
+
+	if u, err := url.Parse(c.Mongo.URI); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redactedSecret)
+			r.Mongo.URI = u.String()
+		}
+	}
+
+	return &r
 }
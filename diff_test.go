@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"reflect"
 	"testing"
 )
@@ -88,3 +89,58 @@ func TestChange(t *testing.T) {
 		t.Errorf("failed to change: %v", r.Changes)
 	}
 }
+
+func TestContentHash(t *testing.T) {
+	var a, b map[string]interface{}
+
+	json.Unmarshal([]byte(`{"name": "Bob", "tags": ["a", "b"], "address": {"zip": 19104, "city": "Philadelphia"}}`), &a)
+	json.Unmarshal([]byte(`{"address":{"city":"Philadelphia","zip":19104},"tags":["a","b"],"name":"Bob"}`), &b)
+
+	ha, err := ContentHash(a)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hb, _ := ContentHash(b); ha != hb {
+		t.Errorf("expected equal hashes, got %s and %s", ha, hb)
+	}
+
+	b["name"] = "Bob Smith"
+
+	if hb, _ := ContentHash(b); ha == hb {
+		t.Error("expected hashes to differ")
+	}
+}
+
+func TestKeyedContentHash(t *testing.T) {
+	v := map[string]interface{}{"ssn": "123-45-6789"}
+
+	plain, _ := ContentHash(v)
+
+	a := EncryptionConfig{HashSecret: "a"}
+	b := EncryptionConfig{HashSecret: "b"}
+
+	ha, err := a.ContentHash(v)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ha == plain {
+		t.Error("expected keyed hash to differ from unkeyed hash")
+	}
+
+	if hb, _ := b.ContentHash(v); ha == hb {
+		t.Error("expected hashes with different secrets to differ")
+	}
+
+	if h, _ := (&EncryptionConfig{}).ContentHash(v); h != plain {
+		t.Error("expected unkeyed hash without a secret")
+	}
+
+	// Encryption requires a secret.
+	if err = (&EncryptionConfig{KeyFile: "keys"}).Load(); err == nil {
+		t.Error("expected error without a hash secret")
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jordan-wright/email"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Digest modes of subscribers.
+const (
+	DigestHourly = "hourly"
+	DigestDaily  = "daily"
+	DigestQuiet  = "quiet"
+)
+
+// Maximum number of lines of each diff included in a digest.
+const digestDiffLines = 10
+
+// DigestContext is the template context for digest email bodies.
+type DigestContext struct {
+	Start time.Time
+	End   time.Time
+	Items []EmailContext
+
+	// One-click URL to unsubscribe the recipient.
+	UnsubscribeURL string
+}
+
+// abbreviate truncates the string to n lines.
+func abbreviate(s string, n int) string {
+	lines := strings.SplitAfter(s, "\n")
+
+	if len(lines) <= n+1 {
+		return s
+	}
+
+	return strings.Join(lines[:n], "") + "...\n"
+}
+
+// digestDue returns true if the held notifications of the subscriber should
+// be sent. Hourly and daily digests are sent once the oldest notification
+// reaches the age of the period. Quiet digests are sent once no changes have
+// occurred for the quiet period.
+func digestDue(cfg *Config, sub *Subscriber, first, last, now time.Time) bool {
+	switch sub.Digest {
+	case DigestHourly:
+		return !now.Before(first.Add(time.Hour))
+
+	case DigestDaily:
+		return !now.Before(first.Add(24 * time.Hour))
+
+	case DigestQuiet:
+		quiet := cfg.Notify.Quiet
+
+		if sub.Quiet != "" {
+			quiet, _ = time.ParseDuration(sub.Quiet)
+		}
+
+		return !now.Before(last.Add(quiet))
+	}
+
+	// Digest mode was removed, send what is held.
+	return true
+}
+
+func digestEmail(cfg *Config, sub *Subscriber, jobs []*Job) (*email.Email, error) {
+	cxt := DigestContext{
+		Start: jobs[0].Time.Local(),
+		End:   jobs[len(jobs)-1].Time.Local(),
+		Items: make([]EmailContext, len(jobs)),
+
+		UnsubscribeURL: cfg.HTTP.UnsubscribeURL(sub.Token),
+	}
+
+	fields := cfg.Redact.ChannelFields(ChannelDigest)
+
+	for i, j := range jobs {
+		item := revisionContext(cfg, j.Key, redactRevision(j.Revision, fields))
+
+		item.Changes = abbreviate(item.Changes, digestDiffLines)
+		item.Additions = abbreviate(item.Additions, digestDiffLines)
+		item.Removals = abbreviate(item.Removals, digestDiffLines)
+
+		cxt.Items[i] = item
+	}
+
+	return cfg.Email.Template(templateDigest).Execute(&cxt)
+}
+
+// claimDigest leases the digest of the subscriber so only one worker sends
+// it. Leases of workers that did not finish expire. Returns false if another
+// worker holds the lease.
+func claimDigest(cfg *Config, sub *Subscriber, now time.Time) (bool, error) {
+	err := cfg.Mongo.Subscribers().Update(bson.M{
+		"_id": sub.ID,
+		"$or": []bson.M{
+			{"digestlease": bson.M{"$exists": false}},
+			{"digestlease": bson.M{"$lte": now}},
+		},
+	}, bson.M{
+		"$set": bson.M{"digestlease": now.Add(jobLease)},
+	})
+
+	if err == mgo.ErrNotFound {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// releaseDigest releases the lease on the digest of the subscriber.
+func releaseDigest(cfg *Config, sub *Subscriber) {
+	err := cfg.Mongo.Subscribers().UpdateId(sub.ID, bson.M{
+		"$unset": bson.M{"digestlease": 1},
+	})
+
+	// The lease expires if it cannot be released.
+	if err != nil && err != mgo.ErrNotFound {
+		log.Printf("[notify] error releasing digest of %s: %s", sub.Email, err)
+	}
+}
+
+// sendDigest claims the held notifications of the subscriber and sends them
+// in a single email. The digest of the subscriber is leased before the
+// notifications are claimed so concurrent workers do not split them or send
+// the same notifications.
+func sendDigest(cfg *Config, sub *Subscriber) error {
+	c := cfg.Mongo.Notifications()
+
+	batch := bson.NewObjectId()
+	now := time.Now().UTC()
+
+	ok, err := claimDigest(cfg, sub, now)
+
+	// Sent by another worker.
+	if err != nil || !ok {
+		return err
+	}
+
+	defer releaseDigest(cfg, sub)
+
+	q := bson.M{
+		"channel": ChannelDigest,
+		"target":  sub.ID,
+		"status":  JobHeld,
+	}
+
+	_, err = c.UpdateAll(q, bson.M{
+		"$set": bson.M{
+			"status": JobSending,
+			"batch":  batch,
+			"next":   now.Add(jobLease),
+		},
+		"$inc": bson.M{
+			"attempts": 1,
+		},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	var jobs []*Job
+
+	if err = c.Find(bson.M{"batch": batch}).Sort("time").All(&jobs); err != nil {
+		return err
+	}
+
+	// Sent by another worker since the digest was found due.
+	if len(jobs) == 0 {
+		return nil
+	}
+
+	// Notifications that cannot be decrypted are dead rather than failing
+	// the digest each time it is sent.
+	readable := jobs[:0]
+
+	for _, j := range jobs {
+		derr := cfg.Encryption.DecryptRevision(j.Revision)
+
+		if derr == nil {
+			readable = append(readable, j)
+			continue
+		}
+
+		log.Printf("[notify] error decrypting digest notification for %s: %s", j.Key, derr)
+
+		err = c.UpdateId(j.ID, bson.M{
+			"$set":   bson.M{"status": JobDead, "error": derr.Error()},
+			"$unset": bson.M{"batch": 1},
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	jobs = readable
+
+	if len(jobs) == 0 {
+		return nil
+	}
+
+	var e *email.Email
+
+	if err = sub.ensureToken(cfg); err == nil {
+		e, err = digestEmail(cfg, sub, jobs)
+	}
+
+	if err == nil {
+		e.From = cfg.SMTP.From
+		e.To = []string{sub.Email}
+
+		setUnsubscribe(cfg, e, sub)
+
+		err = cfg.SMTP.Send(e)
+	}
+
+	// Delivered.
+	if err == nil {
+		_, err = c.RemoveAll(bson.M{"batch": batch})
+		return err
+	}
+
+	log.Printf("[notify] error delivering digest to %s: %s", sub.Email, err)
+
+	// Hold the notifications until the next attempt or dead-letter them if
+	// the retries are exhausted. Notifications added since the attempt have
+	// fewer attempts so are grouped by their count.
+	for _, j := range jobs {
+		set := bson.M{
+			"error": err.Error(),
+		}
+
+		if j.Attempts <= cfg.Notify.Retries {
+			set["status"] = JobHeld
+			set["next"] = now.Add(cfg.Notify.Backoff << uint(j.Attempts-1))
+		} else {
+			set["status"] = JobDead
+		}
+
+		if uerr := c.UpdateId(j.ID, bson.M{"$set": set, "$unset": bson.M{"batch": 1}}); uerr != nil {
+			return uerr
+		}
+	}
+
+	return nil
+}
+
+// FlushDigests sends the digests that are due.
+func FlushDigests(cfg *Config) error {
+	c := cfg.Mongo.Notifications()
+
+	now := time.Now().UTC()
+
+	// Release batches of workers that did not finish.
+	_, err := c.UpdateAll(bson.M{
+		"channel": ChannelDigest,
+		"status":  JobSending,
+		"next":    bson.M{"$lte": now},
+	}, bson.M{
+		"$set":   bson.M{"status": JobHeld},
+		"$unset": bson.M{"batch": 1},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	pipe := []bson.M{
+		{"$match": bson.M{"channel": ChannelDigest, "status": JobHeld}},
+		{"$group": bson.M{
+			"_id":   "$target",
+			"first": bson.M{"$min": "$time"},
+			"last":  bson.M{"$max": "$time"},
+			"next":  bson.M{"$max": "$next"},
+		}},
+	}
+
+	var groups []struct {
+		Target bson.ObjectId `bson:"_id"`
+		First  time.Time
+		Last   time.Time
+		Next   time.Time
+	}
+
+	if err = c.Pipe(pipe).All(&groups); err != nil {
+		return err
+	}
+
+	for _, g := range groups {
+		// Waiting to retry.
+		if g.Next.After(now) {
+			continue
+		}
+
+		var sub Subscriber
+
+		err = cfg.Mongo.Subscribers().FindId(g.Target).One(&sub)
+
+		// Subscriber was removed since the notifications were queued.
+		if err == mgo.ErrNotFound {
+			if _, err = c.RemoveAll(bson.M{"channel": ChannelDigest, "target": g.Target}); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if !digestDue(cfg, &sub, g.First, g.Last, now) {
+			continue
+		}
+
+		// Other subscribers are sent their digests.
+		if err = sendDigest(cfg, &sub); err != nil {
+			log.Printf("[notify] error sending digest to %s: %s", sub.Email, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAbbreviate(t *testing.T) {
+	s := "a\nb\nc\nd\n"
+
+	if abbreviate(s, 4) != s {
+		t.Error("expected string to not be abbreviated")
+	}
+
+	if x := abbreviate(s, 2); x != "a\nb\n...\n" {
+		t.Errorf("unexpected abbreviation %q", x)
+	}
+}
+
+func TestDigestDue(t *testing.T) {
+	c := &Config{
+		Notify: NotifyConfig{
+			Quiet: 15 * time.Minute,
+		},
+	}
+
+	now := time.Now()
+
+	tests := []struct {
+		Digest string
+		Quiet  string
+		First  time.Duration
+		Last   time.Duration
+		Due    bool
+	}{
+		{DigestHourly, "", 30 * time.Minute, 0, false},
+		{DigestHourly, "", 61 * time.Minute, 0, true},
+		{DigestDaily, "", 23 * time.Hour, 0, false},
+		{DigestDaily, "", 25 * time.Hour, 0, true},
+		{DigestQuiet, "", time.Hour, 10 * time.Minute, false},
+		{DigestQuiet, "", time.Hour, 20 * time.Minute, true},
+		{DigestQuiet, "5m", time.Hour, 10 * time.Minute, true},
+	}
+
+	for i, test := range tests {
+		sub := &Subscriber{
+			Subscription: Subscription{
+				Digest: test.Digest,
+				Quiet:  test.Quiet,
+			},
+		}
+
+		if digestDue(c, sub, now.Add(-test.First), now.Add(-test.Last), now) != test.Due {
+			t.Errorf("test %d: expected due to be %v", i, test.Due)
+		}
+	}
+}
+
+func TestDigestEmail(t *testing.T) {
+	jobs := []*Job{
+		{
+			Key: "bob",
+			Revision: &Revision{
+				Version:   1,
+				Additions: map[string]interface{}{"name": "Bob"},
+			},
+		},
+		{
+			Key: "bob",
+			Revision: &Revision{
+				Version: 2,
+				Changes: map[string]Change{
+					"name": {Before: "Bob", After: "Bob Smith"},
+				},
+			},
+		},
+	}
+
+	e, err := digestEmail(cfg, &Subscriber{Token: "abc"}, jobs)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := string(e.Text)
+
+	if !strings.Contains(body, "2 new and changed objects") {
+		t.Errorf("expected count in body:\n%s", body)
+	}
+
+	if !strings.Contains(body, "after: Bob Smith") {
+		t.Errorf("expected change in body:\n%s", body)
+	}
+}
@@ -19,9 +19,19 @@ Commands:
 	get			Gets the latest state of an object from the store.
 	keys		Returns a list of keys in the store.
 	log			Returns an ordered set of diffs for an object.
+	changes		Returns the revisions across all objects since a point in time.
 	http		Runs an HTTP service with a comparable set of commands.
+	grpc		Runs a gRPC service with a comparable set of methods.
+	notify-worker	Delivers queued notifications.
 	subscribe	Subscribes one or more emails to receive notifications.
 	unsubscribe	Unsubscribes one or more emails from receiving notifications.
+	webhook		Manages webhooks that receive notifications.
+	token		Manages API tokens for the HTTP service.
+	audit		Returns the audit log of operations.
+	rekey		Re-encrypts stored values with the active encryption key.
+	export		Exports the objects and subscribers of the store.
+	import		Imports an export into the store.
+	load		Puts the rows of a CSV file as objects.
 
 Global Options:
 
@@ -29,6 +39,9 @@ Global Options:
 
 	-mongo.uri <uri>	Specify one or more MongoDB hosts [default: localhost/scds].
 
+	-remote <url>	Send commands to an SCDS HTTP server instead of MongoDB. Authenticates
+					with remote.token or remote.user and remote.password.
+
 	-smtp.host <host>		Host of the SMTP server [default: localhost].
 	-smtp.port <port>		Port of the SMTP server [default: 25].
 	-smtp.user <user>		User to authenticate with the SMTP server.
@@ -64,39 +77,137 @@ var logUsage = `scds log <key>
 Returns an ordered set of diffs for the object making up the log.
 `
 
-var httpUsage = `scds http [--host=<host>] [--port=<port>]
+var changesUsage = `scds changes [-since <time|cursor>] [-limit <int>]
+
+Returns the revisions of all objects ordered by time along with a cursor. The
+cursor can be passed as the -since value of a subsequent call to resume reading
+where the previous one stopped.
+
+Options:
+
+	-since <time|cursor>	Time (or duration relative to now) or cursor to read after.
+	-limit <int>			Maximum number of changes to return [default: 1000].
+`
+
+var httpUsage = `scds http [--host=<host>] [--port=<port>] [--public_url=<url>]
 
 Runs an HTTP server that defines endpoints corresponding to the command-line
-interface (CLI).
+interface (CLI). Objects and revisions in responses include a url to the
+object at the version, built from the public URL if set.
 
 Endpoints:
 
+	GET /openapi.json				Returns the OpenAPI document of the API.
+
+	GET /graphql?query=<query>		Executes a GraphQL query of objects, logs, and keys.
+	POST /graphql					Executes a GraphQL query in the body.
+
 	GET /keys						Returns a list keys in the store.
 
 	PUT /objects/:key				Puts an object in the store.
 	GET /objects/:key				Gets the latest state of an object from the store.
+	HEAD /objects/:key?hash=<hash>	Checks if the content hash of an object matches.
 	GET /objects/:key/v/:version	Gets the state of an object at the specified version.
 	GET /objects/:key/t/:time		Gets the state of an object at the specified time.
 
 	GET /log/:key					Returns an ordered set of diffs for an object.
 
+	GET /confirm/:token				Confirms a subscription using the link in the confirmation email.
+	GET /unsubscribe/:token			Returns a page to confirm unsubscribing using the link in notification emails.
+	POST /unsubscribe/:token		Unsubscribes. Used by the page and one-click unsubscribe in mail clients.
+
+	GET /webhooks					Returns the registered webhooks.
+	POST /webhooks					Registers a webhook.
+	DELETE /webhook/:id				Removes a webhook.
+	GET /webhook/:id/deliveries		Returns the delivery log of a webhook.
+
+	GET /notifications/status		Returns the state of the notification queue.
+
+	GET /audit						Returns the audit log of operations.
+
+	GET /changes?since=<time|cursor>	Returns revisions across all objects since a point in time.
+	GET /changes/stream				Streams revisions as server-sent events as they occur.
+
 Options:
 
 	-host <host>	The host to bind the HTTP server to [default: localhost].
 	-port <port>	The port to bind the HTTP server to [default: 5000].
+	-public_url <url>	Base URL used in links, e.g. https://scds.example.org.
+
+If auth.enabled is set, requests must be authenticated and are authorized
+against the roles of the identity (see auth.roles and auth.identities).
 
 `
 
+var grpcUsage = `scds grpc [-host <host>] [-port <port>]
+
+Runs a gRPC server for the scds.SCDS service defined in scdspb/scds.proto.
+Values are sent as google.protobuf.Struct. Go clients can use the generated
+scdspb package.
+
+Methods:
+
+	Put			Puts an object. The revision is omitted if the value did not change.
+	BatchPut	Puts the objects streamed by the client and returns the number of
+				changed and unchanged objects. Stops at the first failed put.
+	Get			Gets the state of an object, optionally at a version or time.
+	Log			Returns the revisions of an object.
+	Keys		Returns the keys of the objects.
+	Watch		Streams revisions as they occur, optionally since a time or cursor.
+
+Options:
+
+	-host <host>	The host to bind the gRPC server to [default: localhost].
+	-port <port>	The port to bind the gRPC server to [default: 5001].
+
+Credentials are sent in the authorization metadata the same way as the
+Authorization header of HTTP requests.
+`
+
+var notifyWorkerUsage = `scds notify-worker [-workers <n>]
+
+Delivers queued notifications. Notifications are queued when objects are
+created or changed and delivered by workers in the background, retrying failed
+deliveries with exponential backoff. Notifications that cannot be delivered
+after the configured number of retries are dead-lettered. The HTTP server runs
+workers as well, so this is only required if the HTTP server is not running or
+additional workers are needed.
+
+Options:
+
+	-workers <n>	Number of workers [default: 2].
+`
+
 var configUsage = `scds config
 
 Prints the configuration options defined across the configuration file, environment
-variables, and command-line flags.
+variables, and command-line flags. Tokens, passwords, and keys are redacted.
 `
 
-var subscribeUsage = `scds subscribe email [emails...]
+var subscribeUsage = `scds subscribe [options...] email [emails...]
 
 Subscribes one or more email addresses to receive notifications. Email
-addresses that already subscribed will not be subscribed again.
+addresses that already subscribed will not be subscribed again, but their
+filter options will be replaced. Subscriptions added with this command are
+confirmed, unlike subscriptions requested over HTTP.
+
+By default, subscribers are notified about all new and changed objects. The
+options below restrict notifications to matching objects and events. Each
+option may be repeated.
+
+Options:
+
+	-pattern <pattern>	Key pattern, e.g. 'billing.*'.
+	-event <event>		Event type, new or changed.
+	-field <path>		Field path that must be added, removed, or changed, e.g. 'address.city'.
+
+Rather than an email for each change, subscribers can receive a digest that
+summarizes all changes in a single email.
+
+	-digest <mode>		Digest mode. hourly and daily digests are sent once the oldest
+						change is an hour or day old. quiet digests are sent once no
+						changes have occurred for the quiet period.
+	-quiet <duration>	Quiet period of the quiet digest mode [default: 15m].
 `
 
 var unsubscribeUsage = `scds unsubscribe email [emails...]
@@ -105,6 +216,107 @@ Unsubscribes one or more email addresses from receiving notifications. Emails
 that are not subscribes will be ignored.
 `
 
+var webhookUsage = `scds webhook <cmd> [options...]
+
+Manages webhooks. Webhooks receive a JSON POST containing the event (new or
+changed), key, revision, and object URL when an object is created or changed.
+The body is signed with the webhook secret using HMAC-SHA256 and the signature
+is sent in the X-SCDS-Signature header.
+
+Commands:
+
+	add [-secret <secret>] <url>	Registers a webhook. A secret is generated if not provided.
+	remove <id>						Removes a webhook.
+	list							Lists the registered webhooks.
+	log [-limit <int>] <id>			Returns the most recent delivery attempts of a webhook.
+`
+
+var tokenUsage = `scds token <cmd> [options...]
+
+Manages API tokens used to authenticate with the HTTP service when
+auth.enabled is set. Tokens are sent in the Authorization header as
+"Bearer <token>". Only a hash of each token is stored.
+
+Commands:
+
+	create <name>	Creates a token and prints it. The token cannot be retrieved later.
+	list			Lists the names of the tokens.
+	revoke <name>	Revokes the tokens with the name.
+	hash			Reads a password from stdin and prints its bcrypt hash for auth.users.
+`
+
+var auditUsage = `scds audit [-identity <name>] [-op <op>] [-key <key>] [-since <time>] [-limit <int>]
+
+Returns the most recent entries of the audit log. Reads and writes made with
+the command-line interface and the HTTP service are recorded with the identity
+that performed them, the key, and the outcome.
+
+Options:
+
+	-identity <name>	Only return operations performed by the identity.
+	-op <op>			Only return operations of the type, e.g. get, put, or authenticate.
+	-key <key>			Only return operations on the key.
+	-since <time>		Time (or duration relative to now) to read entries after.
+	-limit <int>		Maximum number of entries to return [default: 100].
+`
+
+var rekeyUsage = `scds rekey
+
+Re-encrypts the values of all objects and queued notifications with the last
+key in the encryption.keyfile and the fields in encryption.fields. Run after
+adding a key to the keyfile so older keys can be removed, or after changing
+the encrypted fields. Content hashes are recomputed with encryption.hash_secret.
+Objects that keep being modified during the rekey are listed and skipped, and
+the command exits with 6 so it can be run again.
+`
+
+var exportUsage = `scds export [-o <file>]
+
+Writes the objects with their complete history and the subscribers as
+newline-delimited JSON to stdout or the file. Values are decrypted so the
+export can be imported into a store with other encryption keys.
+
+Options:
+
+	-o <file>	File to write the export to.
+`
+
+var importUsage = `scds import [-merge] [-check] [<file>]
+
+Imports an export from the file or stdin. The versions of each object must be
+continuous and its value must match its history. Imported objects do not send
+notifications. Prints the number of imported, unchanged, and conflicting
+objects and exits with 6 if there were conflicts.
+
+Options:
+
+	-merge	Import into a store that has objects. Objects are added or their
+			history extended if the stored history is a prefix of the imported
+			one. Objects with a different history are conflicts and are skipped.
+			Subscribers that already exist are kept.
+	-check	Only validate the export.
+`
+
+var loadUsage = `scds load -csv <file> -key-column <column> [-key-template <template>] [-columns <columns>] [-infer]
+
+Puts each row of the CSV file as an object. The first row is the header with
+the names of the columns. Values are validated against the configured schemas.
+Rows with an invalid key or value are logged and skipped. Prints the number of
+new, changed, unchanged, and invalid rows and exits with 5 if there were
+invalid rows.
+
+Options:
+
+	-csv <file>					CSV file to load.
+	-key-column <column>		Column of the key.
+	-key-template <template>	Template of the key with columns in braces, e.g. patients.{mrn}.
+								Defaults to the value of the key column.
+	-columns <columns>			Comma-separated list of columns to include [default: all].
+	-infer						Infer numbers and booleans and set empty cells to null.
+								Otherwise all values are strings. Numbers with leading
+								zeros are kept as strings.
+`
+
 func PrintUsage(cmd string) {
 	var usage string
 
@@ -121,9 +333,18 @@ func PrintUsage(cmd string) {
 	case "log":
 		usage = logUsage
 
+	case "changes":
+		usage = changesUsage
+
 	case "http":
 		usage = httpUsage
 
+	case "grpc":
+		usage = grpcUsage
+
+	case "notify-worker":
+		usage = notifyWorkerUsage
+
 	case "config":
 		usage = configUsage
 
@@ -133,6 +354,27 @@ func PrintUsage(cmd string) {
 	case "unsubscribe":
 		usage = unsubscribeUsage
 
+	case "webhook":
+		usage = webhookUsage
+
+	case "token":
+		usage = tokenUsage
+
+	case "audit":
+		usage = auditUsage
+
+	case "rekey":
+		usage = rekeyUsage
+
+	case "export":
+		usage = exportUsage
+
+	case "import":
+		usage = importUsage
+
+	case "load":
+		usage = loadUsage
+
 	default:
 		usage = defaultUsage
 	}
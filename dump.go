@@ -0,0 +1,479 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Format of exports. Incremented when the format changes incompatibly.
+const dumpFormat = 1
+
+// Types of export records.
+const (
+	dumpHeader     = "header"
+	dumpObject     = "object"
+	dumpSubscriber = "subscriber"
+)
+
+// dumpRecord is a line of an export. The first record is the header
+// followed by the objects with their complete history and the subscribers.
+type dumpRecord struct {
+	Type string `json:"type"`
+
+	// Header fields.
+	Format  int    `json:"format,omitempty"`
+	Version string `json:"version,omitempty"`
+
+	Object     *Object         `json:"object,omitempty"`
+	Subscriber *subscriberDump `json:"subscriber,omitempty"`
+}
+
+// subscriberDump includes the token of the subscriber so the links in
+// emails sent before the export keep working.
+type subscriberDump struct {
+	*Subscriber
+
+	Token string `json:"token,omitempty"`
+}
+
+// ExportResult is the number of exported objects and subscribers.
+type ExportResult struct {
+	Objects     int
+	Subscribers int
+}
+
+// Export writes the objects and subscribers as newline-delimited JSON.
+// Values are decrypted so the export can be imported with other keys.
+func Export(cfg *Config, w io.Writer) (*ExportResult, error) {
+	var res ExportResult
+
+	enc := json.NewEncoder(w)
+
+	err := enc.Encode(&dumpRecord{
+		Type:    dumpHeader,
+		Format:  dumpFormat,
+		Version: progVersion.String(),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	var o Object
+
+	it := cfg.Mongo.Objects().Find(nil).Sort("key").Iter()
+
+	for it.Next(&o) {
+		if err = cfg.Encryption.DecryptObject(&o); err != nil {
+			it.Close()
+			return nil, err
+		}
+
+		o.ID = ""
+
+		if err = enc.Encode(&dumpRecord{Type: dumpObject, Object: &o}); err != nil {
+			it.Close()
+			return nil, err
+		}
+
+		res.Objects++
+
+		o = Object{}
+	}
+
+	if err = it.Close(); err != nil {
+		return nil, err
+	}
+
+	var s Subscriber
+
+	it = cfg.Mongo.Subscribers().Find(nil).Sort("email").Iter()
+
+	for it.Next(&s) {
+		s.ID = ""
+
+		if err = enc.Encode(&dumpRecord{Type: dumpSubscriber, Subscriber: &subscriberDump{Subscriber: &s, Token: s.Token}}); err != nil {
+			it.Close()
+			return nil, err
+		}
+
+		res.Subscribers++
+
+		s = Subscriber{}
+	}
+
+	if err = it.Close(); err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+// checkHistory returns an error if the versions of the object are not
+// continuous from 1 or the value does not match its history.
+func checkHistory(o *Object) error {
+	if !checkKey(o.Key) {
+		return ErrInvalidKey(o.Key)
+	}
+
+	if len(o.History) == 0 {
+		return fmt.Errorf("%s has no history", o.Key)
+	}
+
+	var t int64
+
+	for i, r := range o.History {
+		if r.Version != i+1 {
+			return fmt.Errorf("%s: expected version %d, got %d", o.Key, i+1, r.Version)
+		}
+
+		if r.Time < t {
+			return fmt.Errorf("%s: version %d is older than the previous version", o.Key, r.Version)
+		}
+
+		t = r.Time
+	}
+
+	last := o.History[len(o.History)-1]
+
+	if o.Version != last.Version || o.Time != last.Time {
+		return fmt.Errorf("%s: version %d does not match the history", o.Key, o.Version)
+	}
+
+	same, err := sameVersion(o, o, o.Version)
+
+	if err != nil {
+		return err
+	}
+
+	if !same {
+		return fmt.Errorf("%s: value does not match the history", o.Key)
+	}
+
+	return nil
+}
+
+// sameVersion returns true if the value of a at the version has the same
+// time and content as the value of b. The history of b is not used if v is
+// its latest version.
+func sameVersion(a, b *Object, v int) (bool, error) {
+	x := a.AtVersion(v)
+
+	if v != b.Version {
+		b = b.AtVersion(v)
+	}
+
+	if x.Time != b.Time {
+		return false, nil
+	}
+
+	// Stored and decoded values differ in their types but not their
+	// content.
+	xh, err := ContentHash(x.Value)
+
+	if err != nil {
+		return false, err
+	}
+
+	bh, err := ContentHash(b.Value)
+
+	return xh == bh, err
+}
+
+// ImportResult is the outcome of the records of an import.
+type ImportResult struct {
+	// Objects that were inserted or whose history was extended.
+	Objects int
+
+	// Objects already in the store at the same or a later version.
+	Unchanged int
+
+	// Keys of objects whose history differs from the store.
+	Conflicts []string
+
+	Subscribers int
+}
+
+// Import restores the objects and subscribers of an export. Records are
+// validated as they are read and the import stops at the first invalid
+// record. The store must not contain objects unless merge is true, in which
+// case objects are inserted or extended if the stored history is a prefix
+// of the imported one. Objects with a different history are conflicts and
+// are not imported. Subscribers that exist are kept. If dry is true the
+// records are only validated.
+func Import(cfg *Config, r io.Reader, merge, dry bool) (*ImportResult, error) {
+	if !merge && !dry {
+		n, err := cfg.Mongo.Objects().Count()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if n > 0 {
+			return nil, ConflictError("Store is not empty, use -merge to import into it")
+		}
+	}
+
+	var (
+		res  ImportResult
+		line int
+	)
+
+	// Values are decoded like put values.
+	dec := json.NewDecoder(bufio.NewReader(r))
+
+	for {
+		var rec dumpRecord
+
+		err := dec.Decode(&rec)
+
+		if err == io.EOF {
+			break
+		}
+
+		line++
+
+		if err != nil {
+			return &res, ValidationError(fmt.Sprintf("Record %d is invalid", line), err.Error())
+		}
+
+		if line == 1 {
+			if rec.Type != dumpHeader {
+				return &res, ValidationError("Export header is missing", nil)
+			}
+
+			if rec.Format != dumpFormat {
+				return &res, ValidationError(fmt.Sprintf("Export format %d is not supported", rec.Format), nil)
+			}
+
+			continue
+		}
+
+		switch {
+		case rec.Type == dumpObject && rec.Object != nil:
+			o := rec.Object
+
+			if err = checkHistory(o); err != nil {
+				return &res, ValidationError(fmt.Sprintf("Record %d is invalid", line), err.Error())
+			}
+
+			if dry {
+				res.Objects++
+				continue
+			}
+
+			imported, err := importObject(cfg, o, merge)
+
+			if err != nil {
+				if e, ok := err.(*Error); ok && e.Code == CodeConflict {
+					res.Conflicts = append(res.Conflicts, o.Key)
+					continue
+				}
+
+				return &res, err
+			}
+
+			if imported {
+				res.Objects++
+			} else {
+				res.Unchanged++
+			}
+
+		case rec.Type == dumpSubscriber && rec.Subscriber != nil && rec.Subscriber.Subscriber != nil:
+			s := rec.Subscriber
+
+			if s.Email == "" {
+				return &res, ValidationError(fmt.Sprintf("Record %d is invalid", line), "Subscriber has no email")
+			}
+
+			if err = s.Validate(); err != nil {
+				return &res, ValidationError(fmt.Sprintf("Record %d is invalid", line), err.Error())
+			}
+
+			if dry {
+				res.Subscribers++
+				continue
+			}
+
+			s.Subscriber.Token = s.Token
+
+			added, err := importSubscriber(cfg, s.Subscriber)
+
+			if err != nil {
+				return &res, err
+			}
+
+			if added {
+				res.Subscribers++
+			}
+
+		default:
+			return &res, ValidationError(fmt.Sprintf("Record %d is invalid", line), fmt.Sprintf("Unknown record type %q", rec.Type))
+		}
+	}
+
+	if line == 0 {
+		return &res, ValidationError("Export header is missing", nil)
+	}
+
+	return &res, nil
+}
+
+// importObject inserts the object or extends the history of the stored
+// object. It returns false if the store already has the version.
+func importObject(cfg *Config, o *Object, merge bool) (bool, error) {
+	c := cfg.Mongo.Objects()
+
+	s, err := get(cfg, o.Key, true)
+
+	if err != nil {
+		return false, err
+	}
+
+	// The history would be written over sequence numbers set while the
+	// object is imported.
+	if s != nil && s.Unsequenced {
+		if _, err = sequence(c.Database); err != nil {
+			return false, err
+		}
+
+		if s, err = get(cfg, o.Key, true); err != nil {
+			return false, err
+		}
+
+		if s != nil && s.Unsequenced {
+			return false, ConflictError("%s was modified concurrently", o.Key)
+		}
+	}
+
+	// Version of the stored object.
+	var sv int
+
+	if s != nil {
+		if !merge {
+			return false, ConflictError("%s already exists", o.Key)
+		}
+
+		var same bool
+
+		// The histories must be the same up to the earlier version.
+		if s.Version >= o.Version {
+			same, err = sameVersion(s, o, o.Version)
+		} else {
+			same, err = sameVersion(o, s, s.Version)
+		}
+
+		if err != nil {
+			return false, err
+		}
+
+		if !same {
+			return false, ConflictError("%s has a different history", o.Key)
+		}
+
+		if s.Version >= o.Version {
+			return false, nil
+		}
+
+		sv = s.Version
+	}
+
+	// Stored revisions keep their position in the change feed and the
+	// imported ones are sequenced after they are written.
+	for i, r := range o.History {
+		r.Seq = 0
+
+		if i < sv {
+			r.Seq = s.History[i].Seq
+		}
+	}
+
+	enc := &cfg.Encryption
+
+	// Hashes in the export are not trusted and may be keyed with another
+	// secret.
+	if err = enc.rehash(o); err != nil {
+		return false, err
+	}
+
+	v, err := enc.EncryptDoc(o.Value)
+
+	if err != nil {
+		return false, err
+	}
+
+	h := make([]*Revision, len(o.History))
+
+	for i, r := range o.History {
+		if h[i], err = enc.EncryptRevision(r); err != nil {
+			return false, err
+		}
+	}
+
+	if s == nil {
+		return true, c.Insert(&Object{
+			ID:      bson.NewObjectId(),
+			Key:     o.Key,
+			Value:   v,
+			Version: o.Version,
+			Time:    o.Time,
+			History: h,
+			Hash:    o.Hash,
+
+			Unsequenced: true,
+		})
+	}
+
+	// Only update if no revision was added concurrently.
+	err = c.Update(bson.M{"_id": s.ID, "version": s.Version}, bson.M{
+		"$set": bson.M{
+			"value":   v,
+			"version": o.Version,
+			"time":    o.Time,
+			"hash":    o.Hash,
+			"history": h,
+
+			"unsequenced": true,
+		},
+	})
+
+	if err == mgo.ErrNotFound {
+		return false, ConflictError("%s was modified concurrently", o.Key)
+	}
+
+	return err == nil, err
+}
+
+// importSubscriber inserts the subscriber unless the email is already
+// subscribed. It returns true if the subscriber was inserted.
+func importSubscriber(cfg *Config, s *Subscriber) (bool, error) {
+	s.ID = bson.NewObjectId()
+	s.Email = strings.ToLower(s.Email)
+
+	if s.Token == "" {
+		token, err := newSecret()
+
+		if err != nil {
+			return false, err
+		}
+
+		s.Token = token
+	}
+
+	info, err := cfg.Mongo.Subscribers().Upsert(bson.M{"email": s.Email}, bson.M{
+		"$setOnInsert": s,
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	// If the document was not updated, it was inserted.
+	return info.Updated == 0, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckHistory(t *testing.T) {
+	history := func() []*Revision {
+		return []*Revision{
+			{Version: 1, Time: 100, Additions: map[string]interface{}{"name": "Bob"}},
+			{Version: 2, Time: 200, Additions: map[string]interface{}{"age": 30.0}},
+		}
+	}
+
+	o := &Object{
+		Key:     "bob",
+		Value:   map[string]interface{}{"name": "Bob", "age": 30.0},
+		Version: 2,
+		Time:    200,
+		History: history(),
+	}
+
+	if err := checkHistory(o); err != nil {
+		t.Errorf("expected valid history, got %s", err)
+	}
+
+	// Gap in the versions.
+	h := history()
+	h[1].Version = 3
+	o.History = h
+
+	if err := checkHistory(o); err == nil {
+		t.Error("expected error for a gap in versions")
+	}
+
+	// Value that does not match the history.
+	o.History = history()
+	o.Value = map[string]interface{}{"name": "Robert", "age": 30.0}
+
+	if err := checkHistory(o); err == nil {
+		t.Error("expected error for a value that does not match")
+	}
+
+	// Latest version that is not in the history.
+	o.Value = map[string]interface{}{"name": "Bob", "age": 30.0}
+	o.Version = 3
+
+	if err := checkHistory(o); err == nil {
+		t.Error("expected error for a version that is not in the history")
+	}
+}
+
+func TestImportCheck(t *testing.T) {
+	cfg := &Config{}
+
+	header := `{"type":"header","format":1,"version":"1.0.0"}` + "\n"
+	object := `{"type":"object","object":{"key":"bob","value":{"name":"Bob"},"version":1,"time":100,"history":[{"version":1,"time":100,"additions":{"name":"Bob"}}]}}` + "\n"
+	subscriber := `{"type":"subscriber","subscriber":{"email":"joe@example.com","time":"2017-01-01T00:00:00Z","token":"abc"}}` + "\n"
+
+	res, err := Import(cfg, strings.NewReader(header+object+subscriber), false, true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Objects != 1 || res.Subscribers != 1 {
+		t.Errorf("expected 1 object and 1 subscriber, got %d and %d", res.Objects, res.Subscribers)
+	}
+
+	tests := map[string]string{
+		"missing header": object,
+		"format":         `{"type":"header","format":2}` + "\n" + object,
+		"unknown type":   header + `{"type":"webhook"}` + "\n",
+		"version":        header + strings.Replace(object, `"version":1,"time":100,"add`, `"version":2,"time":100,"add`, 1),
+		"malformed":      header + "{\n",
+		"empty":          "",
+	}
+
+	for name, in := range tests {
+		if _, err := Import(cfg, strings.NewReader(in), false, true); err == nil {
+			t.Errorf("%s: expected error", name)
+		} else if exitCode(err) != ExitValidation {
+			t.Errorf("%s: expected validation error, got %s", name, err)
+		}
+	}
+}
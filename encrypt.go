@@ -0,0 +1,608 @@
+package main
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Prefix of encrypted values. It is followed by the id of the key and the
+// base64-encoded nonce and ciphertext separated by a colon.
+const encryptedPrefix = "scds:enc:"
+
+var ErrMalformedCiphertext = errors.New("Encrypted value is malformed")
+
+// Keyring holds the keys values are encrypted with. New values are encrypted
+// with the active key which is the last key in the keyfile. Earlier keys are
+// kept to decrypt existing values until they are re-encrypted with the rekey
+// command.
+type Keyring struct {
+	keys   map[string]cipher.AEAD
+	active string
+}
+
+// LoadKeyring reads a keyfile containing one key per line of the form
+// `<id> <key>` where the key is 32 base64-encoded bytes for AES-256. Blank
+// lines and lines starting with # are ignored.
+func LoadKeyring(path string) (*Keyring, error) {
+	f, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	return readKeyring(f)
+}
+
+func readKeyring(r io.Reader) (*Keyring, error) {
+	k := Keyring{
+		keys: make(map[string]cipher.AEAD),
+	}
+
+	s := bufio.NewScanner(r)
+	n := 0
+
+	for s.Scan() {
+		n++
+
+		line := strings.TrimSpace(s.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		toks := strings.Fields(line)
+
+		if len(toks) != 2 || strings.Contains(toks[0], ":") {
+			return nil, fmt.Errorf("Line %d: expected <id> <key>", n)
+		}
+
+		id := toks[0]
+
+		if _, ok := k.keys[id]; ok {
+			return nil, fmt.Errorf("Line %d: duplicate key id %s", n, id)
+		}
+
+		b, err := base64.StdEncoding.DecodeString(toks[1])
+
+		if err != nil || len(b) != 32 {
+			return nil, fmt.Errorf("Line %d: key must be 32 base64-encoded bytes", n)
+		}
+
+		block, err := aes.NewCipher(b)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if k.keys[id], err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+
+		k.active = id
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	if k.active == "" {
+		return nil, errors.New("No keys defined")
+	}
+
+	return &k, nil
+}
+
+// Active returns the id of the key new values are encrypted with.
+func (k *Keyring) Active() string {
+	return k.active
+}
+
+// encrypt encodes the value as JSON and encrypts it with the active key.
+func (k *Keyring) encrypt(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+
+	if err != nil {
+		return "", err
+	}
+
+	aead := k.keys[k.active]
+	nonce := make([]byte, aead.NonceSize())
+
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	// The nonce is prepended to the ciphertext.
+	b = aead.Seal(nonce, nonce, b, []byte(k.active))
+
+	return encryptedPrefix + k.active + ":" + base64.RawStdEncoding.EncodeToString(b), nil
+}
+
+// decrypt decrypts a value produced by encrypt with the key it was encrypted
+// with.
+func (k *Keyring) decrypt(s string) (interface{}, error) {
+	toks := strings.SplitN(strings.TrimPrefix(s, encryptedPrefix), ":", 2)
+
+	if len(toks) != 2 {
+		return nil, ErrMalformedCiphertext
+	}
+
+	aead, ok := k.keys[toks[0]]
+
+	if !ok {
+		return nil, fmt.Errorf("Value is encrypted with unknown key %s", toks[0])
+	}
+
+	b, err := base64.RawStdEncoding.DecodeString(toks[1])
+
+	if err != nil || len(b) < aead.NonceSize() {
+		return nil, ErrMalformedCiphertext
+	}
+
+	ns := aead.NonceSize()
+
+	if b, err = aead.Open(nil, b[:ns], b[ns:], []byte(toks[0])); err != nil {
+		return nil, err
+	}
+
+	var v interface{}
+
+	if err = json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+func isEncrypted(v interface{}) bool {
+	s, ok := v.(string)
+	return ok && strings.HasPrefix(s, encryptedPrefix)
+}
+
+// EncryptionConfig defines which values of objects are encrypted at rest.
+// Values are compared before they are encrypted so revisions contain the
+// same changes as without encryption.
+type EncryptionConfig struct {
+	// File containing the keys. Encryption is disabled if not set.
+	KeyFile string
+
+	// Paths of the fields to encrypt, e.g. `ssn` or `patient.dob`. All
+	// fields are encrypted if none are defined.
+	Fields []string
+
+	// Secret content hashes are keyed with so stored and returned hashes
+	// cannot be used to guess values. Required if encryption is enabled.
+	HashSecret string
+
+	keys *Keyring
+}
+
+// Load reads the keyfile.
+func (c *EncryptionConfig) Load() error {
+	if c.KeyFile == "" {
+		return nil
+	}
+
+	// Unkeyed hashes of small values can be brute-forced.
+	if c.HashSecret == "" {
+		return errors.New("hash_secret is required if encryption is enabled")
+	}
+
+	var err error
+
+	c.keys, err = LoadKeyring(c.KeyFile)
+
+	return err
+}
+
+// ContentHash returns the HMAC-SHA256 of the canonical JSON encoding of the
+// value keyed with the hash secret. Without a secret it is the SHA-256 hash
+// returned by ContentHash.
+func (c *EncryptionConfig) ContentHash(v map[string]interface{}) (string, error) {
+	if c.HashSecret == "" {
+		return ContentHash(v)
+	}
+
+	b, err := canonicalJSON(v)
+
+	if err != nil {
+		return "", err
+	}
+
+	m := hmac.New(sha256.New, []byte(c.HashSecret))
+	m.Write(b)
+
+	return hex.EncodeToString(m.Sum(nil)), nil
+}
+
+// rehash sets the content hashes of the object and its revisions from the
+// values replayed from its history.
+func (c *EncryptionConfig) rehash(o *Object) error {
+	n := Object{
+		Value: make(map[string]interface{}),
+	}
+
+	var err error
+
+	for _, r := range o.History {
+		applyRevision(&n, r)
+
+		if r.Hash, err = c.ContentHash(n.Value); err != nil {
+			return err
+		}
+	}
+
+	o.Hash, err = c.ContentHash(o.Value)
+
+	return err
+}
+
+// Enabled returns true if values are encrypted.
+func (c *EncryptionConfig) Enabled() bool {
+	return c.keys != nil
+}
+
+// EncryptDoc returns a copy of the document with the configured fields
+// encrypted. The document is not modified.
+func (c *EncryptionConfig) EncryptDoc(doc map[string]interface{}) (map[string]interface{}, error) {
+	if !c.Enabled() || doc == nil {
+		return doc, nil
+	}
+
+	var err error
+
+	if len(c.Fields) == 0 {
+		n := make(map[string]interface{}, len(doc))
+
+		for k, v := range doc {
+			if n[k], err = c.keys.encrypt(v); err != nil {
+				return nil, err
+			}
+		}
+
+		return n, nil
+	}
+
+	for _, f := range c.Fields {
+		if doc, err = c.encryptPath(doc, strings.Split(f, ".")); err != nil {
+			return nil, err
+		}
+	}
+
+	return doc, nil
+}
+
+// encryptPath returns a copy of the document with the value at the path
+// encrypted. The document is returned as is if the path does not exist.
+func (c *EncryptionConfig) encryptPath(doc map[string]interface{}, path []string) (map[string]interface{}, error) {
+	return mapPath(doc, path, func(v interface{}) (interface{}, error) {
+		// Already encrypted by an overlapping path.
+		if isEncrypted(v) {
+			return v, nil
+		}
+
+		return c.keys.encrypt(v)
+	})
+}
+
+// DecryptDoc returns a copy of the document with all encrypted values
+// decrypted regardless of the configured fields.
+func (c *EncryptionConfig) DecryptDoc(doc map[string]interface{}) (map[string]interface{}, error) {
+	if !c.Enabled() || doc == nil {
+		return doc, nil
+	}
+
+	n := make(map[string]interface{}, len(doc))
+
+	for k, v := range doc {
+		d, err := c.decryptValue(v)
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", k, err)
+		}
+
+		n[k] = d
+	}
+
+	return n, nil
+}
+
+func (c *EncryptionConfig) decryptValue(v interface{}) (interface{}, error) {
+	if isEncrypted(v) {
+		d, err := c.keys.decrypt(v.(string))
+
+		if err != nil {
+			return nil, err
+		}
+
+		// Nested values may have been encrypted by another path.
+		return c.decryptValue(d)
+	}
+
+	if doc, ok := asDoc(v); ok {
+		return c.DecryptDoc(doc)
+	}
+
+	if a, ok := v.([]interface{}); ok {
+		n := make([]interface{}, len(a))
+
+		for i, x := range a {
+			d, err := c.decryptValue(x)
+
+			if err != nil {
+				return nil, err
+			}
+
+			n[i] = d
+		}
+
+		return n, nil
+	}
+
+	return v, nil
+}
+
+// EncryptRevision returns a copy of the revision with the configured fields
+// of the additions, removals, and changes encrypted.
+func (c *EncryptionConfig) EncryptRevision(r *Revision) (*Revision, error) {
+	if !c.Enabled() || r == nil {
+		return r, nil
+	}
+
+	n := *r
+
+	var err error
+
+	if n.Additions, err = c.EncryptDoc(r.Additions); err != nil {
+		return nil, err
+	}
+
+	if n.Removals, err = c.EncryptDoc(r.Removals); err != nil {
+		return nil, err
+	}
+
+	if r.Changes != nil {
+		n.Changes = make(map[string]Change, len(r.Changes))
+
+		for k, chg := range r.Changes {
+			b, err := c.EncryptDoc(map[string]interface{}{k: chg.Before})
+
+			if err != nil {
+				return nil, err
+			}
+
+			a, err := c.EncryptDoc(map[string]interface{}{k: chg.After})
+
+			if err != nil {
+				return nil, err
+			}
+
+			n.Changes[k] = Change{
+				Before: b[k],
+				After:  a[k],
+			}
+		}
+	}
+
+	return &n, nil
+}
+
+// DecryptRevision decrypts the revision in place.
+func (c *EncryptionConfig) DecryptRevision(r *Revision) error {
+	if !c.Enabled() || r == nil {
+		return nil
+	}
+
+	var err error
+
+	if r.Additions, err = c.DecryptDoc(r.Additions); err != nil {
+		return err
+	}
+
+	if r.Removals, err = c.DecryptDoc(r.Removals); err != nil {
+		return err
+	}
+
+	for k, chg := range r.Changes {
+		if chg.Before, err = c.decryptValue(chg.Before); err != nil {
+			return fmt.Errorf("%s: %s", k, err)
+		}
+
+		if chg.After, err = c.decryptValue(chg.After); err != nil {
+			return fmt.Errorf("%s: %s", k, err)
+		}
+
+		r.Changes[k] = chg
+	}
+
+	return nil
+}
+
+// DecryptObject decrypts the value and history of the object in place.
+func (c *EncryptionConfig) DecryptObject(o *Object) error {
+	if !c.Enabled() {
+		return nil
+	}
+
+	var err error
+
+	if o.Value, err = c.DecryptDoc(o.Value); err != nil {
+		return fmt.Errorf("%s: %s", o.Key, err)
+	}
+
+	for _, r := range o.History {
+		if err = c.DecryptRevision(r); err != nil {
+			return fmt.Errorf("%s v%d: %s", o.Key, r.Version, err)
+		}
+	}
+
+	return nil
+}
+
+// Number of times an object modified concurrently during a rekey is read
+// again before it is skipped.
+const rekeyRetries = 5
+
+// RekeyResult is the outcome of a rekey.
+type RekeyResult struct {
+	// Objects that were re-encrypted.
+	Objects int
+
+	// Keys of objects that kept being modified concurrently and were not
+	// re-encrypted.
+	Skipped []string
+
+	// Notifications that could not be decrypted and were left as is.
+	SkippedJobs int
+}
+
+// rekeyObject re-encrypts the object. Returns mgo.ErrNotFound if a revision
+// was added since the object was read or its revisions are not sequenced
+// yet, since their sequence numbers would be written over.
+func rekeyObject(cfg *Config, o *Object) error {
+	enc := &cfg.Encryption
+
+	if o.Unsequenced {
+		if _, err := sequence(cfg.Mongo.Objects().Database); err != nil {
+			return err
+		}
+
+		return mgo.ErrNotFound
+	}
+
+	if err := enc.DecryptObject(o); err != nil {
+		return err
+	}
+
+	// Replaces hashes computed with another or no secret.
+	if err := enc.rehash(o); err != nil {
+		return err
+	}
+
+	v, err := enc.EncryptDoc(o.Value)
+
+	if err != nil {
+		return err
+	}
+
+	h := make([]*Revision, len(o.History))
+
+	for i, r := range o.History {
+		if h[i], err = enc.EncryptRevision(r); err != nil {
+			return err
+		}
+	}
+
+	// Only update if no revision was added concurrently.
+	return cfg.Mongo.Objects().Update(bson.M{"_id": o.ID, "version": o.Version}, bson.M{
+		"$set": bson.M{
+			"value":   v,
+			"hash":    o.Hash,
+			"history": h,
+		},
+	})
+}
+
+// Rekey re-encrypts the values of all objects and queued notifications with
+// the active key and the configured fields. This is used after a key is
+// added to the keyfile so older keys can be removed, or after the fields
+// are changed. Objects modified during the rekey are read again and those
+// that keep changing are skipped and returned in the result.
+func Rekey(cfg *Config) (*RekeyResult, error) {
+	enc := &cfg.Encryption
+
+	if !enc.Enabled() {
+		return nil, errors.New("Encryption keyfile is not set")
+	}
+
+	var (
+		o   Object
+		res RekeyResult
+	)
+
+	c := cfg.Mongo.Objects()
+	it := c.Find(nil).Iter()
+
+	for it.Next(&o) {
+		id, key := o.ID, o.Key
+
+		err := rekeyObject(cfg, &o)
+
+		for i := 0; err == mgo.ErrNotFound && i < rekeyRetries; i++ {
+			o = Object{}
+
+			if err = c.FindId(id).One(&o); err == nil {
+				err = rekeyObject(cfg, &o)
+			}
+		}
+
+		switch {
+		case err == mgo.ErrNotFound:
+			res.Skipped = append(res.Skipped, key)
+
+		case err != nil:
+			it.Close()
+			return &res, fmt.Errorf("%s: %s", key, err)
+
+		default:
+			res.Objects++
+		}
+
+		o = Object{}
+	}
+
+	if err := it.Close(); err != nil {
+		return &res, err
+	}
+
+	// Revisions of queued notifications.
+	var j Job
+
+	jc := cfg.Mongo.Notifications()
+	it = jc.Find(nil).Iter()
+
+	for it.Next(&j) {
+		// Dead-lettered by the workers if the key was already removed.
+		if err := enc.DecryptRevision(j.Revision); err != nil {
+			res.SkippedJobs++
+			j = Job{}
+			continue
+		}
+
+		r, err := enc.EncryptRevision(j.Revision)
+
+		if err != nil {
+			it.Close()
+			return &res, err
+		}
+
+		// The job may have been delivered in the meantime.
+		err = jc.UpdateId(j.ID, bson.M{"$set": bson.M{"revision": r}})
+
+		if err != nil && err != mgo.ErrNotFound {
+			it.Close()
+			return &res, err
+		}
+
+		j = Job{}
+	}
+
+	return &res, it.Close()
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testKeys = `
+# Rotated keys.
+k1 MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=
+k2 ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA=
+`
+
+func testEncryption(t *testing.T, keys string, fields ...string) *EncryptionConfig {
+	k, err := readKeyring(strings.NewReader(keys))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &EncryptionConfig{
+		Fields: fields,
+		keys:   k,
+	}
+}
+
+func TestReadKeyring(t *testing.T) {
+	k, err := readKeyring(strings.NewReader(testKeys))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if k.Active() != "k2" {
+		t.Errorf("expected k2 to be active, got %s", k.Active())
+	}
+
+	invalid := []string{
+		"",
+		"k1",
+		"k1 c2hvcnQ=",
+		"k:1 MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=",
+		testKeys + "k1 MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=",
+	}
+
+	for i, s := range invalid {
+		if _, err := readKeyring(strings.NewReader(s)); err == nil {
+			t.Errorf("test %d: expected keyfile to be invalid", i)
+		}
+	}
+}
+
+func TestEncryptDoc(t *testing.T) {
+	c := testEncryption(t, testKeys, "ssn", "patient.dob")
+
+	doc := map[string]interface{}{
+		"name": "Bob",
+		"ssn":  "123-45-6789",
+		"patient": map[string]interface{}{
+			"dob": "2001-01-01",
+			"mrn": 42.0,
+		},
+	}
+
+	enc, err := c.EncryptDoc(doc)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if enc["name"] != "Bob" || !isEncrypted(enc["ssn"]) {
+		t.Errorf("expected only ssn to be encrypted, got %v", enc)
+	}
+
+	p := enc["patient"].(map[string]interface{})
+
+	if !isEncrypted(p["dob"]) || p["mrn"] != 42.0 {
+		t.Errorf("expected only patient.dob to be encrypted, got %v", p)
+	}
+
+	// Original is not modified.
+	if doc["ssn"] != "123-45-6789" || doc["patient"].(map[string]interface{})["dob"] != "2001-01-01" {
+		t.Error("expected document to not be modified")
+	}
+
+	dec, err := c.DecryptDoc(enc)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(dec, doc) {
+		t.Errorf("expected %v, got %v", doc, dec)
+	}
+
+	// Values encrypted with a rotated key can still be decrypted.
+	old := testEncryption(t, "k1 MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+
+	if enc, err = old.EncryptDoc(doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if dec, err = c.DecryptDoc(enc); err != nil || !reflect.DeepEqual(dec, doc) {
+		t.Errorf("expected %v, got %v (%v)", doc, dec, err)
+	}
+
+	// Unknown key.
+	other := testEncryption(t, "k3 ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA=")
+
+	if _, err = other.DecryptDoc(enc); err == nil {
+		t.Error("expected unknown key error")
+	}
+}
+
+func TestEncryptRevision(t *testing.T) {
+	c := testEncryption(t, testKeys)
+
+	b := map[string]interface{}{
+		"name": "Bob",
+		"ssn":  "123-45-6789",
+	}
+
+	a := map[string]interface{}{
+		"name":  "Bob Smith",
+		"email": "bob@smith.net",
+	}
+
+	r := Diff(b, a)
+
+	enc, err := c.EncryptRevision(r)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !isEncrypted(enc.Additions["email"]) || !isEncrypted(enc.Removals["ssn"]) {
+		t.Errorf("expected additions and removals to be encrypted, got %v", enc)
+	}
+
+	chg := enc.Changes["name"]
+
+	if !isEncrypted(chg.Before) || !isEncrypted(chg.After) {
+		t.Errorf("expected change to be encrypted, got %v", chg)
+	}
+
+	if err = c.DecryptRevision(enc); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(enc, r) {
+		t.Errorf("expected %v, got %v", r, enc)
+	}
+}
+
+func TestRekeySkipsUndecryptableJobs(t *testing.T) {
+	defer cfg.Mongo.Close()
+	resetDB()
+
+	cfg.Encryption = *testEncryption(t, testKeys, "ssn")
+
+	if _, err := Put(cfg, "bob", map[string]interface{}{"ssn": "123-45-6789"}); err != nil {
+		t.Fatal(err)
+	}
+
+	insertUndecryptableJob(t)
+
+	res, err := Rekey(cfg)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Objects != 1 || res.SkippedJobs != 1 {
+		t.Errorf("expected 1 object and 1 skipped job, got %+v", res)
+	}
+}
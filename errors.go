@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/chop-dbhi/scds/client"
+	"github.com/labstack/echo"
+	"gopkg.in/mgo.v2"
+)
+
+// Codes identifying the kind of error in error responses.
+const (
+	CodeInvalidKey       = "invalid_key"
+	CodeInvalidParameter = "invalid_parameter"
+	CodeInvalidBody      = "invalid_body"
+	CodeValidationFailed = "validation_failed"
+	CodeNotFound         = "not_found"
+	CodeConflict         = "conflict"
+	CodeUnauthenticated  = "unauthenticated"
+	CodeForbidden        = "forbidden"
+	CodeInternal         = "internal_error"
+)
+
+// Exit codes of commands. Invalid flags exit with 2.
+const (
+	ExitError      = 1
+	ExitNotFound   = 3
+	ExitInvalid    = 4
+	ExitValidation = 5
+	ExitConflict   = 6
+	ExitDenied     = 7
+)
+
+// Error is an error with the HTTP status and code of its kind. It is the
+// body of error responses.
+type Error struct {
+	Status  int         `json:"-"`
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if d, ok := e.Details.(string); ok && d != "" {
+		return fmt.Sprintf("%s: %s", e.Message, d)
+	}
+
+	return e.Message
+}
+
+// NotFoundError returns an error for a resource that does not exist.
+func NotFoundError(format string, args ...interface{}) *Error {
+	return &Error{
+		Status:  http.StatusNotFound,
+		Code:    CodeNotFound,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// ParamError returns an error for an invalid request parameter.
+func ParamError(name string, err error) *Error {
+	return &Error{
+		Status:  http.StatusBadRequest,
+		Code:    CodeInvalidParameter,
+		Message: fmt.Sprintf("Invalid %s parameter", name),
+		Details: err.Error(),
+	}
+}
+
+// BodyError returns an error for a request body that cannot be decoded.
+func BodyError(err error) *Error {
+	return &Error{
+		Status:  http.StatusBadRequest,
+		Code:    CodeInvalidBody,
+		Message: "Problem decoding request body",
+		Details: err.Error(),
+	}
+}
+
+// ValidationError returns an error for input that was decoded but is not
+// valid.
+func ValidationError(message string, details interface{}) *Error {
+	return &Error{
+		Status:  StatusUnprocessableEntity,
+		Code:    CodeValidationFailed,
+		Message: message,
+		Details: details,
+	}
+}
+
+// ConflictError returns an error for a write that conflicts with the
+// current state.
+func ConflictError(format string, args ...interface{}) *Error {
+	return &Error{
+		Status:  http.StatusConflict,
+		Code:    CodeConflict,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// statusCodes are the codes of errors returned by echo.
+var statusCodes = map[int]string{
+	http.StatusBadRequest:     CodeInvalidBody,
+	http.StatusUnauthorized:   CodeUnauthenticated,
+	http.StatusForbidden:      CodeForbidden,
+	http.StatusNotFound:       CodeNotFound,
+	http.StatusConflict:       CodeConflict,
+	StatusUnprocessableEntity: CodeValidationFailed,
+}
+
+// AsError returns the error as an *Error. Errors of unknown kinds are
+// internal errors.
+func AsError(err error) *Error {
+	switch x := err.(type) {
+	case *Error:
+		return x
+
+	case ResultErrors:
+		return ValidationError("Object failed schema validation", x)
+
+	// Error responses of a remote server.
+	case *client.Error:
+		e := &Error{
+			Status:  x.StatusCode,
+			Code:    x.Code,
+			Message: x.Message,
+		}
+
+		if len(x.Details) > 0 {
+			json.Unmarshal(x.Details, &e.Details)
+		}
+
+		return e
+
+	case *echo.HTTPError:
+		code, ok := statusCodes[x.Code]
+
+		// E.g. method_not_allowed.
+		if !ok {
+			code = strings.ToLower(strings.Replace(http.StatusText(x.Code), " ", "_", -1))
+		}
+
+		return &Error{
+			Status:  x.Code,
+			Code:    code,
+			Message: x.Message,
+		}
+	}
+
+	if mgo.IsDup(err) {
+		return ConflictError("Already exists")
+	}
+
+	return &Error{
+		Status:  http.StatusInternalServerError,
+		Code:    CodeInternal,
+		Message: "Internal server error",
+	}
+}
+
+// exitCode returns the exit code of the command for the error.
+func exitCode(err error) int {
+	switch AsError(err).Status {
+	case http.StatusNotFound:
+		return ExitNotFound
+
+	case http.StatusBadRequest:
+		return ExitInvalid
+
+	case StatusUnprocessableEntity:
+		return ExitValidation
+
+	case http.StatusConflict:
+		return ExitConflict
+
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ExitDenied
+	}
+
+	return ExitError
+}
+
+// fatal logs the error and exits with the exit code of the error.
+func fatal(err error) {
+	log.Print(err)
+	os.Exit(exitCode(err))
+}
+
+// httpErrorHandler writes errors returned by handlers as JSON. The cause of
+// internal errors is only included in debug mode.
+func httpErrorHandler(err error, c echo.Context) {
+	e := AsError(err)
+
+	if e.Status >= http.StatusInternalServerError {
+		log.Printf("[http] %s", err)
+
+		if c.Echo().Debug() {
+			e.Details = err.Error()
+		}
+	}
+
+	if c.Response().Committed() {
+		return
+	}
+
+	if c.Request().Method() == echo.HEAD {
+		c.NoContent(e.Status)
+		return
+	}
+
+	c.JSON(e.Status, e)
+}
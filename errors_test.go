@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/chop-dbhi/scds/client"
+	"github.com/labstack/echo"
+)
+
+func TestAsError(t *testing.T) {
+	tests := []struct {
+		Err    error
+		Status int
+		Code   string
+		Exit   int
+	}{
+		{ErrInvalidKey("a b"), http.StatusBadRequest, CodeInvalidKey, ExitInvalid},
+		{NotFoundError("Object %s does not exist", "bob"), http.StatusNotFound, CodeNotFound, ExitNotFound},
+		{ResultErrors{}, StatusUnprocessableEntity, CodeValidationFailed, ExitValidation},
+		{ConflictError("bob was modified concurrently"), http.StatusConflict, CodeConflict, ExitConflict},
+		{&echo.HTTPError{Code: http.StatusMethodNotAllowed}, http.StatusMethodNotAllowed, "method_not_allowed", ExitError},
+		{&client.Error{StatusCode: http.StatusForbidden, Code: CodeForbidden}, http.StatusForbidden, CodeForbidden, ExitDenied},
+		{errors.New("connection refused"), http.StatusInternalServerError, CodeInternal, ExitError},
+	}
+
+	for _, test := range tests {
+		e := AsError(test.Err)
+
+		if e.Status != test.Status || e.Code != test.Code {
+			t.Errorf("%s: expected %d %s, got %d %s", test.Err, test.Status, test.Code, e.Status, e.Code)
+		}
+
+		if c := exitCode(test.Err); c != test.Exit {
+			t.Errorf("%s: expected exit code %d, got %d", test.Err, test.Exit, c)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Event types of notifications.
+const (
+	EventNew     = "new"
+	EventChanged = "changed"
+)
+
+// eventType returns the event type of the revision.
+func eventType(r *Revision) string {
+	if r.Version == 1 {
+		return EventNew
+	}
+
+	return EventChanged
+}
+
+// Filter restricts the objects and events a subscriber is notified about.
+// An empty filter matches everything.
+type Filter struct {
+	// Key patterns, e.g. `billing.*`.
+	Patterns []string `bson:",omitempty" json:"patterns,omitempty"`
+
+	// Event types, new or changed.
+	Events []string `bson:",omitempty" json:"events,omitempty"`
+
+	// Field paths that must be affected by the revision. Nested fields
+	// are delimited by a period, e.g. `address.city`.
+	Fields []string `bson:",omitempty" json:"fields,omitempty"`
+}
+
+// Validate checks the filter for malformed patterns and unknown event types.
+func (f *Filter) Validate() error {
+	for _, p := range f.Patterns {
+		if err := checkKeyPattern(p); err != nil {
+			return err
+		}
+	}
+
+	for _, e := range f.Events {
+		if e != EventNew && e != EventChanged {
+			return fmt.Errorf("Unknown event type: %s", e)
+		}
+	}
+
+	return nil
+}
+
+// Match returns true if the revision of the object with key matches the filter.
+func (f *Filter) Match(key string, r *Revision) bool {
+	if len(f.Patterns) > 0 && !matchKeyPatterns(f.Patterns, key) {
+		return false
+	}
+
+	if len(f.Events) > 0 {
+		var ok bool
+		e := eventType(r)
+
+		for _, x := range f.Events {
+			if x == e {
+				ok = true
+				break
+			}
+		}
+
+		if !ok {
+			return false
+		}
+	}
+
+	if len(f.Fields) > 0 {
+		for _, p := range f.Fields {
+			if fieldAffected(r, p) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return true
+}
+
+// lookupPath returns the value at the period-delimited path.
+func lookupPath(v interface{}, path []string) (interface{}, bool) {
+	for _, k := range path {
+		var ok bool
+
+		switch m := v.(type) {
+		case map[string]interface{}:
+			v, ok = m[k]
+		case bson.M:
+			v, ok = m[k]
+		case map[interface{}]interface{}:
+			v, ok = m[k]
+		}
+
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return v, true
+}
+
+// fieldAffected returns true if the revision adds, removes, or changes
+// the value at the field path.
+func fieldAffected(r *Revision, field string) bool {
+	toks := strings.Split(field, ".")
+	top, rest := toks[0], toks[1:]
+
+	if v, ok := r.Additions[top]; ok {
+		if _, ok = lookupPath(v, rest); ok {
+			return true
+		}
+	}
+
+	if v, ok := r.Removals[top]; ok {
+		if _, ok = lookupPath(v, rest); ok {
+			return true
+		}
+	}
+
+	if c, ok := r.Changes[top]; ok {
+		// Revisions only record top-level changes so compare the nested values.
+		b, bok := lookupPath(c.Before, rest)
+		a, aok := lookupPath(c.After, rest)
+
+		return bok != aok || !reflect.DeepEqual(b, a)
+	}
+
+	return false
+}
@@ -0,0 +1,77 @@
+package main
+
+import "testing"
+
+func TestFilterMatch(t *testing.T) {
+	added := &Revision{
+		Version: 1,
+		Additions: map[string]interface{}{
+			"name": "Bob",
+			"address": map[string]interface{}{
+				"city": "Philadelphia",
+			},
+		},
+	}
+
+	changed := &Revision{
+		Version: 2,
+		Changes: map[string]Change{
+			"address": {
+				Before: map[string]interface{}{
+					"city":  "Philadelphia",
+					"state": "PA",
+				},
+				After: map[string]interface{}{
+					"city":  "Philadelphia",
+					"state": "NJ",
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		Filter   Filter
+		Key      string
+		Revision *Revision
+		Match    bool
+	}{
+		{Filter{}, "bob", added, true},
+		{Filter{}, "bob", changed, true},
+
+		{Filter{Patterns: []string{"users.*"}}, "users.bob", added, true},
+		{Filter{Patterns: []string{"users.*"}}, "bob", added, false},
+
+		{Filter{Events: []string{EventNew}}, "bob", added, true},
+		{Filter{Events: []string{EventNew}}, "bob", changed, false},
+		{Filter{Events: []string{EventChanged}}, "bob", changed, true},
+
+		{Filter{Fields: []string{"name"}}, "bob", added, true},
+		{Filter{Fields: []string{"address.city"}}, "bob", added, true},
+		{Filter{Fields: []string{"address.city"}}, "bob", changed, false},
+		{Filter{Fields: []string{"address.state"}}, "bob", changed, true},
+		{Filter{Fields: []string{"email"}}, "bob", changed, false},
+	}
+
+	for i, test := range tests {
+		if test.Filter.Match(test.Key, test.Revision) != test.Match {
+			t.Errorf("test %d: expected match to be %v", i, test.Match)
+		}
+	}
+}
+
+func TestFilterValidate(t *testing.T) {
+	f := Filter{
+		Patterns: []string{"billing.*"},
+		Events:   []string{EventNew, EventChanged},
+	}
+
+	if err := f.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	f.Events = []string{"deleted"}
+
+	if err := f.Validate(); err == nil {
+		t.Error("expected error for unknown event")
+	}
+}
@@ -0,0 +1,484 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/labstack/echo"
+)
+
+// graphqlRequest is the body of a GraphQL request.
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+type graphqlContextKey struct{}
+
+// graphqlContext returns the context of the request being resolved or nil
+// if the query is not resolved for a request.
+func graphqlContext(p graphql.ResolveParams) echo.Context {
+	if p.Context == nil {
+		return nil
+	}
+
+	c, _ := p.Context.Value(graphqlContextKey{}).(echo.Context)
+
+	return c
+}
+
+// graphqlObject is an object at a version along with the revisions up to
+// that version. The revisions are redacted for the identity of the request.
+type graphqlObject struct {
+	*Object
+
+	log      []*Revision
+	redacted bool
+}
+
+// newGraphQLObject returns the object at the version or nil if the version
+// does not exist. The URL of the object is the URL of its revision.
+func newGraphQLObject(key string, log []*Revision, o *Object, redacted bool) *graphqlObject {
+	if o == nil {
+		return nil
+	}
+
+	o.Key = key
+
+	var upto []*Revision
+
+	for _, r := range log {
+		if r.Version > o.Version {
+			break
+		}
+
+		o.URL = r.URL
+		upto = append(upto, r)
+	}
+
+	return &graphqlObject{
+		Object:   o,
+		log:      upto,
+		redacted: redacted,
+	}
+}
+
+// selectFields returns a copy of the document with only the fields at the
+// paths, e.g. `name` or `patient.dob`. Missing fields are omitted.
+func selectFields(doc map[string]interface{}, paths []string) map[string]interface{} {
+	sel := make(map[string]interface{})
+
+	for _, p := range paths {
+		parts := strings.Split(p, ".")
+
+		var (
+			v  interface{} = doc
+			ok bool
+		)
+
+		for _, k := range parts {
+			// Nested documents of stored values are bson.M.
+			m, isDoc := asDoc(v)
+
+			if !isDoc {
+				ok = false
+				break
+			}
+
+			if v, ok = m[k]; !ok {
+				break
+			}
+		}
+
+		if !ok {
+			continue
+		}
+
+		dst := sel
+
+		for _, k := range parts[:len(parts)-1] {
+			m, isDoc := dst[k].(map[string]interface{})
+
+			if !isDoc {
+				m = make(map[string]interface{})
+				dst[k] = m
+			}
+
+			dst = m
+		}
+
+		dst[parts[len(parts)-1]] = v
+	}
+
+	return sel
+}
+
+// stringArgs returns the list argument as strings.
+func stringArgs(v interface{}) []string {
+	a, _ := v.([]interface{})
+	s := make([]string, 0, len(a))
+
+	for _, x := range a {
+		if str, ok := x.(string); ok {
+			s = append(s, str)
+		}
+	}
+
+	return s
+}
+
+// lastRevisions returns the last n revisions or all if n is not positive.
+func lastRevisions(log []*Revision, n int) []*Revision {
+	if n > 0 && n < len(log) {
+		return log[len(log)-n:]
+	}
+
+	return log
+}
+
+// withURLs sets the URLs of the revisions.
+func withURLs(cfg *Config, key string, log []*Revision) []*Revision {
+	for _, r := range log {
+		r.URL = cfg.HTTP.VersionURL(key, r.Version)
+	}
+
+	return log
+}
+
+var jsonScalar = graphql.NewScalar(graphql.ScalarConfig{
+	Name:        "JSON",
+	Description: "A JSON value.",
+	Serialize: func(v interface{}) interface{} {
+		return v
+	},
+})
+
+var revisionType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "Revision",
+	Description: "A change to an object.",
+	Fields: graphql.Fields{
+		"version":   &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"time":      &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Description: "Unix time of the revision."},
+		"additions": &graphql.Field{Type: jsonScalar},
+		"removals":  &graphql.Field{Type: jsonScalar},
+		"changes":   &graphql.Field{Type: jsonScalar, Description: "Before and after values of the changed fields."},
+		"author":    &graphql.Field{Type: graphql.String},
+		"hash":      &graphql.Field{Type: graphql.String},
+		"url":       &graphql.Field{Type: graphql.String},
+	},
+})
+
+var objectType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "Object",
+	Description: "The state of an object at a version.",
+	Fields: graphql.Fields{
+		"key": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.String),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*graphqlObject).Key, nil
+			},
+		},
+
+		"value": &graphql.Field{
+			Type:        jsonScalar,
+			Description: "The value, optionally only the fields at the paths.",
+			Args: graphql.FieldConfigArgument{
+				"fields": &graphql.ArgumentConfig{Type: graphql.NewList(graphql.NewNonNull(graphql.String))},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				o := p.Source.(*graphqlObject)
+
+				if f, ok := p.Args["fields"]; ok && f != nil {
+					return selectFields(o.Value, stringArgs(f)), nil
+				}
+
+				return o.Value, nil
+			},
+		},
+
+		"version": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.Int),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*graphqlObject).Version, nil
+			},
+		},
+
+		"time": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.Int),
+			Description: "Unix time of the version.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*graphqlObject).Time, nil
+			},
+		},
+
+		"hash": &graphql.Field{
+			Type:        graphql.String,
+			Description: "Content hash of the value. Null if fields are redacted.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				o := p.Source.(*graphqlObject)
+
+				// The hash of the unredacted value is not returned.
+				if o.redacted || o.Hash == "" {
+					return nil, nil
+				}
+
+				return o.Hash, nil
+			},
+		},
+
+		"url": &graphql.Field{
+			Type: graphql.String,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*graphqlObject).URL, nil
+			},
+		},
+
+		"history": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(revisionType))),
+			Description: "The revisions up to the version, optionally only the last ones.",
+			Args: graphql.FieldConfigArgument{
+				"last": &graphql.ArgumentConfig{Type: graphql.Int},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				o := p.Source.(*graphqlObject)
+				n, _ := p.Args["last"].(int)
+
+				return lastRevisions(o.log, n), nil
+			},
+		},
+	},
+})
+
+var queryType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Query",
+	Fields: graphql.Fields{
+		"object": &graphql.Field{
+			Type:        objectType,
+			Description: "The latest state of an object. Null if it does not exist.",
+			Args: graphql.FieldConfigArgument{
+				"key": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				c := graphqlContext(p)
+				cfg := c.Get("config").(*Config)
+				key := p.Args["key"].(string)
+
+				if !allowed(c, PermRead, key) {
+					err := forbidden(PermRead, key)
+					auditRead(c, OpGet, key, 0, err)
+					return nil, err
+				}
+
+				o, err := get(cfg, key, true)
+
+				if err != nil {
+					auditRead(c, OpGet, key, 0, err)
+					return nil, err
+				}
+
+				if o == nil {
+					auditRead(c, OpGet, key, 0, NotFoundError("Object %s does not exist", key))
+					return nil, nil
+				}
+
+				auditRead(c, OpGet, key, o.Version, nil)
+
+				fields := redactedFields(c)
+				o = redactObject(o, fields)
+
+				return newGraphQLObject(key, withURLs(cfg, key, o.History), o, len(fields) > 0), nil
+			},
+		},
+
+		"log": &graphql.Field{
+			Type:        graphql.NewList(graphql.NewNonNull(revisionType)),
+			Description: "The revisions of an object, optionally only the last ones. Null if it does not exist.",
+			Args: graphql.FieldConfigArgument{
+				"key":  &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				"last": &graphql.ArgumentConfig{Type: graphql.Int},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				c := graphqlContext(p)
+				cfg := c.Get("config").(*Config)
+				key := p.Args["key"].(string)
+				n, _ := p.Args["last"].(int)
+
+				if !allowed(c, PermRead, key) {
+					err := forbidden(PermRead, key)
+					auditRead(c, OpLog, key, 0, err)
+					return nil, err
+				}
+
+				l, err := Log(cfg, key)
+
+				if err != nil {
+					auditRead(c, OpLog, key, 0, err)
+					return nil, err
+				}
+
+				if l == nil {
+					auditRead(c, OpLog, key, 0, NotFoundError("Object %s does not exist", key))
+					return nil, nil
+				}
+
+				auditRead(c, OpLog, key, l[len(l)-1].Version, nil)
+
+				fields := redactedFields(c)
+				l = lastRevisions(l, n)
+
+				for i, r := range l {
+					l[i] = redactRevision(r, fields)
+				}
+
+				return withURLs(cfg, key, l), nil
+			},
+		},
+
+		"keys": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.String))),
+			Description: "The keys of the objects, optionally only those matching the pattern, e.g. billing.*.",
+			Args: graphql.FieldConfigArgument{
+				"pattern": &graphql.ArgumentConfig{Type: graphql.String},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				c := graphqlContext(p)
+				cfg := c.Get("config").(*Config)
+				pat, _ := p.Args["pattern"].(string)
+
+				if pat != "" {
+					if err := checkKeyPattern(pat); err != nil {
+						return nil, ParamError("pattern", err)
+					}
+				}
+
+				keys, err := Keys(cfg)
+
+				if err != nil {
+					return nil, err
+				}
+
+				readable := make([]string, 0, len(keys))
+
+				for _, k := range keys {
+					if pat != "" && !matchKeyPatterns([]string{pat}, k) {
+						continue
+					}
+
+					if allowed(c, PermRead, k) {
+						readable = append(readable, k)
+					}
+				}
+
+				return readable, nil
+			},
+		},
+	},
+})
+
+var graphqlSchema graphql.Schema
+
+func init() {
+	// Fields of objects returning objects are added once the type exists.
+	objectType.AddFieldConfig("atVersion", &graphql.Field{
+		Type:        objectType,
+		Description: "The object at the version. Null if the version does not exist.",
+		Args: graphql.FieldConfigArgument{
+			"version": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			o := p.Source.(*graphqlObject)
+			v := p.Args["version"].(int)
+
+			c := graphqlContext(p)
+
+			if v < 1 || v > o.Version {
+				auditRead(c, OpGet, o.Key, v, NotFoundError("Version %d of %s does not exist", v, o.Key))
+				return nil, nil
+			}
+
+			auditRead(c, OpGet, o.Key, v, nil)
+
+			h := &Object{History: o.log}
+
+			return newGraphQLObject(o.Key, o.log, h.AtVersion(v), o.redacted), nil
+		},
+	})
+
+	objectType.AddFieldConfig("atTime", &graphql.Field{
+		Type:        objectType,
+		Description: "The object at the time (or duration relative to now). Null if it did not exist at the time.",
+		Args: graphql.FieldConfigArgument{
+			"time": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			o := p.Source.(*graphqlObject)
+
+			t, err := ParseTimeString(p.Args["time"].(string))
+
+			if err != nil {
+				return nil, ParamError("time", err)
+			}
+
+			h := &Object{History: o.log}
+			a := h.AtTime(t)
+
+			if a == nil {
+				auditRead(graphqlContext(p), OpGet, o.Key, 0, NotFoundError("%s did not exist at %d", o.Key, t))
+				return nil, nil
+			}
+
+			auditRead(graphqlContext(p), OpGet, o.Key, a.Version, nil)
+
+			return newGraphQLObject(o.Key, o.log, a, o.redacted), nil
+		},
+	})
+
+	var err error
+
+	graphqlSchema, err = graphql.NewSchema(graphql.SchemaConfig{
+		Query: queryType,
+	})
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+// graphqlHandler executes GraphQL queries. Queries are sent as the query
+// parameter of GET requests or in the body of POST requests. Errors
+// resolving fields are returned in the errors of the result.
+func graphqlHandler(c echo.Context) error {
+	var req graphqlRequest
+
+	if c.Request().Method() == echo.GET {
+		req.Query = c.QueryParam("query")
+		req.OperationName = c.QueryParam("operationName")
+
+		if vs := c.QueryParam("variables"); vs != "" {
+			if err := json.Unmarshal([]byte(vs), &req.Variables); err != nil {
+				return ParamError("variables", err)
+			}
+		}
+	} else if err := c.Bind(&req); err != nil {
+		return BodyError(err)
+	}
+
+	if req.Query == "" {
+		return ParamError("query", errors.New("Query is required"))
+	}
+
+	res := graphql.Do(graphql.Params{
+		Schema:         graphqlSchema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        context.WithValue(context.Background(), graphqlContextKey{}, c),
+	})
+
+	return c.JSON(http.StatusOK, res)
+}
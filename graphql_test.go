@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/graphql-go/graphql"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestSelectFields(t *testing.T) {
+	doc := map[string]interface{}{
+		"name": "Bob",
+		"ssn":  "123-45-6789",
+		"patient": bson.M{
+			"dob": "2001-01-01",
+			"mrn": 42.0,
+		},
+	}
+
+	sel := selectFields(doc, []string{"name", "patient.dob", "patient.missing", "name.first"})
+
+	exp := map[string]interface{}{
+		"name": "Bob",
+		"patient": map[string]interface{}{
+			"dob": "2001-01-01",
+		},
+	}
+
+	if !reflect.DeepEqual(sel, exp) {
+		t.Errorf("expected %v, got %v", exp, sel)
+	}
+}
+
+func TestGraphQLObject(t *testing.T) {
+	log := []*Revision{
+		{Version: 1, Time: 100, Additions: map[string]interface{}{"name": "Bob"}, URL: "/objects/bob/v/1"},
+		{Version: 2, Time: 200, Changes: map[string]Change{"name": {Before: "Bob", After: "Bob Smith"}}, URL: "/objects/bob/v/2"},
+		{Version: 3, Time: 300, Additions: map[string]interface{}{"email": "bob@smith.net"}, URL: "/objects/bob/v/3"},
+	}
+
+	latest := (&Object{History: log}).AtTime(300)
+
+	// Serves a fixed object to test the fields of objects.
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"object": &graphql.Field{
+					Type: objectType,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return newGraphQLObject("bob", log, latest, false), nil
+					},
+				},
+			},
+		}),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := graphql.Do(graphql.Params{
+		Schema: schema,
+		RequestString: `{
+			object {
+				key
+				version
+				url
+				value(fields: ["email"])
+				v1: atVersion(version: 1) { version value history { version } }
+				v9: atVersion(version: 9) { version }
+				atTime(time: "250") { version value }
+				history(last: 2) { version url }
+			}
+		}`,
+	})
+
+	if len(res.Errors) > 0 {
+		t.Fatal(res.Errors)
+	}
+
+	b, _ := json.Marshal(res.Data)
+
+	exp := `{"object":{` +
+		`"atTime":{"value":{"name":"Bob Smith"},"version":2},` +
+		`"history":[{"url":"/objects/bob/v/2","version":2},{"url":"/objects/bob/v/3","version":3}],` +
+		`"key":"bob",` +
+		`"url":"/objects/bob/v/3",` +
+		`"v1":{"history":[{"version":1}],"value":{"name":"Bob"},"version":1},` +
+		`"v9":null,` +
+		`"value":{"email":"bob@smith.net"},` +
+		`"version":3}}`
+
+	if string(b) != exp {
+		t.Errorf("expected %s, got %s", exp, b)
+	}
+}
@@ -0,0 +1,636 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/chop-dbhi/scds/scdspb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// pbJSON sets the message from the JSON encoding of the value. Values of
+// objects are decoded from JSON so they convert to structs without loss.
+func pbJSON(v interface{}, m proto.Message) error {
+	b, err := json.Marshal(v)
+
+	if err != nil {
+		return err
+	}
+
+	return protojson.Unmarshal(b, m)
+}
+
+// pbStruct returns the document as a struct or nil if it is nil.
+func pbStruct(doc map[string]interface{}) (*structpb.Struct, error) {
+	if doc == nil {
+		return nil, nil
+	}
+
+	s := new(structpb.Struct)
+
+	return s, pbJSON(doc, s)
+}
+
+// pbValue returns the value of a changed field.
+func pbValue(v interface{}) (*structpb.Value, error) {
+	pv := new(structpb.Value)
+
+	return pv, pbJSON(v, pv)
+}
+
+// pbRevision returns the revision as a message or nil if it is nil.
+func pbRevision(r *Revision) (*scdspb.Revision, error) {
+	if r == nil {
+		return nil, nil
+	}
+
+	var err error
+
+	m := &scdspb.Revision{
+		Version: int64(r.Version),
+		Time:    r.Time,
+		Author:  r.Author,
+		Hash:    r.Hash,
+		Url:     r.URL,
+	}
+
+	if m.Additions, err = pbStruct(r.Additions); err != nil {
+		return nil, err
+	}
+
+	if m.Removals, err = pbStruct(r.Removals); err != nil {
+		return nil, err
+	}
+
+	if r.Changes != nil {
+		m.Changes = make(map[string]*scdspb.Change, len(r.Changes))
+
+		for k, chg := range r.Changes {
+			c := new(scdspb.Change)
+
+			if c.Before, err = pbValue(chg.Before); err != nil {
+				return nil, err
+			}
+
+			if c.After, err = pbValue(chg.After); err != nil {
+				return nil, err
+			}
+
+			m.Changes[k] = c
+		}
+	}
+
+	return m, nil
+}
+
+// pbObject returns the object as a message. The history is not included.
+func pbObject(o *Object) (*scdspb.Object, error) {
+	v, err := pbStruct(o.Value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &scdspb.Object{
+		Key:     o.Key,
+		Value:   v,
+		Version: int64(o.Version),
+		Time:    o.Time,
+		Hash:    o.Hash,
+		Url:     o.URL,
+	}, nil
+}
+
+// grpcCodes are the gRPC codes of errors by HTTP status.
+var grpcCodes = map[int]codes.Code{
+	http.StatusBadRequest:          codes.InvalidArgument,
+	http.StatusUnauthorized:        codes.Unauthenticated,
+	http.StatusForbidden:           codes.PermissionDenied,
+	http.StatusNotFound:            codes.NotFound,
+	http.StatusConflict:            codes.Aborted,
+	StatusUnprocessableEntity:      codes.InvalidArgument,
+	http.StatusInternalServerError: codes.Internal,
+}
+
+// grpcError returns the error as a gRPC status error. The cause of internal
+// errors is logged instead of returned.
+func grpcError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	// Already a status error.
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	e := AsError(err)
+
+	code, ok := grpcCodes[e.Status]
+
+	if !ok {
+		code = codes.Unknown
+	}
+
+	if code == codes.Internal {
+		log.Printf("[grpc] %s", err)
+		return status.Error(code, e.Message)
+	}
+
+	return status.Error(code, e.Error())
+}
+
+type identityKey struct{}
+
+// grpcIdentity returns the identity of the call or nil if it is not
+// authenticated.
+func grpcIdentity(ctx context.Context) *Identity {
+	id, _ := ctx.Value(identityKey{}).(*Identity)
+	return id
+}
+
+// grpcClient returns the address of the caller.
+func grpcClient(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return p.Addr.String()
+	}
+
+	return ""
+}
+
+// grpcAuthenticate returns the context with the identity of the credentials
+// in the authorization metadata. Calls must be authenticated if
+// authentication is enabled.
+func grpcAuthenticate(ctx context.Context, cfg *Config) (context.Context, error) {
+	var header string
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get("authorization"); len(v) > 0 {
+			header = v[0]
+		}
+	}
+
+	id, err := authenticateHeader(cfg, header)
+
+	// Credentials are optional if authentication is disabled, but
+	// are still used to identify the author of revisions.
+	if err != nil && !cfg.Auth.Enabled {
+		return ctx, nil
+	}
+
+	if err != nil {
+		RecordAudit(cfg, &AuditEntry{
+			Operation: OpAuthenticate,
+			Client:    grpcClient(ctx),
+			Outcome:   AuditDenied,
+			Error:     err.Error(),
+		})
+
+		return nil, status.Errorf(codes.Unauthenticated, "Authentication required: %s", err)
+	}
+
+	id.Roles = append(id.Roles, cfg.Auth.Identities[id.Name]...)
+
+	return context.WithValue(ctx, identityKey{}, id), nil
+}
+
+// grpcStream overrides the context of a stream.
+type grpcStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *grpcStream) Context() context.Context {
+	return s.ctx
+}
+
+// grpcServer implements the methods of the gRPC service.
+type grpcServer struct {
+	scdspb.UnimplementedSCDSServer
+
+	cfg *Config
+}
+
+func (s *grpcServer) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := grpcAuthenticate(ctx, s.cfg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+func (s *grpcServer) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := grpcAuthenticate(ss.Context(), s.cfg)
+
+	if err != nil {
+		return err
+	}
+
+	return handler(srv, &grpcStream{ss, ctx})
+}
+
+// audit records the operation of the call.
+func (s *grpcServer) audit(ctx context.Context, op, key string, version int, err error) {
+	e := AuditEntry{
+		Operation: op,
+		Key:       key,
+		Version:   version,
+		Client:    grpcClient(ctx),
+		Outcome:   AuditOK,
+	}
+
+	if id := grpcIdentity(ctx); id != nil {
+		e.Identity = id.Name
+	}
+
+	if err != nil {
+		e.Outcome = auditOutcome(AsError(err).Status)
+		e.Error = err.Error()
+	}
+
+	RecordAudit(s.cfg, &e)
+}
+
+// allowed returns true if the identity of the call has the permission on
+// the key.
+func (s *grpcServer) allowed(ctx context.Context, perm, key string) bool {
+	return s.cfg.Auth.Allowed(grpcIdentity(ctx), perm, key)
+}
+
+func (s *grpcServer) put(ctx context.Context, req *scdspb.PutRequest) (*scdspb.Revision, error) {
+	if !s.allowed(ctx, PermWrite, req.Key) {
+		return nil, forbidden(PermWrite, req.Key)
+	}
+
+	var author string
+
+	if id := grpcIdentity(ctx); id != nil {
+		author = id.Name
+	}
+
+	r, err := PutAs(s.cfg, author, req.Key, req.Value.AsMap())
+
+	if err != nil || r == nil {
+		return nil, err
+	}
+
+	r.URL = s.cfg.HTTP.VersionURL(req.Key, r.Version)
+
+	return pbRevision(redactRevision(r, identityRedactedFields(s.cfg, grpcIdentity(ctx))))
+}
+
+// Put puts the value of an object.
+func (s *grpcServer) Put(ctx context.Context, req *scdspb.PutRequest) (*scdspb.PutResponse, error) {
+	r, err := s.put(ctx, req)
+
+	s.audit(ctx, OpPut, req.Key, int(r.GetVersion()), err)
+
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return &scdspb.PutResponse{Revision: r}, nil
+}
+
+// BatchPut puts the values of the objects streamed by the client. The batch
+// stops at the first failed put; the puts before it are kept.
+func (s *grpcServer) BatchPut(stream scdspb.SCDS_BatchPutServer) error {
+	ctx := stream.Context()
+
+	var res scdspb.BatchPutResponse
+
+	for {
+		req, err := stream.Recv()
+
+		if err == io.EOF {
+			return stream.SendAndClose(&res)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		r, err := s.put(ctx, req)
+
+		s.audit(ctx, OpPut, req.Key, int(r.GetVersion()), err)
+
+		if err != nil {
+			st, _ := status.FromError(grpcError(err))
+			return status.Errorf(st.Code(), "%s: %s", req.Key, st.Message())
+		}
+
+		if r == nil {
+			res.Unchanged++
+		} else {
+			res.Changed++
+		}
+	}
+}
+
+func (s *grpcServer) get(ctx context.Context, req *scdspb.GetRequest) (*Object, error) {
+	if !s.allowed(ctx, PermRead, req.Key) {
+		return nil, forbidden(PermRead, req.Key)
+	}
+
+	var (
+		t   int64
+		err error
+	)
+
+	if req.Time != "" {
+		if t, err = ParseTimeString(req.Time); err != nil {
+			return nil, ParamError("time", err)
+		}
+	}
+
+	if req.Version < 0 {
+		return nil, ParamError("version", fmt.Errorf("Version must be a positive integer: %d", req.Version))
+	}
+
+	version := int(req.Version)
+
+	o, err := get(s.cfg, req.Key, version > 0 || t > 0)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if o == nil {
+		return nil, NotFoundError("Object %s does not exist", req.Key)
+	}
+
+	if version > o.Version {
+		return nil, NotFoundError("Version %d of %s does not exist", version, req.Key)
+	}
+
+	if version > 0 {
+		o = o.AtVersion(version)
+	} else if t > 0 {
+		if o = o.AtTime(t); o == nil {
+			return nil, NotFoundError("Object %s did not exist at %s", req.Key, req.Time)
+		}
+	}
+
+	o.History = nil
+	o.URL = s.cfg.HTTP.VersionURL(req.Key, o.Version)
+
+	return redactObject(o, identityRedactedFields(s.cfg, grpcIdentity(ctx))), nil
+}
+
+// Get gets the state of an object.
+func (s *grpcServer) Get(ctx context.Context, req *scdspb.GetRequest) (*scdspb.Object, error) {
+	o, err := s.get(ctx, req)
+
+	var version int
+
+	if o != nil {
+		version = o.Version
+	}
+
+	s.audit(ctx, OpGet, req.Key, version, err)
+
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	m, err := pbObject(o)
+
+	return m, grpcError(err)
+}
+
+func (s *grpcServer) log(ctx context.Context, req *scdspb.LogRequest) ([]*Revision, error) {
+	if !s.allowed(ctx, PermRead, req.Key) {
+		return nil, forbidden(PermRead, req.Key)
+	}
+
+	l, err := Log(s.cfg, req.Key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if l == nil {
+		return nil, NotFoundError("Object %s does not exist", req.Key)
+	}
+
+	fields := identityRedactedFields(s.cfg, grpcIdentity(ctx))
+
+	for i, r := range l {
+		r.URL = s.cfg.HTTP.VersionURL(req.Key, r.Version)
+		l[i] = redactRevision(r, fields)
+	}
+
+	return l, nil
+}
+
+// Log gets the revisions of an object.
+func (s *grpcServer) Log(ctx context.Context, req *scdspb.LogRequest) (*scdspb.LogResponse, error) {
+	l, err := s.log(ctx, req)
+
+	var version int
+
+	if len(l) > 0 {
+		version = l[len(l)-1].Version
+	}
+
+	s.audit(ctx, OpLog, req.Key, version, err)
+
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	res := &scdspb.LogResponse{
+		Revisions: make([]*scdspb.Revision, len(l)),
+	}
+
+	for i, r := range l {
+		if res.Revisions[i], err = pbRevision(r); err != nil {
+			return nil, grpcError(err)
+		}
+	}
+
+	return res, nil
+}
+
+// Keys gets the keys of the objects the identity can read.
+func (s *grpcServer) Keys(ctx context.Context, req *scdspb.KeysRequest) (*scdspb.KeysResponse, error) {
+	keys, err := Keys(s.cfg)
+
+	s.audit(ctx, OpKeys, "", 0, err)
+
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	readable := make([]string, 0, len(keys))
+
+	for _, k := range keys {
+		if s.allowed(ctx, PermRead, k) {
+			readable = append(readable, k)
+		}
+	}
+
+	return &scdspb.KeysResponse{Keys: readable}, nil
+}
+
+func (s *grpcServer) watch(req *scdspb.WatchRequest, stream scdspb.SCDS_WatchServer) error {
+	ctx := stream.Context()
+
+	var (
+		err    error
+		cursor Cursor
+	)
+
+	if req.Since != "" {
+		if cursor, err = ParseSince(req.Since); err != nil {
+			return ParamError("since", err)
+		}
+	} else {
+		// Only stream new changes.
+		cursor = Cursor{Time: time.Now().UTC().Unix()}
+	}
+
+	for _, p := range req.Keys {
+		if err = checkKeyPattern(p); err != nil {
+			return ParamError("keys", err)
+		}
+	}
+
+	fields := identityRedactedFields(s.cfg, grpcIdentity(ctx))
+
+	wake := s.cfg.broker.Subscribe()
+	defer s.cfg.broker.Unsubscribe(wake)
+
+	poll := time.NewTicker(streamPoll)
+	defer poll.Stop()
+
+	var (
+		events []*Event
+		r      *scdspb.Revision
+	)
+
+	for {
+		// Read until caught up.
+		for {
+			events, cursor, err = ChangesSince(s.cfg, cursor, defaultChangesLimit)
+
+			if err != nil {
+				return err
+			}
+
+			for _, e := range events {
+				if len(req.Keys) > 0 && !matchKeyPatterns(req.Keys, e.Key) {
+					continue
+				}
+
+				if !s.allowed(ctx, PermRead, e.Key) {
+					continue
+				}
+
+				e.Revision.URL = s.cfg.HTTP.VersionURL(e.Key, e.Revision.Version)
+
+				if r, err = pbRevision(redactRevision(e.Revision, fields)); err != nil {
+					return err
+				}
+
+				err = stream.Send(&scdspb.Event{
+					Key:      e.Key,
+					Revision: r,
+					Cursor:   e.Cursor().String(),
+				})
+
+				if err != nil {
+					return nil
+				}
+
+				s.audit(ctx, OpStream, e.Key, e.Revision.Version, nil)
+			}
+
+			if len(events) < defaultChangesLimit {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case <-wake:
+		case <-poll.C:
+		}
+	}
+}
+
+// Watch streams revisions of the objects as they occur.
+func (s *grpcServer) Watch(req *scdspb.WatchRequest, stream scdspb.SCDS_WatchServer) error {
+	err := s.watch(req, stream)
+
+	s.audit(stream.Context(), OpStream, "", 0, err)
+
+	return grpcError(err)
+}
+
+func runGRPC(cfg *Config) {
+	s := &grpcServer{
+		cfg: cfg,
+	}
+
+	opts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(s.unaryInterceptor),
+		grpc.StreamInterceptor(s.streamInterceptor),
+	}
+
+	if cfg.GRPC.TLSKey != "" {
+		creds, err := credentials.NewServerTLSFromFile(cfg.GRPC.TLSCert, cfg.GRPC.TLSKey)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		opts = append(opts, grpc.Creds(creds))
+	}
+
+	cfg.broker = &Broker{}
+
+	// Deliver queued notifications in the background.
+	if cfg.Notify.Workers > 0 {
+		go RunWorkers(cfg, cfg.Notify.Workers, nil)
+	}
+
+	srv := grpc.NewServer(opts...)
+	scdspb.RegisterSCDSServer(srv, s)
+
+	if !cfg.Auth.Enabled {
+		log.Print("* [grpc] Authentication is disabled")
+	}
+
+	addr := cfg.GRPC.Addr()
+
+	ln, err := net.Listen("tcp", addr)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("* [grpc] Listening on %s", addr)
+
+	if err = srv.Serve(ln); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/chop-dbhi/scds/scdspb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestGRPCError(t *testing.T) {
+	tests := []struct {
+		Err  error
+		Code codes.Code
+	}{
+		{ErrInvalidKey("a b"), codes.InvalidArgument},
+		{NotFoundError("Object %s does not exist", "bob"), codes.NotFound},
+		{forbidden(PermRead, "bob"), codes.PermissionDenied},
+		{ConflictError("bob was modified concurrently"), codes.Aborted},
+		{ResultErrors{}, codes.InvalidArgument},
+		{errors.New("connection refused"), codes.Internal},
+		{status.Error(codes.Unauthenticated, "Authentication required"), codes.Unauthenticated},
+	}
+
+	for _, test := range tests {
+		if c := status.Code(grpcError(test.Err)); c != test.Code {
+			t.Errorf("%s: expected code %v, got %v", test.Err, test.Code, c)
+		}
+	}
+
+	// Causes of internal errors are not returned.
+	if s, _ := status.FromError(grpcError(errors.New("connection refused"))); s.Message() != "Internal server error" {
+		t.Errorf("expected generic message, got %s", s.Message())
+	}
+}
+
+func TestGRPCAuthenticate(t *testing.T) {
+	c := &Config{
+		Auth: AuthConfig{
+			Enabled:    true,
+			Tokens:     map[string]string{"billing": "abc123"},
+			Identities: map[string][]string{"billing": {"billing"}},
+		},
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer abc123"))
+
+	ctx, err := grpcAuthenticate(ctx, c)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id := grpcIdentity(ctx); id == nil || id.Name != "billing" || len(id.Roles) != 1 {
+		t.Errorf("expected billing identity, got %v", id)
+	}
+
+	// Credentials are optional if authentication is disabled.
+	c.Auth.Enabled = false
+
+	if ctx, err = grpcAuthenticate(context.Background(), c); err != nil || grpcIdentity(ctx) != nil {
+		t.Errorf("expected anonymous call, got %v (%v)", grpcIdentity(ctx), err)
+	}
+}
+
+func TestGRPCGetNegativeVersion(t *testing.T) {
+	s := &grpcServer{cfg: &Config{}}
+
+	_, err := s.get(context.Background(), &scdspb.GetRequest{Key: "bob", Version: -1})
+
+	if c := status.Code(grpcError(err)); c != codes.InvalidArgument {
+		t.Errorf("expected code %v, got %v (%v)", codes.InvalidArgument, c, err)
+	}
+}
+
+func TestPBRevision(t *testing.T) {
+	r := &Revision{
+		Version:   2,
+		Time:      100,
+		Additions: map[string]interface{}{"dob": "2001-01-01", "patient": bson.M{"mrn": 42}},
+		Changes:   map[string]Change{"name": {Before: "Bob", After: "Bob Smith"}},
+		Author:    "billing",
+	}
+
+	m, err := pbRevision(r)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Version != 2 || m.Time != 100 || m.Author != "billing" {
+		t.Errorf("unexpected revision %v", m)
+	}
+
+	exp := map[string]interface{}{"dob": "2001-01-01", "patient": map[string]interface{}{"mrn": 42.0}}
+
+	if a := m.Additions.AsMap(); !reflect.DeepEqual(a, exp) {
+		t.Errorf("expected additions %v, got %v", exp, a)
+	}
+
+	if m.Removals != nil {
+		t.Errorf("expected no removals, got %v", m.Removals)
+	}
+
+	if c := m.Changes["name"]; c.Before.GetStringValue() != "Bob" || c.After.GetStringValue() != "Bob Smith" {
+		t.Errorf("unexpected change %v", c)
+	}
+}
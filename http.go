@@ -1,9 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/labstack/echo"
 	"github.com/labstack/echo/engine"
@@ -15,23 +22,202 @@ import (
 
 const StatusUnprocessableEntity = 422
 
+// streamPath is the path of the event stream. EventSource cannot set
+// headers so the stream accepts the token as a query parameter.
+const streamPath = "/changes/stream"
+
+// route is an endpoint of the HTTP API. Routes are registered and described
+// in the OpenAPI document from the same table so the two stay in sync.
+type route struct {
+	Method  string
+	Path    string
+	Handler echo.HandlerFunc
+
+	// Audited operation and the permission required on the key.
+	Op   string
+	Perm string
+
+	Summary string
+
+	// Query parameters, the schema of the request body, and the success
+	// status and schema of the response.
+	Query    []*queryParam
+	Body     string
+	Status   int
+	Response string
+}
+
+type queryParam struct {
+	Name        string
+	Type        string
+	Description string
+}
+
+func apiRoutes() []*route {
+	var (
+		limit = &queryParam{"limit", "integer", "Maximum number of entries to return."}
+		since = &queryParam{"since", "string", "Time (or duration relative to now) or cursor to read after."}
+	)
+
+	return []*route{
+		{Method: echo.GET, Path: "/", Handler: rootHandler,
+			Summary: "Returns the name and version of the service.", Status: http.StatusOK, Response: "Info"},
+		{Method: echo.GET, Path: "/openapi.json", Handler: openapiHandler,
+			Summary: "Returns the OpenAPI document of the API.", Status: http.StatusOK},
+
+		{Method: echo.GET, Path: "/subscribers", Handler: getSubscribersHandler, Op: OpSubscribers, Perm: PermAdmin,
+			Summary: "Returns the subscribers.", Status: http.StatusOK, Response: "[]Subscriber"},
+		{Method: echo.POST, Path: "/subscribers", Handler: addSubscribersHandler, Op: OpSubscribe, Perm: PermAdmin,
+			Summary: "Subscribes emails. Subscribers must confirm their subscription.", Body: "Subscribe", Status: http.StatusOK, Response: "Subscribed"},
+		{Method: echo.DELETE, Path: "/subscriber/:token", Handler: deleteSubscriberHandler, Op: OpUnsubscribe, Perm: PermAdmin,
+			Summary: "Removes a subscriber by id or token.", Status: http.StatusOK},
+
+		// Links in subscriber emails.
+		{Method: echo.GET, Path: "/confirm/:token", Handler: confirmHandler, Op: OpConfirm,
+			Summary: "Confirms a subscription.", Status: http.StatusOK},
+		{Method: echo.GET, Path: "/unsubscribe/:token", Handler: unsubscribePageHandler,
+			Summary: "Returns a page to confirm unsubscribing using the link in notification emails.", Status: http.StatusOK},
+		{Method: echo.POST, Path: "/unsubscribe/:token", Handler: unsubscribeHandler, Op: OpUnsubscribe,
+			Summary: "Unsubscribes. Used by the unsubscribe page and one-click unsubscribe in mail clients.", Status: http.StatusOK},
+
+		{Method: echo.GET, Path: "/webhooks", Handler: getWebhooksHandler, Op: OpWebhooks, Perm: PermAdmin,
+			Summary: "Returns the registered webhooks.", Status: http.StatusOK, Response: "[]Webhook"},
+		{Method: echo.POST, Path: "/webhooks", Handler: addWebhookHandler, Op: OpWebhookAdd, Perm: PermAdmin,
+			Summary: "Registers a webhook.", Body: "Webhook", Status: http.StatusCreated, Response: "Webhook"},
+		{Method: echo.DELETE, Path: "/webhook/:id", Handler: deleteWebhookHandler, Op: OpWebhookRemove, Perm: PermAdmin,
+			Summary: "Removes a webhook.", Status: http.StatusOK},
+		{Method: echo.GET, Path: "/webhook/:id/deliveries", Handler: webhookDeliveriesHandler, Op: OpWebhookLog, Perm: PermAdmin,
+			Summary: "Returns the delivery log of a webhook.", Query: []*queryParam{limit}, Status: http.StatusOK, Response: "[]Delivery"},
+
+		{Method: echo.PUT, Path: "/objects/:key", Handler: putHandler, Op: OpPut, Perm: PermWrite,
+			Summary: "Puts an object. Responds with 204 if the value did not change.", Body: "Value", Status: http.StatusOK, Response: "Revision"},
+		{Method: echo.GET, Path: "/objects/:key", Handler: getHandler, Op: OpGet, Perm: PermRead,
+			Summary: "Gets the latest state of an object.", Status: http.StatusOK, Response: "Object"},
+		{Method: echo.HEAD, Path: "/objects/:key", Handler: headHandler, Op: OpGet, Perm: PermRead,
+			Summary: "Checks the content hash of an object. Responds with 412 if the hash does not match.",
+			Query:   []*queryParam{{"hash", "string", "Content hash to compare."}}, Status: http.StatusOK},
+		{Method: echo.GET, Path: "/objects/:key/v/:version", Handler: getHandler, Op: OpGet, Perm: PermRead,
+			Summary: "Gets the state of an object at the version.", Status: http.StatusOK, Response: "Object"},
+		{Method: echo.GET, Path: "/objects/:key/t/:time", Handler: getHandler, Op: OpGet, Perm: PermRead,
+			Summary: "Gets the state of an object at the time.", Status: http.StatusOK, Response: "Object"},
+
+		{Method: echo.GET, Path: "/log/:key", Handler: logHandler, Op: OpLog, Perm: PermRead,
+			Summary: "Returns the revisions of an object.", Status: http.StatusOK, Response: "[]Revision"},
+
+		// Filtered to the readable keys.
+		{Method: echo.GET, Path: "/keys", Handler: keysHandler, Op: OpKeys,
+			Summary: "Returns the keys of the objects.", Status: http.StatusOK, Response: "[]string"},
+		{Method: echo.GET, Path: "/changes", Handler: changesHandler, Op: OpChanges,
+			Summary: "Returns revisions across all objects since a point in time.",
+			Query:   []*queryParam{since, limit}, Status: http.StatusOK, Response: "Changes"},
+		{Method: echo.GET, Path: streamPath, Handler: streamHandler, Op: OpStream,
+			Summary: "Streams revisions as server-sent events.",
+			Query: []*queryParam{
+				since,
+				{"keys", "string", "Comma-separated key patterns."},
+				{"access_token", "string", "Token for clients that cannot set headers."},
+			}, Status: http.StatusOK},
+
+		// Fields are authorized and redacted as they are resolved.
+		{Method: echo.GET, Path: "/graphql", Handler: graphqlHandler, Op: OpGraphQL,
+			Summary: "Executes a GraphQL query.",
+			Query: []*queryParam{
+				{"query", "string", "GraphQL query."},
+				{"operationName", "string", "Operation to execute if the query has several."},
+				{"variables", "string", "JSON-encoded variables of the query."},
+			}, Status: http.StatusOK, Response: "GraphQLResult"},
+		{Method: echo.POST, Path: "/graphql", Handler: graphqlHandler, Op: OpGraphQL,
+			Summary: "Executes a GraphQL query.", Body: "GraphQLRequest", Status: http.StatusOK, Response: "GraphQLResult"},
+
+		{Method: echo.GET, Path: "/notifications/status", Handler: notificationStatusHandler, Op: OpNotifyStatus, Perm: PermAdmin,
+			Summary: "Returns the state of the notification queue.", Status: http.StatusOK},
+
+		{Method: echo.GET, Path: "/audit", Handler: auditHandler, Op: OpAudit, Perm: PermAdmin,
+			Summary: "Returns the audit log.",
+			Query: []*queryParam{
+				{"identity", "string", "Identity that performed the operations."},
+				{"operation", "string", "Operation, e.g. get or put."},
+				{"key", "string", "Key the operations were performed on."},
+				since,
+				limit,
+			}, Status: http.StatusOK, Response: "[]AuditEntry"},
+	}
+}
+
+// hideQueryParam returns the URI with the value of the query parameter
+// replaced so it can be logged.
+func hideQueryParam(uri, name string) string {
+	i := strings.IndexByte(uri, '?')
+
+	if i < 0 {
+		return uri
+	}
+
+	params := strings.Split(uri[i+1:], "&")
+
+	for j, p := range params {
+		k := p
+
+		if n := strings.IndexByte(p, '='); n >= 0 {
+			k = p[:n]
+		}
+
+		if k, err := url.QueryUnescape(k); err == nil && k == name {
+			params[j] = name + "=REDACTED"
+		}
+	}
+
+	return uri[:i+1] + strings.Join(params, "&")
+}
+
+// hideAccessToken removes access tokens from the URI of the request before
+// it is logged. The token is still read from the query parameters.
+func hideAccessToken(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+
+		if strings.Contains(req.URI(), "access_token") {
+			req.SetURI(hideQueryParam(req.URI(), "access_token"))
+		}
+
+		return next(c)
+	}
+}
+
 func runHTTP(cfg *Config) {
 	app := echo.New()
 
 	app.SetDebug(cfg.Debug)
+	app.SetHTTPErrorHandler(httpErrorHandler)
 
 	app.Pre(mw.RemoveTrailingSlash())
+	app.Pre(hideAccessToken)
 	app.Use(mw.Logger())
 	app.Use(mw.Recover())
 
-	app.Use(mw.GzipWithConfig(mw.GzipConfig{
+	gzip := mw.GzipWithConfig(mw.GzipConfig{
 		Level: 5,
-	}))
+	})
+
+	// Event streams are flushed as events occur which compression defeats.
+	app.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		zipped := gzip(next)
+
+		return func(c echo.Context) error {
+			if c.Request().URL().Path() == streamPath {
+				return next(c)
+			}
+
+			return zipped(c)
+		}
+	})
 
 	if cfg.HTTP.CORS {
 		app.Use(mw.CORS())
 	}
 
+	cfg.broker = &Broker{}
+
 	app.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			c.Set("config", cfg)
@@ -39,20 +225,32 @@ func runHTTP(cfg *Config) {
 		}
 	})
 
-	app.Get("/", rootHandler)
+	if !cfg.Auth.Enabled {
+		log.Print("* [http] Authentication is disabled")
+	}
+
+	app.Use(authMiddleware)
 
-	app.Get("/keys", keysHandler)
+	for _, r := range apiRoutes() {
+		var m []echo.MiddlewareFunc
+
+		// Operations are audited before authorization so denials are
+		// recorded.
+		if r.Op != "" {
+			m = append(m, audit(r.Op))
+		}
 
-	app.Get("/subscribers", getSubscribersHandler)
-	app.Post("/subscribers", addSubscribersHandler)
-	app.Delete("/subscriber/:token", deleteSubscriberHandler)
+		if r.Perm != "" {
+			m = append(m, requirePerm(r.Perm))
+		}
 
-	app.Put("/objects/:key", putHandler)
-	app.Get("/objects/:key", getHandler)
-	app.Get("/objects/:key/v/:version", getHandler)
-	app.Get("/objects/:key/t/:time", getHandler)
+		app.Match([]string{r.Method}, r.Path, r.Handler, m...)
+	}
 
-	app.Get("/log/:key", logHandler)
+	// Deliver queued notifications in the background.
+	if cfg.Notify.Workers > 0 {
+		go RunWorkers(cfg, cfg.Notify.Workers, nil)
+	}
 
 	addr := cfg.HTTP.Addr()
 	log.Printf("* [http] Listening on %s", addr)
@@ -61,7 +259,17 @@ func runHTTP(cfg *Config) {
 		Address: addr,
 	}
 
-	if cfg.HTTP.TLSKey != "" {
+	// Client certificates are verified by a listener configured here
+	// since the engine does not support it.
+	if cfg.HTTP.ClientCA != "" {
+		ln, err := cfg.HTTP.Listener()
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		ecfg.Listener = ln
+	} else if cfg.HTTP.TLSKey != "" {
 		ecfg.TLSCertFile = cfg.HTTP.TLSCert
 		ecfg.TLSKeyFile = cfg.HTTP.TLSKey
 	}
@@ -80,20 +288,16 @@ func putHandler(c echo.Context) error {
 	var val map[string]interface{}
 
 	if err := c.Bind(&val); err != nil {
-		return err
+		return BodyError(err)
 	}
 
 	cfg := c.Get("config").(*Config)
 
 	key := c.Param("key")
-	obj, err := Put(cfg, key, val)
+	obj, err := PutAs(cfg, identityName(c), key, val)
 
+	// Validation errors are details of the error response.
 	if err != nil {
-		// Failed validation.
-		if errs, ok := err.(ResultErrors); ok {
-			return c.JSON(StatusUnprocessableEntity, errs)
-		}
-
 		return err
 	}
 
@@ -102,6 +306,23 @@ func putHandler(c echo.Context) error {
 		return c.NoContent(http.StatusNoContent)
 	}
 
+	auditEntry(c).Version = obj.Version
+
+	obj.URL = cfg.HTTP.VersionURL(key, obj.Version)
+
+	hash := obj.Hash
+
+	// The redacted value is a different representation.
+	if fields := redactedFields(c); len(fields) > 0 {
+		if hash, err = cfg.Encryption.ContentHash(redactDoc(val, fields)); err != nil {
+			return err
+		}
+
+		obj = redactRevision(obj, fields)
+	}
+
+	c.Response().Header().Set("ETag", etag(hash))
+
 	return c.JSON(http.StatusOK, obj)
 }
 
@@ -114,7 +335,15 @@ func keysHandler(c echo.Context) error {
 		return err
 	}
 
-	return c.JSON(http.StatusOK, keys)
+	readable := make([]string, 0, len(keys))
+
+	for _, k := range keys {
+		if allowed(c, PermRead, k) {
+			readable = append(readable, k)
+		}
+	}
+
+	return c.JSON(http.StatusOK, readable)
 }
 
 func getHandler(c echo.Context) error {
@@ -131,46 +360,167 @@ func getHandler(c echo.Context) error {
 		return err
 	}
 
+	// Does not exist.
+	if obj == nil {
+		return NotFoundError("Object %s does not exist", key)
+	}
+
 	if vs != "" {
 		v, err := strconv.Atoi(vs)
 
-		// Invalid parameter for version, treat as a 404.
-		if err != nil {
-			return c.NoContent(http.StatusNotFound)
+		if err != nil || v < 1 {
+			return ParamError("version", fmt.Errorf("Version must be a positive integer: %s", vs))
 		}
 
 		// Version is greater than what is available.
-		if v > obj.Version || v < 0 {
-			return c.NoContent(http.StatusNotFound)
+		if v > obj.Version {
+			return NotFoundError("Version %d of %s does not exist", v, key)
 		}
 
 		obj = obj.AtVersion(v)
 	} else if ts != "" {
 		t, err := ParseTimeString(ts)
 
-		// Invalid parameter for version, treat as a 404.
 		if err != nil {
-			return c.NoContent(http.StatusNotFound)
+			return ParamError("time", err)
 		}
 
 		obj = obj.AtTime(t)
 
 		if obj == nil {
-			return c.NoContent(http.StatusNotFound)
+			return NotFoundError("Object %s did not exist at %s", key, ts)
 		}
 	}
 
-	// Does not exist.
-	if obj == nil {
-		return c.NoContent(http.StatusNoContent)
-	}
-
 	// Do not include history in output.
 	obj.History = nil
 
+	auditEntry(c).Version = obj.Version
+
+	obj.URL = cfg.HTTP.VersionURL(key, obj.Version)
+
+	obj, hash, err := representation(c, obj)
+
+	if err != nil {
+		return err
+	}
+
+	if notModified(c, etag(hash), obj.Time) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
 	return c.JSON(http.StatusOK, obj)
 }
 
+// representation returns the object as it is represented to the identity of
+// the request and its content hash. The redacted value is a different
+// representation and its hash does not reveal the redacted values.
+func representation(c echo.Context, obj *Object) (*Object, string, error) {
+	cfg := c.Get("config").(*Config)
+	fields := redactedFields(c)
+
+	if len(fields) == 0 {
+		hash, err := obj.ValueHash(&cfg.Encryption)
+		return obj, hash, err
+	}
+
+	obj = redactObject(obj, fields)
+
+	hash, err := cfg.Encryption.ContentHash(obj.Value)
+
+	return obj, hash, err
+}
+
+// etag returns the ETag header value of a content hash.
+func etag(hash string) string {
+	return `"` + hash + `"`
+}
+
+// notModified sets the ETag and Last-Modified headers of the response and
+// returns true if the conditional headers of the request match them, i.e.
+// the client has the current representation.
+func notModified(c echo.Context, tag string, modified int64) bool {
+	cfg := c.Get("config").(*Config)
+	h := c.Response().Header()
+
+	h.Set("ETag", tag)
+	h.Set("Last-Modified", time.Unix(modified, 0).UTC().Format(http.TimeFormat))
+
+	// Representations depend on the identity.
+	if cfg.Auth.Enabled {
+		h.Set("Vary", "Authorization")
+	}
+
+	// Identities may also be client certificates, which shared caches do
+	// not vary on.
+	if len(cfg.Redact.Rules) > 0 {
+		h.Set("Cache-Control", "private")
+	}
+
+	req := c.Request().Header()
+
+	// If-None-Match takes precedence over If-Modified-Since.
+	if inm := req.Get("If-None-Match"); inm != "" {
+		return matchETag(inm, tag)
+	}
+
+	if ims := req.Get("If-Modified-Since"); ims != "" {
+		t, err := http.ParseTime(ims)
+		return err == nil && modified <= t.Unix()
+	}
+
+	return false
+}
+
+// matchETag returns true if the If-None-Match header value matches the tag.
+// Weak tags are compared as strong ones.
+func matchETag(inm, tag string) bool {
+	for _, t := range strings.Split(inm, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+
+		if t == "*" || t == tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// headHandler responds with the content hash of the object as the ETag. If
+// the hash parameter is set, the response is 412 Precondition Failed if it
+// does not match so clients can check if their copy is current without
+// sending it. The hash is of the representation returned by GET so redacted
+// values cannot be guessed.
+func headHandler(c echo.Context) error {
+	cfg := c.Get("config").(*Config)
+
+	obj, err := get(cfg, c.Param("key"), false)
+
+	if err != nil {
+		return err
+	}
+
+	if obj == nil {
+		return NotFoundError("Object %s does not exist", c.Param("key"))
+	}
+
+	_, hash, err := representation(c, obj)
+
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set("ETag", etag(hash))
+
+	// A mismatch is not a failed request.
+	if h := strings.Trim(c.QueryParam("hash"), `"`); h != "" && h != hash {
+		auditEntry(c).Outcome = AuditOK
+		return c.NoContent(http.StatusPreconditionFailed)
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
 func logHandler(c echo.Context) error {
 	key := c.Param("key")
 
@@ -184,12 +534,123 @@ func logHandler(c echo.Context) error {
 
 	// Does not exist.
 	if log == nil {
-		return c.NoContent(http.StatusNoContent)
+		return NotFoundError("Object %s does not exist", key)
+	}
+
+	last := log[len(log)-1]
+
+	auditEntry(c).Version = last.Version
+
+	fields := redactedFields(c)
+
+	for i, r := range log {
+		r.URL = cfg.HTTP.VersionURL(key, r.Version)
+		log[i] = redactRevision(r, fields)
+	}
+
+	// The log only changes when a revision is added. The redacted log is a
+	// different representation and is tagged by its content hash.
+	tag := fmt.Sprintf(`"v%d"`, last.Version)
+
+	if len(fields) > 0 {
+		hash, err := cfg.Encryption.ContentHash(map[string]interface{}{"log": log})
+
+		if err != nil {
+			return err
+		}
+
+		tag = etag(hash)
+	}
+
+	if notModified(c, tag, last.Time) {
+		return c.NoContent(http.StatusNotModified)
 	}
 
 	return c.JSON(http.StatusOK, log)
 }
 
+func changesHandler(c echo.Context) error {
+	cfg := c.Get("config").(*Config)
+
+	since, err := ParseSince(c.QueryParam("since"))
+
+	if err != nil {
+		return ParamError("since", err)
+	}
+
+	var limit int
+
+	if ls := c.QueryParam("limit"); ls != "" {
+		if limit, err = strconv.Atoi(ls); err != nil {
+			return ParamError("limit", err)
+		}
+	}
+
+	events, since, err := ChangesSince(cfg, since, limit)
+
+	if err != nil {
+		return err
+	}
+
+	readable := make([]*Event, 0, len(events))
+	fields := redactedFields(c)
+
+	for _, e := range events {
+		if !allowed(c, PermRead, e.Key) {
+			continue
+		}
+
+		e.Revision.URL = cfg.HTTP.VersionURL(e.Key, e.Revision.Version)
+		e.Revision = redactRevision(e.Revision, fields)
+		readable = append(readable, e)
+
+		auditRead(c, OpChanges, e.Key, e.Revision.Version, nil)
+	}
+
+	events = readable
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"changes": events,
+		"cursor":  since.String(),
+	})
+}
+
+func auditHandler(c echo.Context) error {
+	cfg := c.Get("config").(*Config)
+
+	q := AuditQuery{
+		Identity:  c.QueryParam("identity"),
+		Operation: c.QueryParam("operation"),
+		Key:       c.QueryParam("key"),
+	}
+
+	if ss := c.QueryParam("since"); ss != "" {
+		since, err := ParseSince(ss)
+
+		if err != nil {
+			return ParamError("since", err)
+		}
+
+		q.Since = time.Unix(since.Time, 0)
+	}
+
+	if ls := c.QueryParam("limit"); ls != "" {
+		var err error
+
+		if q.Limit, err = strconv.Atoi(ls); err != nil {
+			return ParamError("limit", err)
+		}
+	}
+
+	entries, err := QueryAudit(cfg, q)
+
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, entries)
+}
+
 func getSubscribersHandler(c echo.Context) error {
 	cfg := c.Get("config").(*Config)
 
@@ -206,24 +667,33 @@ func addSubscribersHandler(c echo.Context) error {
 	cfg := c.Get("config").(*Config)
 
 	var (
-		err    error
-		emails []string
+		err  error
+		raw  json.RawMessage
+		body struct {
+			Emails []string `json:"emails"`
+			Subscription
+		}
 	)
 
-	if err = c.Bind(&emails); err != nil {
-		return c.JSON(StatusUnprocessableEntity, map[string]interface{}{
-			"message": "problem decoding request body",
-			"error":   err,
-		})
+	if err = c.Bind(&raw); err == nil {
+		// The body is either an array of emails or an object
+		// with emails and a filter.
+		if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("[")) {
+			err = json.Unmarshal(raw, &body.Emails)
+		} else {
+			err = json.Unmarshal(raw, &body)
+		}
+	}
+
+	if err != nil {
+		return BodyError(err)
 	}
 
-	subs, err := SubscribeEmail(cfg, emails...)
+	// Subscribers must confirm their subscription.
+	subs, err := RequestSubscription(cfg, body.Subscription, body.Emails...)
 
 	if err != nil {
-		return c.JSON(StatusUnprocessableEntity, map[string]interface{}{
-			"message": "problem subscribing emails",
-			"error":   err,
-		})
+		return ValidationError("Problem subscribing emails", err.Error())
 	}
 
 	return c.JSON(http.StatusOK, map[string]interface{}{
@@ -236,22 +706,232 @@ func deleteSubscriberHandler(c echo.Context) error {
 
 	cfg := c.Get("config").(*Config)
 
-	if !bson.IsObjectIdHex(token) {
-		return c.NoContent(http.StatusNotFound)
+	var (
+		ok  bool
+		err error
+	)
+
+	// The subscriber id or token.
+	if bson.IsObjectIdHex(token) {
+		ok, err = UnsubscribeID(cfg, bson.ObjectIdHex(token))
+	} else {
+		ok, err = UnsubscribeToken(cfg, token)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return NotFoundError("Subscriber %s does not exist", token)
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+func confirmHandler(c echo.Context) error {
+	token := c.Param("token")
+
+	cfg := c.Get("config").(*Config)
+
+	ok, err := ConfirmSubscription(cfg, token)
+
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return NotFoundError("Confirmation link is invalid")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"confirmed": true,
+	})
+}
+
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!doctype html>
+<html>
+<head><meta charset="utf-8"><title>Unsubscribe</title></head>
+<body>
+{{if .Unsubscribed}}
+<p>{{.Email}} is unsubscribed and will no longer receive notifications.</p>
+{{else}}
+<form method="post">
+<p>Unsubscribe {{.Email}} from notifications?</p>
+<button type="submit">Unsubscribe</button>
+</form>
+{{end}}
+</body>
+</html>
+`))
+
+// renderUnsubscribePage responds with the unsubscribe page.
+func renderUnsubscribePage(c echo.Context, email string, unsubscribed bool) error {
+	var b bytes.Buffer
+
+	err := unsubscribePage.Execute(&b, map[string]interface{}{
+		"Email":        email,
+		"Unsubscribed": unsubscribed,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return c.HTML(http.StatusOK, b.String())
+}
+
+// unsubscribePageHandler responds with a form to confirm unsubscribing.
+// Following the link does not unsubscribe since links are fetched by mail
+// scanners and prefetchers.
+func unsubscribePageHandler(c echo.Context) error {
+	cfg := c.Get("config").(*Config)
+
+	sub, err := SubscriberByToken(cfg, c.Param("token"))
+
+	if err != nil {
+		return err
+	}
+
+	if sub == nil {
+		return NotFoundError("Unsubscribe link is invalid")
+	}
+
+	return renderUnsubscribePage(c, sub.Email, false)
+}
+
+// unsubscribeHandler removes the subscriber. POST requests are sent by the
+// unsubscribe page and by mail clients supporting the List-Unsubscribe-Post
+// header.
+func unsubscribeHandler(c echo.Context) error {
+	token := c.Param("token")
+
+	cfg := c.Get("config").(*Config)
+
+	sub, err := SubscriberByToken(cfg, token)
+
+	if err != nil {
+		return err
+	}
+
+	if sub == nil {
+		return NotFoundError("Unsubscribe link is invalid")
+	}
+
+	if _, err = UnsubscribeToken(cfg, token); err != nil {
+		return err
+	}
+
+	// Submitted from the unsubscribe page.
+	if strings.Contains(c.Request().Header().Get("Accept"), "text/html") {
+		return renderUnsubscribePage(c, sub.Email, true)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"unsubscribed": true,
+	})
+}
+
+func getWebhooksHandler(c echo.Context) error {
+	cfg := c.Get("config").(*Config)
+
+	hooks, err := AllWebhooks(cfg)
+
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, hooks)
+}
+
+func addWebhookHandler(c echo.Context) error {
+	cfg := c.Get("config").(*Config)
+
+	var body struct {
+		URL    string `json:"url"`
+		Secret string `json:"secret"`
+	}
+
+	if err := c.Bind(&body); err != nil {
+		return BodyError(err)
+	}
+
+	w, err := AddWebhook(cfg, body.URL, body.Secret)
+
+	if err != nil {
+		return ValidationError("Problem adding webhook", err.Error())
+	}
+
+	return c.JSON(http.StatusCreated, w)
+}
+
+func deleteWebhookHandler(c echo.Context) error {
+	id := c.Param("id")
+
+	cfg := c.Get("config").(*Config)
+
+	if !bson.IsObjectIdHex(id) {
+		return ParamError("id", fmt.Errorf("Not a webhook id: %s", id))
 	}
 
-	ok, err := UnsubscribeID(cfg, bson.ObjectIdHex(token))
+	ok, err := RemoveWebhook(cfg, bson.ObjectIdHex(id))
 
 	if err != nil {
-		return c.JSON(StatusUnprocessableEntity, map[string]interface{}{
-			"message": "problem unsubscribing email",
-			"error":   err,
-		})
+		return err
 	}
 
 	if !ok {
-		return c.NoContent(http.StatusNotFound)
+		return NotFoundError("Webhook %s does not exist", id)
 	}
 
 	return c.NoContent(http.StatusOK)
 }
+
+func webhookDeliveriesHandler(c echo.Context) error {
+	id := c.Param("id")
+
+	cfg := c.Get("config").(*Config)
+
+	if !bson.IsObjectIdHex(id) {
+		return ParamError("id", fmt.Errorf("Not a webhook id: %s", id))
+	}
+
+	limit := 20
+
+	if ls := c.QueryParam("limit"); ls != "" {
+		var err error
+
+		if limit, err = strconv.Atoi(ls); err != nil {
+			return ParamError("limit", err)
+		}
+	}
+
+	ds, err := Deliveries(cfg, bson.ObjectIdHex(id), limit)
+
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, ds)
+}
+
+func notificationStatusHandler(c echo.Context) error {
+	cfg := c.Get("config").(*Config)
+
+	status, err := QueueStatus(cfg)
+
+	if err != nil {
+		return err
+	}
+
+	dead, err := DeadJobs(cfg, 20)
+
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"queue": status,
+		"dead":  dead,
+	})
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMatchETag(t *testing.T) {
+	tests := []struct {
+		Header string
+		Match  bool
+	}{
+		{`"abc"`, true},
+		{`"xyz", "abc"`, true},
+		{`W/"abc"`, true},
+		{`*`, true},
+		{`"xyz"`, false},
+		{`abc`, false},
+	}
+
+	for _, test := range tests {
+		if matchETag(test.Header, `"abc"`) != test.Match {
+			t.Errorf("%s: expected match to be %v", test.Header, test.Match)
+		}
+	}
+}
+
+func TestHideQueryParam(t *testing.T) {
+	tests := []struct {
+		URI      string
+		Expected string
+	}{
+		{"/changes/stream", "/changes/stream"},
+		{"/changes/stream?access_token=abc", "/changes/stream?access_token=REDACTED"},
+		{"/changes/stream?keys=a.*&access_token=abc&since=1h", "/changes/stream?keys=a.*&access_token=REDACTED&since=1h"},
+		{"/changes/stream?access%5Ftoken=abc", "/changes/stream?access_token=REDACTED"},
+		{"/objects/a?my_access_token=abc", "/objects/a?my_access_token=abc"},
+	}
+
+	for _, test := range tests {
+		if uri := hideQueryParam(test.URI, "access_token"); uri != test.Expected {
+			t.Errorf("expected %s, got %s", test.Expected, uri)
+		}
+	}
+}
+
+func TestUnsubscribePage(t *testing.T) {
+	var b bytes.Buffer
+
+	err := unsubscribePage.Execute(&b, map[string]interface{}{
+		"Email":        "<bob@example.com>",
+		"Unsubscribed": false,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Following the link only shows a form.
+	if !strings.Contains(b.String(), `<form method="post">`) {
+		t.Error("expected form posting to the link")
+	}
+
+	if strings.Contains(b.String(), "<bob@") {
+		t.Error("expected email to be escaped")
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// LoadOptions define how rows of a CSV file are turned into objects.
+type LoadOptions struct {
+	// Template of the key with columns in braces, e.g. patients.{mrn}.
+	KeyTemplate string
+
+	// Columns included in the value. Defaults to all columns.
+	Columns []string
+
+	// Infer converts numbers and booleans and empty cells to null.
+	// Otherwise all cells are strings.
+	Infer bool
+}
+
+// LoadResult is the number of rows by the outcome of their put.
+type LoadResult struct {
+	New       int
+	Changed   int
+	Unchanged int
+	Invalid   int
+}
+
+// loadPut puts the value of a row and returns the version of the new
+// revision or 0 if the value did not change.
+type loadPut func(key string, value map[string]interface{}) (int, error)
+
+var templateColumnRegexp = regexp.MustCompile(`{([^{}]+)}`)
+
+// Decimal numbers. Numbers with leading zeros, such as identifiers, and
+// exponents are kept as strings.
+var numberRegexp = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?$`)
+
+// Largest integer stored exactly by a float. Larger integers are kept as
+// strings so identifiers are not rounded.
+const maxExactInt = 1 << 53
+
+// inferValue returns the cell as a number, boolean, or null if it is one.
+func inferValue(s string) interface{} {
+	switch s {
+	case "":
+		return nil
+
+	case "true":
+		return true
+
+	case "false":
+		return false
+	}
+
+	if !numberRegexp.MatchString(s) {
+		return s
+	}
+
+	if !strings.Contains(s, ".") {
+		n, err := strconv.ParseInt(s, 10, 64)
+
+		if err != nil || n > maxExactInt || n < -maxExactInt {
+			return s
+		}
+
+		return float64(n)
+	}
+
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+
+	return s
+}
+
+// rowKey returns the key of the row from the template.
+func rowKey(tmpl string, row map[string]string) (string, error) {
+	var err error
+
+	key := templateColumnRegexp.ReplaceAllStringFunc(tmpl, func(m string) string {
+		col := m[1 : len(m)-1]
+		v := strings.TrimSpace(row[col])
+
+		if v == "" && err == nil {
+			err = fmt.Errorf("Column %s is empty", col)
+		}
+
+		return v
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if !checkKey(key) {
+		return "", ErrInvalidKey(key)
+	}
+
+	return key, nil
+}
+
+// LoadCSV puts each row of the CSV file as an object. The first row is the
+// header with the column names. Rows with an invalid key or value are
+// counted as invalid and passed to the invalid function with their row
+// number, and loading continues. Rows with more or fewer fields than the
+// header are invalid as well. Other errors stop the load.
+func LoadCSV(r io.Reader, opts *LoadOptions, put loadPut, invalid func(row int, key string, err error)) (*LoadResult, error) {
+	cr := csv.NewReader(r)
+
+	// The number of fields is checked for each row so a bad row does not
+	// stop the load.
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+
+	if err == io.EOF {
+		return &LoadResult{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	cols := make(map[string]bool, len(header))
+
+	for _, h := range header {
+		cols[h] = true
+	}
+
+	if !templateColumnRegexp.MatchString(opts.KeyTemplate) {
+		return nil, ParamError("key-template", fmt.Errorf("Template has no columns: %s", opts.KeyTemplate))
+	}
+
+	for _, m := range templateColumnRegexp.FindAllStringSubmatch(opts.KeyTemplate, -1) {
+		if !cols[m[1]] {
+			return nil, ParamError("key-template", fmt.Errorf("Column %s does not exist", m[1]))
+		}
+	}
+
+	selected := header
+
+	if len(opts.Columns) > 0 {
+		for _, c := range opts.Columns {
+			if !cols[c] {
+				return nil, ParamError("columns", fmt.Errorf("Column %s does not exist", c))
+			}
+		}
+
+		selected = opts.Columns
+	}
+
+	var (
+		res LoadResult
+		n   = 1
+	)
+
+	for {
+		rec, err := cr.Read()
+
+		if err == io.EOF {
+			break
+		}
+
+		n++
+
+		if err != nil {
+			return &res, err
+		}
+
+		if len(rec) != len(header) {
+			res.Invalid++
+			invalid(n, "", fmt.Errorf("Row has %d fields, expected %d", len(rec), len(header)))
+			continue
+		}
+
+		row := make(map[string]string, len(header))
+
+		for i, h := range header {
+			row[h] = rec[i]
+		}
+
+		key, err := rowKey(opts.KeyTemplate, row)
+
+		if err != nil {
+			res.Invalid++
+			invalid(n, key, err)
+			continue
+		}
+
+		val := make(map[string]interface{}, len(selected))
+
+		for _, c := range selected {
+			if opts.Infer {
+				val[c] = inferValue(row[c])
+			} else {
+				val[c] = row[c]
+			}
+		}
+
+		v, err := put(key, val)
+
+		if err != nil {
+			// Invalid keys and values that fail schema validation.
+			if c := exitCode(err); c == ExitInvalid || c == ExitValidation {
+				res.Invalid++
+				invalid(n, key, err)
+				continue
+			}
+
+			return &res, err
+		}
+
+		switch {
+		case v == 0:
+			res.Unchanged++
+
+		case v == 1:
+			res.New++
+
+		default:
+			res.Changed++
+		}
+	}
+
+	return &res, nil
+}
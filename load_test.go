@@ -0,0 +1,104 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInferValue(t *testing.T) {
+	tests := map[string]interface{}{
+		"":                               nil,
+		"true":                           true,
+		"false":                          false,
+		"42":                             42.0,
+		"-1.5":                           -1.5,
+		"1e3":                            "1e3",
+		"9007199254740992":               9007199254740992.0,
+		"9007199254740993":               "9007199254740993",
+		"-9007199254740993":              "-9007199254740993",
+		"123456789012345678901234567890": "123456789012345678901234567890",
+		"00123":                          "00123",
+		"NaN":                            "NaN",
+		"Bob":                            "Bob",
+	}
+
+	for in, exp := range tests {
+		if v := inferValue(in); v != exp {
+			t.Errorf("%q: expected %#v, got %#v", in, exp, v)
+		}
+	}
+}
+
+func TestLoadCSV(t *testing.T) {
+	in := `mrn,name,age
+1,Bob,30
+2,Alice,
+3,Joe,41
+,Nobody,50
+4,Bad,x
+5,Short
+6,Joe,41,extra
+`
+
+	versions := map[string]int{
+		"patients.1": 1,
+		"patients.2": 3,
+	}
+
+	values := make(map[string]map[string]interface{})
+
+	put := func(key string, val map[string]interface{}) (int, error) {
+		if val["age"] == "x" {
+			return 0, ValidationError("Object failed schema validation", nil)
+		}
+
+		values[key] = val
+
+		return versions[key], nil
+	}
+
+	var invalid []int
+
+	opts := LoadOptions{
+		KeyTemplate: "patients.{mrn}",
+		Columns:     []string{"name", "age"},
+		Infer:       true,
+	}
+
+	res, err := LoadCSV(strings.NewReader(in), &opts, put, func(row int, key string, err error) {
+		invalid = append(invalid, row)
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := LoadResult{New: 1, Changed: 1, Unchanged: 1, Invalid: 4}
+
+	if *res != exp {
+		t.Errorf("expected %+v, got %+v", exp, *res)
+	}
+
+	if !reflect.DeepEqual(invalid, []int{5, 6, 7, 8}) {
+		t.Errorf("expected rows 5 to 8 to be invalid, got %v", invalid)
+	}
+
+	if v := values["patients.2"]; !reflect.DeepEqual(v, map[string]interface{}{"name": "Alice", "age": nil}) {
+		t.Errorf("unexpected value %v", v)
+	}
+
+	// Unknown columns.
+	opts.KeyTemplate = "patients.{id}"
+
+	if _, err = LoadCSV(strings.NewReader(in), &opts, put, nil); err == nil {
+		t.Error("expected error for unknown key column")
+	}
+
+	opts.KeyTemplate = "patients.{mrn}"
+	opts.Columns = []string{"dob"}
+
+	if _, err = LoadCSV(strings.NewReader(in), &opts, put, nil); err == nil {
+		t.Error("expected error for unknown column")
+	}
+}
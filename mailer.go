@@ -0,0 +1,345 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"sync"
+	"time"
+
+	"github.com/jordan-wright/email"
+)
+
+// TLS modes of the SMTP connection.
+const (
+	// STARTTLS is used if the server supports it.
+	SMTPTLSAuto = ""
+
+	// Connections are not encrypted.
+	SMTPTLSNone = "none"
+
+	// STARTTLS is required.
+	SMTPTLSStartTLS = "starttls"
+
+	// Connections are encrypted from the start, typically on port 465.
+	SMTPTLSImplicit = "tls"
+)
+
+// Timeout of establishing a connection to the SMTP server.
+const smtpDialTimeout = 30 * time.Second
+
+var ErrNoStartTLS = errors.New("SMTP server does not support STARTTLS")
+
+// smtpConn is an open connection to the SMTP server.
+type smtpConn struct {
+	client *smtp.Client
+	used   time.Time
+}
+
+// smtpPool keeps connections to the SMTP server open between messages so
+// bulk notifications do not open a connection per message.
+type smtpPool struct {
+	smtp *SMTPConfig
+
+	mu   sync.Mutex
+	idle []*smtpConn
+}
+
+func newSMTPPool(s *SMTPConfig) *smtpPool {
+	return &smtpPool{smtp: s}
+}
+
+// get returns an idle connection or opens a new one. The boolean is true
+// if the connection was reused.
+func (p *smtpPool) get() (*smtpConn, bool, error) {
+	now := time.Now()
+
+	for {
+		p.mu.Lock()
+
+		if len(p.idle) == 0 {
+			p.mu.Unlock()
+			break
+		}
+
+		c := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+
+		p.mu.Unlock()
+
+		// Servers close idle connections so they are not kept for long.
+		if now.Sub(c.used) > p.smtp.Idle {
+			c.client.Close()
+			continue
+		}
+
+		// Reset the session which also checks the connection is alive.
+		if err := c.client.Reset(); err != nil {
+			c.client.Close()
+			continue
+		}
+
+		return c, true, nil
+	}
+
+	client, err := p.smtp.dial()
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &smtpConn{client: client}, false, nil
+}
+
+// put returns the connection to the pool or closes it if the pool is full.
+func (p *smtpPool) put(c *smtpConn) {
+	c.used = time.Now()
+
+	p.mu.Lock()
+
+	if len(p.idle) < p.smtp.Conns {
+		p.idle = append(p.idle, c)
+		c = nil
+	}
+
+	p.mu.Unlock()
+
+	if c != nil {
+		c.client.Quit()
+	}
+}
+
+// close closes the idle connections.
+func (p *smtpPool) close() {
+	p.mu.Lock()
+
+	idle := p.idle
+	p.idle = nil
+
+	p.mu.Unlock()
+
+	for _, c := range idle {
+		c.client.Quit()
+	}
+}
+
+// TLSConfig returns the TLS configuration for connecting to the SMTP server.
+func (s *SMTPConfig) TLSConfig() (*tls.Config, error) {
+	t := &tls.Config{
+		ServerName:         s.Host,
+		InsecureSkipVerify: s.Insecure,
+	}
+
+	if s.CA != "" {
+		b, err := ioutil.ReadFile(s.CA)
+
+		if err != nil {
+			return nil, err
+		}
+
+		t.RootCAs = x509.NewCertPool()
+
+		if !t.RootCAs.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("No certificates found in %s", s.CA)
+		}
+	}
+
+	return t, nil
+}
+
+// dial opens a connection to the SMTP server and authenticates.
+func (s *SMTPConfig) dial() (*smtp.Client, error) {
+	t, err := s.TLSConfig()
+
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{
+		Timeout: smtpDialTimeout,
+	}
+
+	var conn net.Conn
+
+	switch s.TLS {
+	case SMTPTLSImplicit:
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.Addr(), t)
+
+	case SMTPTLSAuto, SMTPTLSNone, SMTPTLSStartTLS:
+		conn, err = dialer.Dial("tcp", s.Addr())
+
+	default:
+		return nil, fmt.Errorf("Unknown SMTP TLS mode: %s", s.TLS)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := smtp.NewClient(conn, s.Host)
+
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if s.TLS == SMTPTLSAuto || s.TLS == SMTPTLSStartTLS {
+		ok, _ := c.Extension("STARTTLS")
+
+		if ok {
+			err = c.StartTLS(t)
+		} else if s.TLS == SMTPTLSStartTLS {
+			err = ErrNoStartTLS
+		}
+
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+
+	if a := s.Auth(); a != nil {
+		if ok, _ := c.Extension("AUTH"); ok {
+			if err = c.Auth(a); err != nil {
+				c.Close()
+				return nil, err
+			}
+		}
+	}
+
+	return c, nil
+}
+
+// send sends a message over the connection.
+func (c *smtpConn) send(from string, to []string, msg []byte) error {
+	if err := c.client.Mail(from); err != nil {
+		return err
+	}
+
+	for _, addr := range to {
+		if err := c.client.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.client.Data()
+
+	if err != nil {
+		return err
+	}
+
+	if _, err = w.Write(msg); err != nil {
+		w.Close()
+		return err
+	}
+
+	return w.Close()
+}
+
+// envelope returns the sender and recipient addresses of the email.
+func envelope(e *email.Email) (string, []string, error) {
+	sender := e.Sender
+
+	if sender == "" {
+		sender = e.From
+	}
+
+	from, err := mail.ParseAddress(sender)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	var to []string
+
+	for _, list := range [][]string{e.To, e.Cc, e.Bcc} {
+		for _, a := range list {
+			addr, err := mail.ParseAddress(a)
+
+			if err != nil {
+				return "", nil, err
+			}
+
+			to = append(to, addr.Address)
+		}
+	}
+
+	if len(to) == 0 {
+		return "", nil, errors.New("Email has no recipients")
+	}
+
+	return from.Address, to, nil
+}
+
+// Send sends the email, reusing an open connection to the SMTP server if one
+// is available.
+func (s *SMTPConfig) Send(e *email.Email) error {
+	from, to, err := envelope(e)
+
+	if err != nil {
+		return err
+	}
+
+	msg, err := e.Bytes()
+
+	if err != nil {
+		return err
+	}
+
+	// Not pooled, use a connection per message.
+	if s.pool == nil {
+		c, err := s.dial()
+
+		if err != nil {
+			return err
+		}
+
+		conn := &smtpConn{client: c}
+
+		if err = conn.send(from, to, msg); err != nil {
+			c.Close()
+			return err
+		}
+
+		return c.Quit()
+	}
+
+	for {
+		conn, reused, err := s.pool.get()
+
+		if err != nil {
+			return err
+		}
+
+		err = conn.send(from, to, msg)
+
+		if err == nil {
+			s.pool.put(conn)
+			return nil
+		}
+
+		conn.client.Close()
+
+		// The server may have closed the connection since it was used.
+		// Retry with a new connection, but not on protocol errors which
+		// would fail again.
+		if _, ok := err.(*textproto.Error); reused && !ok {
+			continue
+		}
+
+		return err
+	}
+}
+
+// Close closes the open connections to the SMTP server.
+func (s *SMTPConfig) Close() {
+	if s.pool != nil {
+		s.pool.close()
+	}
+}
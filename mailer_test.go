@@ -0,0 +1,259 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/textproto"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jordan-wright/email"
+)
+
+// fakeSMTP is a minimal SMTP server that records the messages it receives.
+type fakeSMTP struct {
+	ln       net.Listener
+	tls      *tls.Config
+	implicit bool
+
+	mu    sync.Mutex
+	conns int
+	msgs  []string
+}
+
+func newFakeSMTP(t *testing.T, tc *tls.Config, implicit bool) *fakeSMTP {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &fakeSMTP{
+		ln:       ln,
+		tls:      tc,
+		implicit: implicit,
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+
+			if err != nil {
+				return
+			}
+
+			s.mu.Lock()
+			s.conns++
+			s.mu.Unlock()
+
+			go s.serve(conn)
+		}
+	}()
+
+	return s
+}
+
+func (s *fakeSMTP) config(mode string) *SMTPConfig {
+	addr := s.ln.Addr().(*net.TCPAddr)
+
+	return &SMTPConfig{
+		Host:  addr.IP.String(),
+		Port:  addr.Port,
+		TLS:   mode,
+		Conns: 2,
+		Idle:  time.Minute,
+	}
+}
+
+// counts returns the number of connections and messages received.
+func (s *fakeSMTP) counts() (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.conns, len(s.msgs)
+}
+
+func (s *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+
+	secure := s.implicit
+
+	if s.implicit {
+		conn = tls.Server(conn, s.tls)
+	}
+
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 localhost ESMTP")
+
+	for {
+		line, err := tp.ReadLine()
+
+		if err != nil {
+			return
+		}
+
+		switch cmd := strings.ToUpper(strings.Fields(line + " ")[0]); cmd {
+		case "EHLO":
+			if s.tls != nil && !secure {
+				tp.PrintfLine("250-localhost")
+				tp.PrintfLine("250 STARTTLS")
+			} else {
+				tp.PrintfLine("250 localhost")
+			}
+
+		case "STARTTLS":
+			tp.PrintfLine("220 ready")
+
+			conn = tls.Server(conn, s.tls)
+			tp = textproto.NewConn(conn)
+			secure = true
+
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+
+			b, err := tp.ReadDotBytes()
+
+			if err != nil {
+				return
+			}
+
+			s.mu.Lock()
+			s.msgs = append(s.msgs, string(b))
+			s.mu.Unlock()
+
+			tp.PrintfLine("250 OK")
+
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+
+		default:
+			tp.PrintfLine("250 OK")
+		}
+	}
+}
+
+// testCert returns a self-signed certificate for 127.0.0.1 and the path to
+// its PEM encoding for use as a CA bundle.
+func testCert(t *testing.T) (tls.Certificate, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "scds test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, &key.PublicKey, key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := ioutil.TempFile("", "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pem.Encode(f, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	f.Close()
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, f.Name()
+}
+
+func testEmail(to string) *email.Email {
+	e := email.NewEmail()
+	e.From = "scds@example.com"
+	e.To = []string{to}
+	e.Subject = "Test"
+	e.Text = []byte("Hello")
+	return e
+}
+
+func TestSMTPPool(t *testing.T) {
+	srv := newFakeSMTP(t, nil, false)
+	defer srv.ln.Close()
+
+	c := srv.config(SMTPTLSAuto)
+	c.pool = newSMTPPool(c)
+
+	defer c.Close()
+
+	for i := 0; i < 3; i++ {
+		if err := c.Send(testEmail(fmt.Sprintf("user%d@example.com", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conns, msgs := srv.counts()
+
+	if conns != 1 {
+		t.Errorf("expected 1 connection, got %d", conns)
+	}
+
+	if msgs != 3 {
+		t.Errorf("expected 3 messages, got %d", msgs)
+	}
+
+	// Requires STARTTLS which the server does not support.
+	c = srv.config(SMTPTLSStartTLS)
+
+	if err := c.Send(testEmail("user@example.com")); err != ErrNoStartTLS {
+		t.Errorf("expected STARTTLS error, got %v", err)
+	}
+}
+
+func TestSMTPTLS(t *testing.T) {
+	cert, ca := testCert(t)
+	defer os.Remove(ca)
+
+	tc := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+	}
+
+	for _, mode := range []string{SMTPTLSStartTLS, SMTPTLSImplicit} {
+		srv := newFakeSMTP(t, tc, mode == SMTPTLSImplicit)
+
+		// Server certificate is not trusted by the system CAs.
+		c := srv.config(mode)
+
+		if err := c.Send(testEmail("user@example.com")); err == nil {
+			t.Errorf("%s: expected certificate error", mode)
+		}
+
+		c.CA = ca
+
+		if err := c.Send(testEmail("user@example.com")); err != nil {
+			t.Errorf("%s: %s", mode, err)
+		}
+
+		if _, msgs := srv.counts(); msgs != 1 {
+			t.Errorf("%s: expected 1 message, got %d", mode, msgs)
+		}
+
+		srv.ln.Close()
+	}
+}
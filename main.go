@@ -38,6 +38,7 @@ func main() {
 
 	flag.Bool("debug", viper.GetBool("debug"), "Turn on debug output.")
 	flag.String("mongo.uri", viper.GetString("mongo.uri"), "URI of the MongoDB host or cluster.")
+	flag.String("remote", viper.GetString("remote.url"), "URL of an SCDS HTTP server to send commands to.")
 
 	flag.String("smtp.host", viper.GetString("smtp.host"), "Host of the SMTP server.")
 	flag.Int("smtp.port", viper.GetInt("smtp.port"), "Port of the SMTP server.")
@@ -50,7 +51,14 @@ func main() {
 	// Visit all of the seen flags to update the config.
 	// All flag types in flag package support the getter interface.
 	flag.Visit(func(f *flag.Flag) {
-		viper.Set(f.Name, f.Value.(flag.Getter).Get())
+		name := f.Name
+
+		// Shorthand of the remote.url option.
+		if name == "remote" {
+			name = "remote.url"
+		}
+
+		viper.Set(name, f.Value.(flag.Getter).Get())
 	})
 
 	args := flag.Args()
@@ -76,9 +84,18 @@ func main() {
 	case "log":
 		logCmd(args[1:])
 
+	case "changes":
+		changesCmd(args[1:])
+
 	case "http":
 		httpCmd(args[1:])
 
+	case "grpc":
+		grpcCmd(args[1:])
+
+	case "notify-worker":
+		notifyWorkerCmd(args[1:])
+
 	case "config":
 		configCmd(args[1:])
 
@@ -88,6 +105,27 @@ func main() {
 	case "unsubscribe":
 		unsubscribeCmd(args[1:])
 
+	case "webhook":
+		webhookCmd(args[1:])
+
+	case "token":
+		tokenCmd(args[1:])
+
+	case "audit":
+		auditLogCmd(args[1:])
+
+	case "rekey":
+		rekeyCmd(args[1:])
+
+	case "export":
+		exportCmd(args[1:])
+
+	case "import":
+		importCmd(args[1:])
+
+	case "load":
+		loadCmd(args[1:])
+
 	default:
 		// Print usage of speific command.
 		if len(args) == 2 {
@@ -2,7 +2,9 @@ package main
 
 import (
 	"fmt"
+	"net/http"
 	"os"
+	"path"
 	"regexp"
 	"time"
 
@@ -11,7 +13,11 @@ import (
 )
 
 func ErrInvalidKey(k string) error {
-	return fmt.Errorf("Key contains invalid chars: %s", k)
+	return &Error{
+		Status:  http.StatusBadRequest,
+		Code:    CodeInvalidKey,
+		Message: fmt.Sprintf("Key contains invalid chars: %s", k),
+	}
 }
 
 var keyRegexp *regexp.Regexp
@@ -24,6 +30,27 @@ func checkKey(key string) bool {
 	return keyRegexp.MatchString(key)
 }
 
+// checkKeyPattern returns an error if the key pattern is malformed. Patterns
+// use glob syntax where * matches any sequence of characters, e.g. `billing.*`.
+func checkKeyPattern(p string) error {
+	if _, err := path.Match(p, ""); err != nil {
+		return fmt.Errorf("Key pattern is invalid: %s", p)
+	}
+
+	return nil
+}
+
+// matchKeyPatterns returns true if the key matches any of the patterns.
+func matchKeyPatterns(pats []string, key string) bool {
+	for _, p := range pats {
+		if ok, _ := path.Match(p, key); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
 func Keys(cfg *Config) ([]string, error) {
 	c := cfg.Mongo.Objects()
 
@@ -85,6 +112,10 @@ func get(cfg *Config, k string, history bool) (*Object, error) {
 		return nil, err
 	}
 
+	if err = cfg.Encryption.DecryptObject(&o); err != nil {
+		return nil, err
+	}
+
 	return &o, nil
 }
 
@@ -118,15 +149,23 @@ func Log(cfg *Config, k string) ([]*Revision, error) {
 		return nil, err
 	}
 
+	o.Key = k
+
+	if err = cfg.Encryption.DecryptObject(&o); err != nil {
+		return nil, err
+	}
+
 	return o.History, nil
 
 }
 
-// Inserts an object into the store.
-func insert(c *mgo.Collection, k string, v map[string]interface{}) (*Object, bool, error) {
+// Inserts an object into the store. The returned object is not encrypted.
+func insert(c *mgo.Collection, enc *EncryptionConfig, k string, v map[string]interface{}, hash, author string) (*Object, bool, error) {
 	r := Diff(nil, v)
 	r.Version = 1
 	r.Time = time.Now().UTC().Unix()
+	r.Author = author
+	r.Hash = hash
 
 	o := Object{
 		ID:      bson.NewObjectId(),
@@ -135,24 +174,65 @@ func insert(c *mgo.Collection, k string, v map[string]interface{}) (*Object, boo
 		Version: r.Version,
 		Time:    r.Time,
 		History: []*Revision{r},
+		Hash:    hash,
 	}
 
-	err := c.Insert(&o)
+	// Encrypted copy of the object that is stored. The revision is
+	// sequenced after it is written.
+	s := o
+	s.Unsequenced = true
+
+	var err error
+
+	if s.Value, err = enc.EncryptDoc(v); err != nil {
+		return nil, false, err
+	}
+
+	sr, err := enc.EncryptRevision(r)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	s.History = []*Revision{sr}
+
+	err = c.Insert(&s)
 
 	return &o, true, err
 }
 
-// Updates an existing objects.
-func update(c *mgo.Collection, o *Object, v map[string]interface{}) (*Revision, bool, error) {
+// Updates an existing objects. The value of the object is compared before
+// it is encrypted.
+func update(c *mgo.Collection, enc *EncryptionConfig, o *Object, v map[string]interface{}, hash, author string) (*Revision, bool, error) {
 	r := Diff(o.Value, v)
 
 	if r == nil {
+		// Set the hash of objects put before hashes were stored so
+		// subsequent puts are short-circuited.
+		if o.Hash != hash {
+			return nil, false, c.UpdateId(o.ID, bson.M{"$set": bson.M{"hash": hash}})
+		}
+
 		return nil, false, nil
 	}
 
 	// Increment the version.
 	r.Version = o.Version + 1
 	r.Time = time.Now().UTC().Unix()
+	r.Author = author
+	r.Hash = hash
+
+	ev, err := enc.EncryptDoc(v)
+
+	if err != nil {
+		return r, true, err
+	}
+
+	er, err := enc.EncryptRevision(r)
+
+	if err != nil {
+		return r, true, err
+	}
 
 	// Keys to update.
 	chg := mgo.Change{
@@ -161,23 +241,60 @@ func update(c *mgo.Collection, o *Object, v map[string]interface{}) (*Revision,
 			"$set": bson.M{
 				"version": r.Version,
 				"time":    r.Time,
-				"value":   v,
+				"value":   ev,
+				"hash":    hash,
+
+				// The revision is sequenced after it is written.
+				"unsequenced": true,
 			},
 			"$push": bson.M{
-				"history": r,
+				"history": er,
 			},
 		},
 	}
 
-	// Apply the change.
-	if _, err := c.Find(bson.M{"_id": o.ID}).Apply(chg, o); err != nil {
+	// Apply the change unless another revision was put since the object
+	// was read. The history is not needed by the caller.
+	q := bson.M{
+		"_id":     o.ID,
+		"version": o.Version,
+	}
+
+	_, err = c.Find(q).Select(bson.M{"history": 0}).Apply(chg, o)
+
+	if err == mgo.ErrNotFound {
+		return r, true, ConflictError("%s was modified concurrently", o.Key)
+	}
+
+	if err != nil {
+		return r, true, err
+	}
+
+	if err = enc.DecryptObject(o); err != nil {
 		return r, true, err
 	}
 
 	return r, true, nil
 }
 
+// notify queues notifications for a new revision and signals listeners.
+func notify(cfg *Config, o *Object, r *Revision) {
+	if err := Enqueue(cfg, o, r); err != nil {
+		fmt.Fprintln(os.Stderr, "[notify] error queuing notifications:", err)
+	}
+
+	cfg.broker.Publish()
+}
+
+// Put puts the value of an object in the store. Returned is the new revision
+// or nil if the value did not change.
 func Put(cfg *Config, k string, v map[string]interface{}) (*Revision, error) {
+	return PutAs(cfg, "", k, v)
+}
+
+// PutAs puts the value of an object in the store recording the author of the
+// revision.
+func PutAs(cfg *Config, author, k string, v map[string]interface{}) (*Revision, error) {
 	if !checkKey(k) {
 		return nil, ErrInvalidKey(k)
 	}
@@ -192,6 +309,12 @@ func Put(cfg *Config, k string, v map[string]interface{}) (*Revision, error) {
 		}
 	}
 
+	hash, err := cfg.Encryption.ContentHash(v)
+
+	if err != nil {
+		return nil, err
+	}
+
 	c := cfg.Mongo.Objects()
 
 	// Query.
@@ -201,7 +324,6 @@ func Put(cfg *Config, k string, v map[string]interface{}) (*Revision, error) {
 
 	var (
 		r       *Revision
-		err     error
 		changed bool
 	)
 
@@ -209,11 +331,12 @@ func Put(cfg *Config, k string, v map[string]interface{}) (*Revision, error) {
 		Value: make(map[string]interface{}),
 	}
 
-	err = c.Find(q).One(&o)
+	// The history is not needed to compute the next revision.
+	err = c.Find(q).Select(bson.M{"history": 0}).One(&o)
 
 	// Does not exist. Insert it.
 	if err == mgo.ErrNotFound {
-		o, changed, err = insert(c, k, v)
+		o, changed, err = insert(c, &cfg.Encryption, k, v, hash, author)
 
 		if err != nil {
 			return nil, err
@@ -221,18 +344,25 @@ func Put(cfg *Config, k string, v map[string]interface{}) (*Revision, error) {
 
 		r = o.History[0]
 
-		if err = NotifyEmail(cfg, o, r); err != nil {
-			fmt.Fprintln(os.Stderr, "[smtp] error sending email:", err)
-		}
+		notify(cfg, o, r)
 
-		return o.History[0], nil
+		return r, nil
 	}
 
 	if err != nil {
 		return nil, err
 	}
 
-	r, changed, err = update(c, o, v)
+	// Same content, skip decrypting and diffing the value.
+	if o.Hash == hash {
+		return nil, nil
+	}
+
+	if err = cfg.Encryption.DecryptObject(o); err != nil {
+		return nil, err
+	}
+
+	r, changed, err = update(c, &cfg.Encryption, o, v, hash, author)
 
 	if err != nil {
 		return nil, err
@@ -240,9 +370,7 @@ func Put(cfg *Config, k string, v map[string]interface{}) (*Revision, error) {
 
 	// Object changed.
 	if changed {
-		if err = NotifyEmail(cfg, o, r); err != nil {
-			fmt.Fprintln(os.Stderr, "[smtp] error sending email:", err)
-		}
+		notify(cfg, o, r)
 
 		return r, nil
 	}
@@ -1,11 +1,8 @@
 package main
 
 import (
-	"bytes"
 	"fmt"
-	"log"
 	"strings"
-	"text/template"
 	"time"
 
 	"github.com/jordan-wright/email"
@@ -14,23 +11,11 @@ import (
 	"gopkg.in/yaml.v2"
 )
 
-// Template tree of notification templates.
-var notifyTemplate = template.New("notify")
-
-func init() {
-	// Template of the email body when new a object is created.
-	newObject := string(MustAsset("email/new_object_email_body.txt"))
-
-	// Template of the email body when an object has changed.
-	changedObject := string(MustAsset("email/changed_object_email_body.txt"))
-
-	// Compile the email bodies.
-	template.Must(notifyTemplate.New("new-object").Parse(newObject))
-	template.Must(notifyTemplate.New("changed-object").Parse(changedObject))
-}
-
-// EmailContext is the template EmailContext for email bodies.
+// EmailContext is the template EmailContext for email subjects and bodies.
+// The string fields are YAML-encoded for use in text templates. The Value
+// and Revision fields hold the decoded data.
 type EmailContext struct {
+	Event      string
 	Time       time.Time
 	Key        string
 	Version    int
@@ -40,51 +25,60 @@ type EmailContext struct {
 	Additions  string
 	Removals   string
 	Changes    string
+
+	Value    map[string]interface{}
+	Revision *Revision
+
+	// One-click URL to unsubscribe the recipient.
+	UnsubscribeURL string
 }
 
-func newObjectEmail(cfg *Config, o *Object) (*email.Email, error) {
-	var (
-		err  error
-		byt  []byte
-		buff bytes.Buffer
-	)
+// ConfirmContext is the template context for subscription confirmation emails.
+type ConfirmContext struct {
+	Email          string
+	ConfirmURL     string
+	UnsubscribeURL string
+}
+
+func newObjectEmail(cfg *Config, sub *Subscriber, o *Object) (*email.Email, error) {
+	var byt []byte
+
+	o = redactObject(o, cfg.Redact.ChannelFields(ChannelEmail))
 
 	cxt := EmailContext{
+		Event:      EventNew,
 		Time:       time.Unix(o.Time, 0).Local(),
 		Key:        o.Key,
 		Version:    o.Version,
-		URL:        fmt.Sprintf("http://%s/objects/%s", cfg.HTTP.Addr(), o.Key),
-		VersionURL: fmt.Sprintf("http://%s/objects/%s/v/%d", cfg.HTTP.Addr(), o.Key, o.Version),
-	}
-
-	byt, _ = yaml.Marshal(o.Value)
-	cxt.Object = string(byt)
+		URL:        cfg.HTTP.ObjectURL(o.Key),
+		VersionURL: cfg.HTTP.VersionURL(o.Key, o.Version),
+		Value:      o.Value,
 
-	if err = notifyTemplate.Lookup("new-object").Execute(&buff, &cxt); err != nil {
-		return nil, err
+		UnsubscribeURL: cfg.HTTP.UnsubscribeURL(sub.Token),
 	}
 
-	e := email.NewEmail()
+	if len(o.History) > 0 {
+		cxt.Revision = o.History[len(o.History)-1]
+	}
 
-	e.Subject = "[SCDS] New Object"
-	e.Text = buff.Bytes()
+	byt, _ = yaml.Marshal(o.Value)
+	cxt.Object = string(byt)
 
-	return e, nil
+	return cfg.Email.Template(templateNew).Execute(&cxt)
 }
 
-func changedObjectEmail(cfg *Config, o *Object, r *Revision) (*email.Email, error) {
-	var (
-		err  error
-		byt  []byte
-		buff bytes.Buffer
-	)
+// revisionContext returns the email context of a revision.
+func revisionContext(cfg *Config, key string, r *Revision) EmailContext {
+	var byt []byte
 
 	cxt := EmailContext{
+		Event:      eventType(r),
 		Time:       time.Unix(r.Time, 0).Local(),
-		Key:        o.Key,
+		Key:        key,
 		Version:    r.Version,
-		URL:        fmt.Sprintf("http://%s/objects/%s", cfg.HTTP.Addr(), o.Key),
-		VersionURL: fmt.Sprintf("http://%s/objects/%s/v/%d", cfg.HTTP.Addr(), o.Key, r.Version),
+		URL:        cfg.HTTP.ObjectURL(key),
+		VersionURL: cfg.HTTP.VersionURL(key, r.Version),
+		Revision:   r,
 	}
 
 	if r.Changes != nil {
@@ -102,73 +96,154 @@ func changedObjectEmail(cfg *Config, o *Object, r *Revision) (*email.Email, erro
 		cxt.Removals = string(byt)
 	}
 
-	if err = notifyTemplate.Lookup("changed-object").Execute(&buff, &cxt); err != nil {
-		return nil, err
+	return cxt
+}
+
+func changedObjectEmail(cfg *Config, sub *Subscriber, o *Object, r *Revision) (*email.Email, error) {
+	r = redactRevision(r, cfg.Redact.ChannelFields(ChannelEmail))
+
+	cxt := revisionContext(cfg, o.Key, r)
+	cxt.UnsubscribeURL = cfg.HTTP.UnsubscribeURL(sub.Token)
+
+	return cfg.Email.Template(templateChanged).Execute(&cxt)
+}
+
+func confirmEmail(cfg *Config, sub *Subscriber) (*email.Email, error) {
+	cxt := ConfirmContext{
+		Email:          sub.Email,
+		ConfirmURL:     cfg.HTTP.ConfirmURL(sub.Token),
+		UnsubscribeURL: cfg.HTTP.UnsubscribeURL(sub.Token),
 	}
 
-	e := email.NewEmail()
+	return cfg.Email.Template(templateConfirm).Execute(&cxt)
+}
+
+// setUnsubscribe sets the headers mail clients use to offer one-click
+// unsubscribing (RFC 2369 and RFC 8058).
+func setUnsubscribe(cfg *Config, e *email.Email, sub *Subscriber) {
+	e.Headers.Set("List-Unsubscribe", fmt.Sprintf("<%s>", cfg.HTTP.UnsubscribeURL(sub.Token)))
+	e.Headers.Set("List-Unsubscribe-Post", "List-Unsubscribe=One-Click")
+}
+
+// sendConfirmation sends the confirmation email to a pending subscriber.
+func sendConfirmation(cfg *Config, sub *Subscriber) error {
+	e, err := confirmEmail(cfg, sub)
+
+	if err != nil {
+		return err
+	}
 
-	e.Subject = "[SCDS] Object Changed"
-	e.Text = buff.Bytes()
+	e.From = cfg.SMTP.From
+	e.To = []string{sub.Email}
 
-	return e, nil
+	return cfg.SMTP.Send(e)
 }
 
-func NotifyEmail(cfg *Config, o *Object, r *Revision) error {
+// sendEmail sends a notification email of the revision to the subscriber.
+func sendEmail(cfg *Config, sub *Subscriber, key string, r *Revision) error {
 	var (
 		e   *email.Email
 		err error
 	)
 
-	// First version.
+	if err = sub.ensureToken(cfg); err != nil {
+		return err
+	}
+
+	// First version. The additions make up the initial value.
 	if r.Version == 1 {
-		e, err = newObjectEmail(cfg, o)
+		e, err = newObjectEmail(cfg, sub, &Object{
+			Key:     key,
+			Value:   r.Additions,
+			Version: r.Version,
+			Time:    r.Time,
+			History: []*Revision{r},
+		})
 	} else {
-		e, err = changedObjectEmail(cfg, o, r)
+		e, err = changedObjectEmail(cfg, sub, &Object{Key: key}, r)
 	}
 
 	if err != nil {
 		return err
 	}
 
-	q := bson.M{
-		"subscribed": true,
-	}
+	e.From = cfg.SMTP.From
+	e.To = []string{sub.Email}
 
-	p := bson.M{
-		"email": 1,
-	}
+	setUnsubscribe(cfg, e, sub)
 
-	var subs []*Subscriber
+	return cfg.SMTP.Send(e)
+}
+
+// Subscription contains the options of a subscriber.
+type Subscription struct {
+	Filter `bson:",inline"`
+
+	// Digest mode, hourly, daily, or quiet. If empty, a notification
+	// is sent for each change.
+	Digest string `bson:",omitempty" json:"digest,omitempty"`
 
-	if err = cfg.Mongo.Subscribers().Find(q).Select(p).All(&subs); err != nil {
+	// Quiet period of the quiet digest mode, e.g. 30m.
+	Quiet string `bson:",omitempty" json:"quiet,omitempty"`
+}
+
+// Validate checks the filter and digest options.
+func (s *Subscription) Validate() error {
+	if err := s.Filter.Validate(); err != nil {
 		return err
 	}
 
-	// No subscribers.
-	if len(subs) == 0 {
-		return nil
+	switch s.Digest {
+	case "", DigestHourly, DigestDaily, DigestQuiet:
+	default:
+		return fmt.Errorf("Unknown digest mode: %s", s.Digest)
 	}
 
-	e.From = cfg.SMTP.From
-	e.To = make([]string, 1)
-
-	for _, sub := range subs {
-		e.To[0] = sub.Email
-
-		if err = e.Send(cfg.SMTP.Addr(), cfg.SMTP.Auth()); err != nil {
-			log.Printf("error sending email: %s", err)
+	if s.Quiet != "" {
+		if _, err := time.ParseDuration(s.Quiet); err != nil {
+			return fmt.Errorf("Invalid quiet period: %s", s.Quiet)
 		}
 	}
 
 	return nil
 }
 
-// Subscriber
+// Subscriber is an email address that receives notifications for objects
+// and events matching the filter. Subscribers added through the HTTP API are
+// pending until they confirm the subscription and do not receive
+// notifications until then.
 type Subscriber struct {
-	ID    bson.ObjectId `bson:"_id,omitempty" json:"_id,omitempty"`
-	Email string        `json:"email"`
-	Time  time.Time     `json:"time"`
+	ID      bson.ObjectId `bson:"_id,omitempty" json:"_id,omitempty"`
+	Email   string        `json:"email"`
+	Time    time.Time     `json:"time"`
+	Pending bool          `bson:",omitempty" json:"pending,omitempty"`
+
+	// Secret token used in confirmation and unsubscribe links.
+	Token string `bson:",omitempty" json:"-"`
+
+	Subscription `bson:",inline"`
+}
+
+// ensureToken generates the token of subscribers that were added before
+// tokens existed.
+func (s *Subscriber) ensureToken(cfg *Config) error {
+	if s.Token != "" {
+		return nil
+	}
+
+	token, err := newSecret()
+
+	if err != nil {
+		return err
+	}
+
+	if err = cfg.Mongo.Subscribers().UpdateId(s.ID, bson.M{"$set": bson.M{"token": token}}); err != nil {
+		return err
+	}
+
+	s.Token = token
+
+	return nil
 }
 
 func AllSubscribers(cfg *Config) ([]*Subscriber, error) {
@@ -187,20 +262,73 @@ func AllSubscribers(cfg *Config) ([]*Subscriber, error) {
 // emails when object events occurs. Returned are the new subscribers or an error
 // if one occurred.
 func SubscribeEmail(cfg *Config, emails ...string) ([]*Subscriber, error) {
+	return SubscribeEmailWith(cfg, Subscription{}, emails...)
+}
+
+// SubscribeEmailWith subscribes one or more email addresses to receive
+// notifications with the subscription options. The options replace the
+// options of addresses that are already subscribed. The subscriptions are
+// confirmed. Returned are the new subscribers or an error if one occurred.
+func SubscribeEmailWith(cfg *Config, s Subscription, emails ...string) ([]*Subscriber, error) {
+	return subscribe(cfg, s, false, emails)
+}
+
+// RequestSubscription subscribes one or more email addresses like
+// SubscribeEmailWith, but new subscribers are pending until they confirm the
+// subscription using the link in the confirmation email sent to them. The
+// options of confirmed subscribers are not changed, since anyone can request
+// a subscription. Pending subscribers get the new options and are sent the
+// confirmation again. Returned are the new and pending subscribers.
+func RequestSubscription(cfg *Config, s Subscription, emails ...string) ([]*Subscriber, error) {
+	subs, err := subscribe(cfg, s, true, emails)
+
+	if err != nil {
+		return subs, err
+	}
+
+	for _, sub := range subs {
+		if err = sendConfirmation(cfg, sub); err != nil {
+			return subs, err
+		}
+	}
+
+	return subs, nil
+}
+
+func subscribe(cfg *Config, s Subscription, pending bool, emails []string) ([]*Subscriber, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+
 	c := cfg.Mongo.Subscribers()
 
 	var (
-		q    bson.M
-		err  error
-		chg  mgo.Change
-		info *mgo.ChangeInfo
-		sub  *Subscriber
-		subs []*Subscriber
+		q      bson.M
+		err    error
+		token  string
+		insert bson.M
+		update bson.M
+		chg    mgo.Change
+		info   *mgo.ChangeInfo
+		sub    *Subscriber
+		subs   []*Subscriber
 	)
 
+	options := bson.M{
+		"patterns": s.Patterns,
+		"events":   s.Events,
+		"fields":   s.Fields,
+		"digest":   s.Digest,
+		"quiet":    s.Quiet,
+	}
+
 	// Upsert the subscribers based on the email address. Email
 	// addresses to lowercased for consistency.
 	for _, email := range emails {
+		if token, err = newSecret(); err != nil {
+			break
+		}
+
 		sub = &Subscriber{
 			Email: strings.ToLower(email),
 			Time:  time.Now().UTC(),
@@ -210,12 +338,54 @@ func SubscribeEmail(cfg *Config, emails ...string) ([]*Subscriber, error) {
 			"email": sub.Email,
 		}
 
+		insert = bson.M{
+			"email": sub.Email,
+			"time":  sub.Time,
+			"token": token,
+		}
+
+		if pending {
+			// Pending subscribers get the new options.
+			chg = mgo.Change{
+				ReturnNew: true,
+				Update:    bson.M{"$set": options},
+			}
+
+			_, err = c.Find(bson.M{"email": sub.Email, "pending": true}).Apply(chg, sub)
+
+			if err == nil {
+				subs = append(subs, sub)
+				continue
+			}
+
+			if err != mgo.ErrNotFound {
+				break
+			}
+
+			// New subscribers are pending until confirmed. Confirmed
+			// subscribers are left as is.
+			insert["pending"] = true
+
+			for k, v := range options {
+				insert[k] = v
+			}
+
+			update = bson.M{
+				"$setOnInsert": insert,
+			}
+		} else {
+			// The subscription is confirmed.
+			update = bson.M{
+				"$setOnInsert": insert,
+				"$set":         options,
+				"$unset":       bson.M{"pending": 1},
+			}
+		}
+
 		chg = mgo.Change{
 			Upsert:    true,
 			ReturnNew: true,
-			Update: bson.M{
-				"$setOnInsert": sub,
-			},
+			Update:    update,
 		}
 
 		if info, err = c.Find(q).Apply(chg, sub); err != nil {
@@ -226,7 +396,6 @@ func SubscribeEmail(cfg *Config, emails ...string) ([]*Subscriber, error) {
 		if info.Updated == 0 {
 			subs = append(subs, sub)
 		}
-
 	}
 
 	return subs, err
@@ -266,6 +435,82 @@ func UnsubscribeEmail(cfg *Config, emails ...string) (int, error) {
 	return n, err
 }
 
+// ConfirmSubscription confirms the subscription of the subscriber with the
+// token. Returns false if no subscriber has the token.
+func ConfirmSubscription(cfg *Config, token string) (bool, error) {
+	if token == "" {
+		return false, nil
+	}
+
+	c := cfg.Mongo.Subscribers()
+
+	q := bson.M{
+		"token": token,
+	}
+
+	err := c.Update(q, bson.M{"$unset": bson.M{"pending": 1}})
+
+	// No subscriber with the token.
+	if err == mgo.ErrNotFound {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// SubscriberByToken returns the subscriber with the token or nil if no
+// subscriber has the token.
+func SubscriberByToken(cfg *Config, token string) (*Subscriber, error) {
+	if token == "" {
+		return nil, nil
+	}
+
+	var sub Subscriber
+
+	err := cfg.Mongo.Subscribers().Find(bson.M{"token": token}).One(&sub)
+
+	if err == mgo.ErrNotFound {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &sub, nil
+}
+
+// UnsubscribeToken removes the subscriber with the token. Returns false if
+// no subscriber has the token.
+func UnsubscribeToken(cfg *Config, token string) (bool, error) {
+	if token == "" {
+		return false, nil
+	}
+
+	c := cfg.Mongo.Subscribers()
+
+	q := bson.M{
+		"token": token,
+	}
+
+	err := c.Remove(q)
+
+	// No subscriber with the token.
+	if err == mgo.ErrNotFound {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
 func UnsubscribeID(cfg *Config, id bson.ObjectId) (bool, error) {
 	c := cfg.Mongo.Subscribers()
 
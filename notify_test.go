@@ -27,3 +27,32 @@ func TestSubscribeEmail(t *testing.T) {
 		t.Errorf("expected 1 subscriber, got %d", n)
 	}
 }
+
+func TestConfirmSubscription(t *testing.T) {
+	defer cfg.Mongo.Close()
+	resetDB()
+
+	subs, err := subscribe(cfg, Subscription{}, true, []string{"test@example.com"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sub := subs[0]
+
+	if !sub.Pending || sub.Token == "" {
+		t.Fatalf("expected pending subscriber with a token, got %+v", sub)
+	}
+
+	if ok, err := ConfirmSubscription(cfg, sub.Token); !ok || err != nil {
+		t.Fatalf("expected subscription to be confirmed (%v)", err)
+	}
+
+	if ok, err := UnsubscribeToken(cfg, sub.Token); !ok || err != nil {
+		t.Fatalf("expected subscriber to be removed (%v)", err)
+	}
+
+	if ok, _ := UnsubscribeToken(cfg, sub.Token); ok {
+		t.Error("expected token to no longer exist")
+	}
+}
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"reflect"
 
@@ -22,6 +25,18 @@ type Revision struct {
 	Additions map[string]interface{} `bson:",omitempty" json:"additions,omitempty"`
 	Removals  map[string]interface{} `bson:",omitempty" json:"removals,omitempty"`
 	Changes   map[string]Change      `bson:",omitempty" json:"changes,omitempty"`
+
+	// Name of the identity that put the revision.
+	Author string `bson:",omitempty" json:"author,omitempty"`
+
+	// Content hash of the object value as of this revision.
+	Hash string `bson:",omitempty" json:"hash,omitempty"`
+
+	// Position of the revision in the change feed.
+	Seq int64 `bson:",omitempty" json:"-" yaml:"-"`
+
+	// Link to the object at this version. Set in HTTP responses.
+	URL string `bson:"-" json:"url,omitempty" yaml:",omitempty"`
 }
 
 type Object struct {
@@ -31,6 +46,17 @@ type Object struct {
 	Version int                    `json:"version"`
 	Time    int64                  `json:"time"`
 	History []*Revision            `json:"history,omitempty" yaml:",omitempty"`
+
+	// Content hash of the value. Not set on objects put before hashes
+	// were introduced until they are put again.
+	Hash string `bson:",omitempty" json:"hash,omitempty"`
+
+	// Set while revisions of the object have not been assigned their
+	// position in the change feed.
+	Unsequenced bool `bson:",omitempty" json:"-" yaml:"-"`
+
+	// Link to the object at this version. Set in HTTP responses.
+	URL string `bson:"-" json:"url,omitempty" yaml:",omitempty"`
 }
 
 func applyRevision(o *Object, r *Revision) {
@@ -42,6 +68,7 @@ func applyRevision(o *Object, r *Revision) {
 
 	o.Version = r.Version
 	o.Time = r.Time
+	o.Hash = r.Hash
 
 	if r.Additions != nil {
 		for key, val = range r.Additions {
@@ -112,6 +139,42 @@ func (o *Object) AtTime(t int64) *Object {
 	return &n
 }
 
+// ContentHash returns the hex-encoded SHA-256 hash of the canonical JSON
+// encoding of the value. Keys are sorted and whitespace is omitted so equal
+// values have the same hash regardless of how they were formatted.
+func ContentHash(v map[string]interface{}) (string, error) {
+	b, err := canonicalJSON(v)
+
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.Sum256(b)
+
+	return hex.EncodeToString(h[:]), nil
+}
+
+// canonicalJSON returns the JSON encoding of the value with sorted keys and
+// without whitespace.
+func canonicalJSON(v map[string]interface{}) ([]byte, error) {
+	if v == nil {
+		v = map[string]interface{}{}
+	}
+
+	// Map keys are encoded in sorted order.
+	return json.Marshal(v)
+}
+
+// ValueHash returns the content hash of the value. The hash is computed if
+// the object was put before hashes were stored.
+func (o *Object) ValueHash(enc *EncryptionConfig) (string, error) {
+	if o.Hash != "" {
+		return o.Hash, nil
+	}
+
+	return enc.ContentHash(o.Value)
+}
+
 // Diff returns the set of changes representing the different between two
 // documents. Compares the before (`b`) and after (`a`) state of the document.
 // Currently this only diffs the top-level keys and does not recurse into
@@ -190,3 +253,59 @@ func Diff(b, a map[string]interface{}) *Revision {
 
 	return &r
 }
+
+// asDoc returns the value as a document if it is one. Embedded documents
+// are decoded from MongoDB as bson.M.
+func asDoc(v interface{}) (map[string]interface{}, bool) {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		return x, true
+
+	case bson.M:
+		return x, true
+	}
+
+	return nil, false
+}
+
+func copyDoc(doc map[string]interface{}) map[string]interface{} {
+	n := make(map[string]interface{}, len(doc))
+
+	for k, v := range doc {
+		n[k] = v
+	}
+
+	return n
+}
+
+// mapPath returns a copy of the document with the value at the path replaced
+// by the result of fn. The path is a list of keys of nested documents. The
+// document is returned as is if the path does not exist.
+func mapPath(doc map[string]interface{}, path []string, fn func(interface{}) (interface{}, error)) (map[string]interface{}, error) {
+	v, ok := doc[path[0]]
+
+	if !ok {
+		return doc, nil
+	}
+
+	var err error
+
+	if len(path) > 1 {
+		sub, ok := asDoc(v)
+
+		if !ok {
+			return doc, nil
+		}
+
+		if v, err = mapPath(sub, path[1:], fn); err != nil {
+			return nil, err
+		}
+	} else if v, err = fn(v); err != nil {
+		return nil, err
+	}
+
+	doc = copyDoc(doc)
+	doc[path[0]] = v
+
+	return doc, nil
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo"
+)
+
+// schema is a JSON Schema in the OpenAPI document.
+type schema map[string]interface{}
+
+func ref(name string) schema {
+	return schema{"$ref": "#/components/schemas/" + name}
+}
+
+func props(required []string, p schema) schema {
+	s := schema{
+		"type":       "object",
+		"properties": p,
+	}
+
+	if len(required) > 0 {
+		s["required"] = required
+	}
+
+	return s
+}
+
+var (
+	stringSchema  = schema{"type": "string"}
+	integerSchema = schema{"type": "integer"}
+	boolSchema    = schema{"type": "boolean"}
+	timeSchema    = schema{"type": "string", "format": "date-time"}
+	stringsSchema = schema{"type": "array", "items": stringSchema}
+)
+
+// openapiSchemas are the schemas of the bodies referenced by routes.
+var openapiSchemas = map[string]schema{
+	"Info": props(nil, schema{
+		"name":    stringSchema,
+		"version": stringSchema,
+	}),
+
+	"Value": {
+		"type":                 "object",
+		"additionalProperties": true,
+	},
+
+	"Change": props(nil, schema{
+		"before": schema{},
+		"after":  schema{},
+	}),
+
+	"Revision": props([]string{"version", "time"}, schema{
+		"version":   integerSchema,
+		"time":      schema{"type": "integer", "description": "Unix time."},
+		"additions": ref("Value"),
+		"removals":  ref("Value"),
+		"changes":   schema{"type": "object", "additionalProperties": ref("Change")},
+		"author":    stringSchema,
+		"hash":      stringSchema,
+		"url":       stringSchema,
+	}),
+
+	"Object": props([]string{"key", "value", "version", "time"}, schema{
+		"key":     stringSchema,
+		"value":   ref("Value"),
+		"version": integerSchema,
+		"time":    schema{"type": "integer", "description": "Unix time."},
+		"hash":    stringSchema,
+		"url":     stringSchema,
+	}),
+
+	"Event": props([]string{"key", "revision"}, schema{
+		"key":      stringSchema,
+		"revision": ref("Revision"),
+	}),
+
+	"Changes": props([]string{"changes", "cursor"}, schema{
+		"changes": schema{"type": "array", "items": ref("Event")},
+		"cursor":  stringSchema,
+	}),
+
+	"Subscriber": props([]string{"email"}, schema{
+		"_id":      stringSchema,
+		"email":    stringSchema,
+		"time":     timeSchema,
+		"pending":  boolSchema,
+		"patterns": stringsSchema,
+		"events":   stringsSchema,
+		"fields":   stringsSchema,
+		"digest":   schema{"type": "string", "enum": []string{DigestHourly, DigestDaily, DigestQuiet}},
+		"quiet":    stringSchema,
+	}),
+
+	"Subscribe": props([]string{"emails"}, schema{
+		"emails":   stringsSchema,
+		"patterns": stringsSchema,
+		"events":   stringsSchema,
+		"fields":   stringsSchema,
+		"digest":   schema{"type": "string", "enum": []string{DigestHourly, DigestDaily, DigestQuiet}},
+		"quiet":    stringSchema,
+	}),
+
+	"Subscribed": props(nil, schema{
+		"subscribed": integerSchema,
+	}),
+
+	"Webhook": props([]string{"url"}, schema{
+		"_id":    stringSchema,
+		"url":    stringSchema,
+		"secret": stringSchema,
+		"time":   timeSchema,
+	}),
+
+	"Delivery": props(nil, schema{
+		"_id":     stringSchema,
+		"webhook": stringSchema,
+		"event":   stringSchema,
+		"key":     stringSchema,
+		"version": integerSchema,
+		"attempt": integerSchema,
+		"status":  integerSchema,
+		"error":   stringSchema,
+		"time":    timeSchema,
+	}),
+
+	"AuditEntry": props(nil, schema{
+		"_id":       stringSchema,
+		"time":      timeSchema,
+		"identity":  stringSchema,
+		"operation": stringSchema,
+		"key":       stringSchema,
+		"version":   integerSchema,
+		"client":    stringSchema,
+		"outcome":   schema{"type": "string", "enum": []string{AuditOK, AuditNotFound, AuditDenied, AuditFailed}},
+		"error":     stringSchema,
+	}),
+
+	"GraphQLRequest": props([]string{"query"}, schema{
+		"query":         stringSchema,
+		"operationName": stringSchema,
+		"variables":     schema{"type": "object", "additionalProperties": true},
+	}),
+
+	"GraphQLResult": props(nil, schema{
+		"data":   schema{"type": "object", "additionalProperties": true},
+		"errors": schema{"type": "array", "items": schema{"type": "object", "additionalProperties": true}},
+	}),
+
+	"Error": props([]string{"code", "message"}, schema{
+		"code":    stringSchema,
+		"message": stringSchema,
+		"details": schema{},
+	}),
+}
+
+// Descriptions of path parameters.
+var pathParams = map[string]string{
+	"key":     "Key of the object.",
+	"version": "Version of the object.",
+	"time":    "Time (or duration relative to now) of the state of the object.",
+	"token":   "Subscriber token.",
+	"id":      "Webhook id.",
+}
+
+var pathParamRegexp = regexp.MustCompile(`:(\w+)`)
+
+// bodySchema returns the schema of a body, e.g. Object or []Object.
+func bodySchema(name string) schema {
+	if strings.HasPrefix(name, "[]") {
+		return schema{"type": "array", "items": bodySchema(name[2:])}
+	}
+
+	if name == "string" {
+		return stringSchema
+	}
+
+	return ref(name)
+}
+
+func jsonContent(name string) schema {
+	return schema{
+		"application/json": schema{"schema": bodySchema(name)},
+	}
+}
+
+// openapiOperation returns the operation of the route.
+func openapiOperation(r *route) schema {
+	var params []schema
+
+	for _, m := range pathParamRegexp.FindAllStringSubmatch(r.Path, -1) {
+		t := "string"
+
+		if m[1] == "version" {
+			t = "integer"
+		}
+
+		params = append(params, schema{
+			"name":        m[1],
+			"in":          "path",
+			"required":    true,
+			"description": pathParams[m[1]],
+			"schema":      schema{"type": t},
+		})
+	}
+
+	for _, q := range r.Query {
+		params = append(params, schema{
+			"name":        q.Name,
+			"in":          "query",
+			"description": q.Description,
+			"schema":      schema{"type": q.Type},
+		})
+	}
+
+	ok := schema{"description": http.StatusText(r.Status)}
+
+	if r.Response != "" {
+		ok["content"] = jsonContent(r.Response)
+	}
+
+	op := schema{
+		"summary": r.Summary,
+		"responses": schema{
+			strconv.Itoa(r.Status): ok,
+			"default": schema{
+				"description": "Error",
+				"content":     jsonContent("Error"),
+			},
+		},
+	}
+
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+
+	if r.Body != "" {
+		op["requestBody"] = schema{
+			"required": true,
+			"content":  jsonContent(r.Body),
+		}
+	}
+
+	// Public paths do not require credentials.
+	if isPublicPath(r.Path) {
+		op["security"] = []schema{}
+	}
+
+	return op
+}
+
+// openapiDocument returns the OpenAPI 3 document describing the routes.
+func openapiDocument(cfg *Config) schema {
+	paths := schema{}
+
+	for _, r := range apiRoutes() {
+		p := pathParamRegexp.ReplaceAllString(r.Path, "{$1}")
+
+		item, ok := paths[p].(schema)
+
+		if !ok {
+			item = schema{}
+			paths[p] = item
+		}
+
+		item[strings.ToLower(r.Method)] = openapiOperation(r)
+	}
+
+	doc := schema{
+		"openapi": "3.0.0",
+		"info": schema{
+			"title":   "SCDS",
+			"version": progVersion.String(),
+		},
+		"servers": []schema{
+			{"url": cfg.HTTP.URL("")},
+		},
+		"paths": paths,
+		"components": schema{
+			"schemas": openapiSchemas,
+			"securitySchemes": schema{
+				"bearer": schema{"type": "http", "scheme": "bearer"},
+				"basic":  schema{"type": "http", "scheme": "basic"},
+			},
+		},
+	}
+
+	if cfg.Auth.Enabled {
+		doc["security"] = []schema{
+			{"bearer": []string{}},
+			{"basic": []string{}},
+		}
+	}
+
+	return doc
+}
+
+func openapiHandler(c echo.Context) error {
+	cfg := c.Get("config").(*Config)
+
+	return c.JSON(http.StatusOK, openapiDocument(cfg))
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chop-dbhi/scds/client"
+)
+
+func TestOpenAPIDocument(t *testing.T) {
+	doc := openapiDocument(cfg)
+	paths := doc["paths"].(schema)
+
+	for _, r := range apiRoutes() {
+		for _, name := range []string{r.Body, r.Response} {
+			name = strings.TrimPrefix(name, "[]")
+
+			if _, ok := openapiSchemas[name]; name != "" && name != "string" && !ok {
+				t.Errorf("%s %s: unknown schema %s", r.Method, r.Path, name)
+			}
+		}
+	}
+
+	item, ok := paths["/objects/{key}/v/{version}"].(schema)
+
+	if !ok {
+		t.Fatal("expected path of object versions")
+	}
+
+	op := item["get"].(schema)
+	params := op["parameters"].([]schema)
+
+	if len(params) != 2 || params[0]["name"] != "key" || params[1]["name"] != "version" {
+		t.Errorf("expected key and version parameters, got %v", params)
+	}
+
+	if _, ok := paths["/objects/{key}"].(schema)["head"]; !ok {
+		t.Error("expected head operation of objects")
+	}
+}
+
+// jsonFields returns the types of the JSON fields of the struct including
+// the fields of embedded structs.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+
+		if f.Anonymous && tag == "" {
+			for name, ft := range jsonFields(f.Type) {
+				fields[name] = ft
+			}
+
+			continue
+		}
+
+		name := strings.Split(tag, ",")[0]
+
+		if name == "-" {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		fields[name] = f.Type
+	}
+
+	return fields
+}
+
+// checkClientType checks the fields of the client type against the schema
+// and the schemas it references.
+func checkClientType(t *testing.T, name string, typ reflect.Type) {
+	for typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Slice {
+		typ = typ.Elem()
+	}
+
+	props, _ := openapiSchemas[name]["properties"].(schema)
+	fields := jsonFields(typ)
+
+	for prop := range props {
+		if _, ok := fields[prop]; !ok {
+			t.Errorf("client %s: missing field %s of schema %s", typ.Name(), prop, name)
+		}
+	}
+
+	for field, ft := range fields {
+		p, ok := props[field].(schema)
+
+		if !ok {
+			t.Errorf("client %s: field %s is not in schema %s", typ.Name(), field, name)
+			continue
+		}
+
+		if items, ok := p["items"].(schema); ok {
+			p = items
+		}
+
+		if r, ok := p["$ref"].(string); ok && ft.Kind() != reflect.Map {
+			checkClientType(t, strings.TrimPrefix(r, "#/components/schemas/"), ft)
+			continue
+		}
+
+		for ft.Kind() == reflect.Ptr || ft.Kind() == reflect.Slice {
+			ft = ft.Elem()
+		}
+
+		var kind string
+
+		switch {
+		case ft == reflect.TypeOf(time.Time{}), ft.Kind() == reflect.String:
+			kind = "string"
+		case ft.Kind() == reflect.Int, ft.Kind() == reflect.Int64:
+			kind = "integer"
+		case ft.Kind() == reflect.Bool:
+			kind = "boolean"
+		}
+
+		if pt, _ := p["type"].(string); kind != "" && pt != kind && pt != "array" {
+			t.Errorf("client %s: field %s is a %s, schema %s has %s", typ.Name(), field, kind, name, pt)
+		}
+	}
+}
+
+// TestClientOpenAPI checks the requests and response types of the client
+// against the routes and schemas of the API.
+func TestClientOpenAPI(t *testing.T) {
+	type request struct {
+		Method string
+		Path   string
+		Query  map[string][]string
+		Body   []byte
+	}
+
+	var reqs []*request
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		reqs = append(reqs, &request{r.Method, r.URL.Path, r.URL.Query(), b})
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	defer srv.Close()
+
+	c := client.New(srv.URL)
+
+	// Set all fields so they are sent.
+	sub := client.Subscription{Patterns: []string{"*"}, Events: []string{"new"}, Fields: []string{"name"}, Digest: DigestDaily, Quiet: "1h"}
+	aq := client.AuditQuery{Identity: "bob", Operation: OpGet, Key: "bob", Since: "24h", Limit: 10}
+
+	tests := []struct {
+		Call     func()
+		Response interface{}
+	}{
+		{func() { c.Put("bob", map[string]interface{}{"name": "Bob"}) }, client.Revision{}},
+		{func() { c.Get("bob") }, client.Object{}},
+		{func() { c.GetVersion("bob", 2) }, client.Object{}},
+		{func() { c.GetTime("bob", time.Now()) }, client.Object{}},
+		{func() { c.Log("bob") }, []*client.Revision{}},
+		{func() { c.Keys() }, []string{}},
+		{func() { c.Changes("24h", 10) }, client.Changes{}},
+		{func() { c.Subscribers() }, []*client.Subscriber{}},
+		{func() { c.Subscribe(sub, "bob@example.com") }, nil},
+		{func() { c.Unsubscribe("abc") }, nil},
+		{func() { c.Webhooks() }, []*client.Webhook{}},
+		{func() { c.AddWebhook("https://example.org/hook", "secret") }, client.Webhook{}},
+		{func() { c.RemoveWebhook("abc") }, nil},
+		{func() { c.Deliveries("abc", 10) }, []*client.Delivery{}},
+		{func() { c.Audit(aq) }, []*client.AuditEntry{}},
+	}
+
+	routes := apiRoutes()
+
+	for _, test := range tests {
+		reqs = nil
+		test.Call()
+
+		if len(reqs) != 1 {
+			t.Errorf("expected 1 request, got %d", len(reqs))
+			continue
+		}
+
+		req := reqs[0]
+
+		var route *route
+
+		for _, r := range routes {
+			re := regexp.MustCompile("^" + pathParamRegexp.ReplaceAllString(r.Path, "[^/]+") + "$")
+
+			if r.Method == req.Method && re.MatchString(req.Path) {
+				route = r
+				break
+			}
+		}
+
+		if route == nil {
+			t.Errorf("%s %s: no route", req.Method, req.Path)
+			continue
+		}
+
+		for name := range req.Query {
+			var ok bool
+
+			for _, q := range route.Query {
+				ok = ok || q.Name == name
+			}
+
+			if !ok {
+				t.Errorf("%s %s: unknown query parameter %s", req.Method, route.Path, name)
+			}
+		}
+
+		// Keys of the body are checked against the schema.
+		if props, ok := openapiSchemas[route.Body]["properties"].(schema); ok {
+			var body map[string]interface{}
+
+			if err := json.Unmarshal(req.Body, &body); err != nil {
+				t.Errorf("%s %s: %s", req.Method, route.Path, err)
+			}
+
+			for name := range body {
+				if _, ok := props[name]; !ok {
+					t.Errorf("%s %s: field %s is not in schema %s", req.Method, route.Path, name, route.Body)
+				}
+			}
+		}
+
+		if test.Response == nil {
+			continue
+		}
+
+		name := strings.TrimPrefix(route.Response, "[]")
+
+		if strings.HasPrefix(route.Response, "[]") != (reflect.TypeOf(test.Response).Kind() == reflect.Slice) {
+			t.Errorf("%s %s: client type %T does not match %s", req.Method, route.Path, test.Response, route.Response)
+			continue
+		}
+
+		if name == "string" {
+			if reflect.TypeOf(test.Response).Elem().Kind() != reflect.String {
+				t.Errorf("%s %s: client type %T does not match %s", req.Method, route.Path, test.Response, route.Response)
+			}
+
+			continue
+		}
+
+		checkClientType(t, name, reflect.TypeOf(test.Response))
+	}
+}
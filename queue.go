@@ -0,0 +1,397 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Notification channels.
+const (
+	ChannelEmail   = "email"
+	ChannelWebhook = "webhook"
+	ChannelDigest  = "digest"
+)
+
+// Statuses of queued notifications. Delivered notifications are removed
+// from the queue.
+const (
+	JobPending = "pending"
+	JobSending = "sending"
+	JobDead    = "dead"
+
+	// Held until the digest of the subscriber is sent.
+	JobHeld = "held"
+)
+
+// Duration a worker holds a claimed job before it is considered abandoned
+// and made available to other workers.
+const jobLease = 5 * time.Minute
+
+var (
+	errTargetRemoved = errors.New("notification target no longer exists")
+
+	// The lease expired and the job was claimed again or changed, so the
+	// outcome of the attempt is not recorded.
+	errLeaseLost = errors.New("lease on the notification was lost")
+)
+
+// Job is a queued notification of a revision to a single subscriber or webhook.
+type Job struct {
+	ID       bson.ObjectId `bson:"_id,omitempty" json:"_id,omitempty"`
+	Channel  string        `json:"channel"`
+	Target   bson.ObjectId `json:"target"`
+	Key      string        `json:"key"`
+	Revision *Revision     `json:"revision"`
+	Status   string        `json:"status"`
+	Attempts int           `json:"attempts"`
+	Error    string        `bson:",omitempty" json:"error,omitempty"`
+	Next     time.Time     `json:"next"`
+	Time     time.Time     `json:"time"`
+}
+
+// Enqueue queues notifications of the revision for all subscribers and
+// webhooks interested in it.
+func Enqueue(cfg *Config, o *Object, r *Revision) error {
+	var (
+		subs  []*Subscriber
+		hooks []*Webhook
+		jobs  []interface{}
+	)
+
+	// Pending subscribers have not confirmed their subscription.
+	if err := cfg.Mongo.Subscribers().Find(bson.M{"pending": bson.M{"$ne": true}}).All(&subs); err != nil {
+		return err
+	}
+
+	if err := cfg.Mongo.Webhooks().Find(nil).Select(bson.M{"_id": 1}).All(&hooks); err != nil {
+		return err
+	}
+
+	// Subscribers are matched against the revision before it is encrypted.
+	er, err := cfg.Encryption.EncryptRevision(r)
+
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+
+	newJob := func(channel string, target bson.ObjectId) *Job {
+		return &Job{
+			ID:       bson.NewObjectId(),
+			Channel:  channel,
+			Target:   target,
+			Key:      o.Key,
+			Revision: er,
+			Status:   JobPending,
+			Next:     now,
+			Time:     now,
+		}
+	}
+
+	for _, sub := range subs {
+		// Not interested in this object or event.
+		if !sub.Match(o.Key, r) {
+			continue
+		}
+
+		// Held for the subscriber's digest.
+		if sub.Digest != "" {
+			j := newJob(ChannelDigest, sub.ID)
+			j.Status = JobHeld
+			jobs = append(jobs, j)
+			continue
+		}
+
+		jobs = append(jobs, newJob(ChannelEmail, sub.ID))
+	}
+
+	for _, w := range hooks {
+		jobs = append(jobs, newJob(ChannelWebhook, w.ID))
+	}
+
+	// Nothing to notify.
+	if len(jobs) == 0 {
+		return nil
+	}
+
+	return cfg.Mongo.Notifications().Insert(jobs...)
+}
+
+// claimJob claims the next job that is due. Jobs whose lease has expired
+// are claimed again. Digests are sent by FlushDigests rather than claimed.
+// Returns nil if no jobs are due.
+func claimJob(cfg *Config) (*Job, error) {
+	now := time.Now().UTC()
+
+	q := bson.M{
+		"channel": bson.M{
+			"$in": []string{ChannelEmail, ChannelWebhook},
+		},
+		"status": bson.M{
+			"$in": []string{JobPending, JobSending},
+		},
+		"next": bson.M{
+			"$lte": now,
+		},
+	}
+
+	chg := mgo.Change{
+		ReturnNew: true,
+		Update: bson.M{
+			"$set": bson.M{
+				"status": JobSending,
+				"next":   now.Add(jobLease),
+			},
+			"$inc": bson.M{
+				"attempts": 1,
+			},
+		},
+	}
+
+	var j Job
+
+	_, err := cfg.Mongo.Notifications().Find(q).Sort("next").Apply(chg, &j)
+
+	if err == mgo.ErrNotFound {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Jobs that cannot be decrypted are dead rather than left to be
+	// claimed again each time their lease expires.
+	if err = cfg.Encryption.DecryptRevision(j.Revision); err != nil {
+		set := bson.M{
+			"status": JobDead,
+			"error":  err.Error(),
+		}
+
+		if uerr := cfg.Mongo.Notifications().UpdateId(j.ID, bson.M{"$set": set}); uerr != nil {
+			return nil, uerr
+		}
+
+		return nil, fmt.Errorf("%s notification for %s: %s", j.Channel, j.Key, err)
+	}
+
+	return &j, nil
+}
+
+// deliverJob makes a single delivery attempt of the job. The returned bool
+// is true if a failed delivery should be retried.
+func deliverJob(cfg *Config, j *Job) (bool, error) {
+	switch j.Channel {
+	case ChannelEmail:
+		var sub Subscriber
+
+		err := cfg.Mongo.Subscribers().FindId(j.Target).One(&sub)
+
+		// Subscriber was removed since the job was queued.
+		if err == mgo.ErrNotFound {
+			return false, errTargetRemoved
+		}
+
+		if err != nil {
+			return true, err
+		}
+
+		return true, sendEmail(cfg, &sub, j.Key, j.Revision)
+
+	case ChannelWebhook:
+		var w Webhook
+
+		err := cfg.Mongo.Webhooks().FindId(j.Target).One(&w)
+
+		// Webhook was removed since the job was queued.
+		if err == mgo.ErrNotFound {
+			return false, errTargetRemoved
+		}
+
+		if err != nil {
+			return true, err
+		}
+
+		status, err := sendWebhook(cfg, &w, j.Key, j.Revision, j.Attempts)
+
+		return retryable(status), err
+	}
+
+	return false, fmt.Errorf("unknown notification channel: %s", j.Channel)
+}
+
+// processJob delivers the job and updates the queue with the outcome. Failed
+// deliveries are retried with exponential backoff until the number of retries
+// is exhausted at which point the job is marked as dead. Returns
+// errLeaseLost if the job was claimed again during the delivery.
+func processJob(cfg *Config, j *Job) error {
+	c := cfg.Mongo.Notifications()
+
+	retry, err := deliverJob(cfg, j)
+
+	// Only the worker holding the lease records the outcome.
+	q := bson.M{
+		"_id":      j.ID,
+		"attempts": j.Attempts,
+		"status":   JobSending,
+	}
+
+	// Delivered.
+	if err == nil {
+		if err = c.Remove(q); err == mgo.ErrNotFound {
+			return errLeaseLost
+		}
+
+		return err
+	}
+
+	log.Printf("[notify] error delivering %s notification for %s (attempt %d): %s", j.Channel, j.Key, j.Attempts, err)
+
+	set := bson.M{
+		"error": err.Error(),
+	}
+
+	if retry && j.Attempts <= cfg.Notify.Retries {
+		set["status"] = JobPending
+		set["next"] = time.Now().UTC().Add(cfg.Notify.Backoff << uint(j.Attempts-1))
+	} else {
+		set["status"] = JobDead
+	}
+
+	if err = c.Update(q, bson.M{"$set": set}); err == mgo.ErrNotFound {
+		return errLeaseLost
+	}
+
+	return err
+}
+
+// RunWorkers delivers queued notifications using n workers until the quit
+// channel is closed. Workers poll the queue for due jobs and are woken by
+// the broker when revisions are published. Digests that are due are sent
+// at the same interval.
+func RunWorkers(cfg *Config, n int, quit <-chan struct{}) {
+	var wg sync.WaitGroup
+
+	// Initialize the session before it is shared.
+	cfg.Mongo.Session()
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		for {
+			if err := FlushDigests(cfg); err != nil {
+				log.Printf("[notify] error sending digests: %s", err)
+			}
+
+			select {
+			case <-quit:
+				return
+			case <-time.After(cfg.Notify.Poll):
+			}
+		}
+	}()
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			var wake chan struct{}
+
+			if cfg.broker != nil {
+				wake = cfg.broker.Subscribe()
+				defer cfg.broker.Unsubscribe(wake)
+			}
+
+			for {
+				j, err := claimJob(cfg)
+
+				if err != nil {
+					log.Printf("[notify] error claiming notification: %s", err)
+				}
+
+				if j != nil {
+					if err = processJob(cfg, j); err != nil {
+						log.Printf("[notify] error updating notification: %s", err)
+					}
+
+					continue
+				}
+
+				select {
+				case <-quit:
+					return
+				case <-wake:
+				case <-time.After(cfg.Notify.Poll):
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// QueueStatus returns the number of queued notifications by status.
+func QueueStatus(cfg *Config) (map[string]int, error) {
+	pipe := []bson.M{
+		{"$group": bson.M{"_id": "$status", "count": bson.M{"$sum": 1}}},
+	}
+
+	var docs []struct {
+		ID    string `bson:"_id"`
+		Count int
+	}
+
+	if err := cfg.Mongo.Notifications().Pipe(pipe).All(&docs); err != nil {
+		return nil, err
+	}
+
+	status := map[string]int{
+		JobPending: 0,
+		JobSending: 0,
+		JobHeld:    0,
+		JobDead:    0,
+	}
+
+	for _, d := range docs {
+		status[d.ID] = d.Count
+	}
+
+	return status, nil
+}
+
+// DeadJobs returns the most recent notifications that could not be delivered.
+func DeadJobs(cfg *Config, limit int) ([]*Job, error) {
+	q := bson.M{
+		"status": JobDead,
+	}
+
+	var jobs []*Job
+
+	if err := cfg.Mongo.Notifications().Find(q).Sort("-time").Limit(limit).All(&jobs); err != nil {
+		return nil, err
+	}
+
+	// Jobs are dead-lettered when their revision cannot be decrypted so
+	// the error is returned with the job and the contents are dropped.
+	for _, j := range jobs {
+		if err := cfg.Encryption.DecryptRevision(j.Revision); err != nil {
+			j.Error = err.Error()
+			j.Revision.Additions = nil
+			j.Revision.Removals = nil
+			j.Revision.Changes = nil
+		}
+	}
+
+	return jobs, nil
+}
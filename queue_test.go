@@ -0,0 +1,154 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestEnqueue(t *testing.T) {
+	defer cfg.Mongo.Close()
+	resetDB()
+
+	if _, err := SubscribeEmailWith(cfg, Subscription{Filter: Filter{Patterns: []string{"users.*"}}}, "test@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Does not match the subscriber's filter.
+	if _, err := Put(cfg, "bob", map[string]interface{}{"name": "Bob"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Put(cfg, "users.bob", map[string]interface{}{"name": "Bob"}); err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := QueueStatus(cfg)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status[JobPending] != 1 {
+		t.Fatalf("expected 1 pending notification, got %d", status[JobPending])
+	}
+
+	j, err := claimJob(cfg)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if j == nil {
+		t.Fatal("expected a job to be claimed")
+	}
+
+	if j.Key != "users.bob" || j.Channel != ChannelEmail || j.Attempts != 1 {
+		t.Errorf("unexpected job %+v", j)
+	}
+
+	// Claimed jobs are leased to the worker.
+	if j, err = claimJob(cfg); j != nil || err != nil {
+		t.Errorf("expected no job to be claimed, got %v (%v)", j, err)
+	}
+}
+
+func TestProcessJobLeaseLost(t *testing.T) {
+	defer cfg.Mongo.Close()
+	resetDB()
+
+	sub, err := SubscribeEmailWith(cfg, Subscription{}, "test@example.com")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = Put(cfg, "bob", map[string]interface{}{"name": "Bob"}); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err := claimJob(cfg)
+
+	if err != nil || j == nil {
+		t.Fatalf("expected a job to be claimed, got %v (%v)", j, err)
+	}
+
+	// The lease expires and another worker claims the job.
+	err = cfg.Mongo.Notifications().UpdateId(j.ID, bson.M{"$inc": bson.M{"attempts": 1}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The subscriber is removed so the delivery fails without sending.
+	if err = cfg.Mongo.Subscribers().RemoveId(sub[0].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = processJob(cfg, j); err != errLeaseLost {
+		t.Fatalf("expected lease lost, got %v", err)
+	}
+
+	var s Job
+
+	if err = cfg.Mongo.Notifications().FindId(j.ID).One(&s); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Status != JobSending {
+		t.Errorf("expected the job to be left to the other worker, got %s", s.Status)
+	}
+}
+
+// insertUndecryptableJob queues a dead notification encrypted with a key
+// that is not in the keyfile of the config.
+func insertUndecryptableJob(t *testing.T) {
+	removed := testEncryption(t, "k3 ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA=", "ssn")
+
+	r, err := removed.EncryptRevision(&Revision{
+		Version:   1,
+		Additions: map[string]interface{}{"ssn": "123-45-6789"},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cfg.Mongo.Notifications().Insert(&Job{
+		ID:       bson.NewObjectId(),
+		Channel:  ChannelEmail,
+		Target:   bson.NewObjectId(),
+		Key:      "users.bob",
+		Revision: r,
+		Status:   JobDead,
+		Time:     time.Now().UTC(),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeadJobsUndecryptable(t *testing.T) {
+	defer cfg.Mongo.Close()
+	resetDB()
+
+	cfg.Encryption = *testEncryption(t, testKeys, "ssn")
+
+	insertUndecryptableJob(t)
+
+	jobs, err := DeadJobs(cfg, 10)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(jobs) != 1 {
+		t.Fatalf("expected 1 dead job, got %d", len(jobs))
+	}
+
+	if j := jobs[0]; j.Error == "" || j.Revision.Additions != nil {
+		t.Errorf("expected the decryption error without the contents, got %+v", j)
+	}
+}
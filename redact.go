@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/labstack/echo"
+)
+
+// Value redacted fields are replaced with.
+const redactedValue = "***"
+
+// Role that matches all identities in redaction rules.
+const redactAllRoles = "*"
+
+// RedactRule redacts the values of fields for identities with any of the
+// roles and in notifications sent over any of the channels. The fields are
+// still shown as added, removed, or changed.
+type RedactRule struct {
+	// Paths of the fields, e.g. `ssn` or `patient.dob`.
+	Fields []string
+
+	// Roles the fields are redacted for in HTTP responses. Use * for all
+	// identities. Admins always see the values.
+	Roles []string
+
+	// Notification channels the fields are redacted in, i.e. email, digest,
+	// or webhook.
+	Channels []string
+}
+
+// Validate checks the channels of the rule.
+func (r *RedactRule) Validate() error {
+	for _, c := range r.Channels {
+		switch c {
+		case ChannelEmail, ChannelDigest, ChannelWebhook:
+		default:
+			return fmt.Errorf("Unknown channel: %s", c)
+		}
+	}
+
+	return nil
+}
+
+// RedactConfig defines the redaction rules.
+type RedactConfig struct {
+	Rules []*RedactRule
+}
+
+// RoleFields returns the fields redacted for an identity with the roles.
+func (c *RedactConfig) RoleFields(roles []string) []string {
+	var fields []string
+
+	for _, r := range c.Rules {
+		for _, role := range r.Roles {
+			if role == redactAllRoles || containsString(roles, role) {
+				fields = append(fields, r.Fields...)
+				break
+			}
+		}
+	}
+
+	return fields
+}
+
+// ChannelFields returns the fields redacted in notifications sent over the
+// channel.
+func (c *RedactConfig) ChannelFields(channel string) []string {
+	var fields []string
+
+	for _, r := range c.Rules {
+		if containsString(r.Channels, channel) {
+			fields = append(fields, r.Fields...)
+		}
+	}
+
+	return fields
+}
+
+func containsString(a []string, s string) bool {
+	for _, x := range a {
+		if x == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+func redact(interface{}) (interface{}, error) {
+	return redactedValue, nil
+}
+
+// redactDoc returns a copy of the document with the values of the fields
+// redacted. The document is not modified.
+func redactDoc(doc map[string]interface{}, fields []string) map[string]interface{} {
+	if doc == nil {
+		return nil
+	}
+
+	for _, f := range fields {
+		// redact does not fail.
+		doc, _ = mapPath(doc, strings.Split(f, "."), redact)
+	}
+
+	return doc
+}
+
+// redactRevision returns a copy of the revision with the values of the
+// fields redacted. The hash of the unredacted value is removed.
+func redactRevision(r *Revision, fields []string) *Revision {
+	if r == nil || len(fields) == 0 {
+		return r
+	}
+
+	n := *r
+
+	n.Hash = ""
+
+	n.Additions = redactDoc(r.Additions, fields)
+	n.Removals = redactDoc(r.Removals, fields)
+
+	if r.Changes != nil {
+		n.Changes = make(map[string]Change, len(r.Changes))
+
+		for k, chg := range r.Changes {
+			b := redactDoc(map[string]interface{}{k: chg.Before}, fields)
+			a := redactDoc(map[string]interface{}{k: chg.After}, fields)
+
+			n.Changes[k] = Change{
+				Before: b[k],
+				After:  a[k],
+			}
+		}
+	}
+
+	return &n
+}
+
+// redactObject returns a copy of the object with the values of the fields
+// redacted in its value and history. The hash of the unredacted value is
+// removed.
+func redactObject(o *Object, fields []string) *Object {
+	if o == nil || len(fields) == 0 {
+		return o
+	}
+
+	n := *o
+
+	n.Hash = ""
+
+	n.Value = redactDoc(o.Value, fields)
+
+	if o.History != nil {
+		n.History = make([]*Revision, len(o.History))
+
+		for i, r := range o.History {
+			n.History[i] = redactRevision(r, fields)
+		}
+	}
+
+	return &n
+}
+
+// redactedFields returns the fields redacted for the identity of the
+// request. Nothing is redacted for admins which includes all requests if
+// authentication is disabled.
+func redactedFields(c echo.Context) []string {
+	cfg := c.Get("config").(*Config)
+	id, _ := c.Get("identity").(*Identity)
+
+	return identityRedactedFields(cfg, id)
+}
+
+// identityRedactedFields returns the fields redacted for the identity which
+// is nil if the caller is not authenticated.
+func identityRedactedFields(cfg *Config, id *Identity) []string {
+	if len(cfg.Redact.Rules) == 0 || cfg.Auth.Allowed(id, PermAdmin, "") {
+		return nil
+	}
+
+	if id == nil {
+		return cfg.Redact.RoleFields(nil)
+	}
+
+	return cfg.Redact.RoleFields(id.Roles)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRedactFields(t *testing.T) {
+	c := RedactConfig{
+		Rules: []*RedactRule{
+			{Fields: []string{"ssn"}, Roles: []string{"*"}, Channels: []string{ChannelEmail, ChannelDigest}},
+			{Fields: []string{"patient.dob"}, Roles: []string{"research"}},
+		},
+	}
+
+	if f := c.RoleFields([]string{"billing"}); !reflect.DeepEqual(f, []string{"ssn"}) {
+		t.Errorf("expected ssn, got %v", f)
+	}
+
+	if f := c.RoleFields([]string{"research"}); !reflect.DeepEqual(f, []string{"ssn", "patient.dob"}) {
+		t.Errorf("expected ssn and patient.dob, got %v", f)
+	}
+
+	if f := c.ChannelFields(ChannelWebhook); f != nil {
+		t.Errorf("expected no fields, got %v", f)
+	}
+
+	if err := (&RedactRule{Channels: []string{"sms"}}).Validate(); err == nil {
+		t.Error("expected unknown channel error")
+	}
+}
+
+func TestRedactRevision(t *testing.T) {
+	r := &Revision{
+		Version: 2,
+		Hash:    "abc",
+		Additions: map[string]interface{}{
+			"ssn": "123-45-6789",
+		},
+		Changes: map[string]Change{
+			"name": {Before: "Bob", After: "Bob Smith"},
+			"patient": {
+				Before: map[string]interface{}{"dob": "2001-01-01", "mrn": 1.0},
+				After:  map[string]interface{}{"dob": "2001-01-02", "mrn": 1.0},
+			},
+		},
+	}
+
+	n := redactRevision(r, []string{"ssn", "patient.dob"})
+
+	if n.Additions["ssn"] != redactedValue {
+		t.Errorf("expected ssn to be redacted, got %v", n.Additions["ssn"])
+	}
+
+	if n.Changes["name"].After != "Bob Smith" {
+		t.Errorf("expected name to not be redacted, got %v", n.Changes["name"])
+	}
+
+	if n.Hash != "" {
+		t.Errorf("expected hash of the unredacted value to be removed, got %s", n.Hash)
+	}
+
+	p := n.Changes["patient"].After.(map[string]interface{})
+
+	if p["dob"] != redactedValue || p["mrn"] != 1.0 {
+		t.Errorf("expected only patient.dob to be redacted, got %v", p)
+	}
+
+	// Original is not modified.
+	if r.Additions["ssn"] != "123-45-6789" || r.Changes["patient"].After.(map[string]interface{})["dob"] != "2001-01-02" {
+		t.Error("expected revision to not be modified")
+	}
+}
+
+func TestRedactChangedObjectEmail(t *testing.T) {
+	c := *cfg
+
+	c.Redact = RedactConfig{
+		Rules: []*RedactRule{
+			{Fields: []string{"ssn"}, Channels: []string{ChannelEmail}},
+		},
+	}
+
+	r := &Revision{
+		Version: 2,
+		Changes: map[string]Change{
+			"ssn": {Before: "123-45-6789", After: "987-65-4321"},
+		},
+	}
+
+	e, err := changedObjectEmail(&c, &Subscriber{Token: "abc"}, &Object{Key: "bob"}, r)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(e.Text), "987-65-4321") || !strings.Contains(string(e.Text), "after: '***'") {
+		t.Errorf("expected ssn to be redacted in text:\n%s", e.Text)
+	}
+}
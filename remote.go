@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chop-dbhi/scds/client"
+)
+
+// The remote commands send the operations of commands to an SCDS HTTP
+// server instead of connecting to MongoDB. The server authorizes and audits
+// the operations.
+
+// printJSON writes the value as indented JSON to stdout.
+func printJSON(v interface{}) {
+	b, err := json.MarshalIndent(v, "", "  ")
+
+	if err != nil {
+		fatal(err)
+	}
+
+	fmt.Fprintf(os.Stdout, "%s\n", b)
+}
+
+func remotePut(rc *client.Client, key string, val map[string]interface{}) {
+	r, err := rc.Put(key, val)
+
+	if err != nil {
+		if e, ok := err.(*client.Error); ok && e.StatusCode == StatusUnprocessableEntity {
+			log.Printf("validation error\n%s", e.Details)
+			os.Exit(ExitValidation)
+		}
+
+		fatal(err)
+	}
+
+	if r == nil {
+		return
+	}
+
+	printJSON(r)
+}
+
+func remoteGet(rc *client.Client, key string, v int, t int64, ts string) {
+	var (
+		o   *client.Object
+		err error
+	)
+
+	switch {
+	case v > 0:
+		o, err = rc.GetVersion(key, v)
+
+		if err == nil && o == nil {
+			err = NotFoundError("Version %d of %s does not exist", v, key)
+		}
+
+	case t > 0:
+		o, err = rc.GetTime(key, time.Unix(t, 0))
+
+		if err == nil && o == nil {
+			err = NotFoundError("Object %s did not exist at %s", key, ts)
+		}
+
+	default:
+		o, err = rc.Get(key)
+
+		if err == nil && o == nil {
+			err = NotFoundError("Object %s does not exist", key)
+		}
+	}
+
+	if err != nil {
+		fatal(err)
+	}
+
+	printJSON(o)
+}
+
+func remoteKeys(rc *client.Client) {
+	keys, err := rc.Keys()
+
+	if err != nil {
+		fatal(err)
+	}
+
+	if len(keys) == 0 {
+		return
+	}
+
+	fmt.Fprintln(os.Stdout, strings.Join(keys, "\n"))
+}
+
+func remoteLog(rc *client.Client, key string) {
+	l, err := rc.Log(key)
+
+	if err == nil && l == nil {
+		err = NotFoundError("Object %s does not exist", key)
+	}
+
+	if err != nil {
+		fatal(err)
+	}
+
+	printJSON(l)
+}
+
+func remoteChanges(rc *client.Client, since string, limit int) {
+	chgs, err := rc.Changes(since, limit)
+
+	if err != nil {
+		fatal(err)
+	}
+
+	printJSON(chgs)
+}
+
+func remoteSubscribe(rc *client.Client, s Subscription, emails []string) {
+	n, err := rc.Subscribe(client.Subscription{
+		Patterns: s.Patterns,
+		Events:   s.Events,
+		Fields:   s.Fields,
+		Digest:   s.Digest,
+		Quiet:    s.Quiet,
+	}, emails...)
+
+	if err != nil {
+		fatal(err)
+	}
+
+	if n == 1 {
+		fmt.Fprintln(os.Stdout, "Subscribed 1 new email")
+	} else {
+		fmt.Fprintf(os.Stdout, "Subscribed %d new emails\n", n)
+	}
+}
+
+// remoteUnsubscribe removes the subscribers with the emails. The API removes
+// subscribers by id so the ids are looked up first.
+func remoteUnsubscribe(rc *client.Client, emails []string) {
+	subs, err := rc.Subscribers()
+
+	if err != nil {
+		fatal(err)
+	}
+
+	// Emails are stored in lowercase.
+	remove := make(map[string]bool, len(emails))
+
+	for _, email := range emails {
+		remove[strings.ToLower(email)] = true
+	}
+
+	var n int
+
+	for _, s := range subs {
+		if !remove[s.Email] {
+			continue
+		}
+
+		err = rc.Unsubscribe(s.ID)
+
+		// Removed since the subscribers were listed.
+		if client.IsNotFound(err) {
+			continue
+		}
+
+		if err != nil {
+			fatal(err)
+		}
+
+		n++
+	}
+
+	if n == 1 {
+		fmt.Fprintln(os.Stdout, "Unsubscribed 1 email")
+	} else {
+		fmt.Fprintf(os.Stdout, "Unsubscribed %d emails\n", n)
+	}
+}
+
+func remoteWebhookAdd(rc *client.Client, url, secret string) {
+	w, err := rc.AddWebhook(url, secret)
+
+	if err != nil {
+		fatal(err)
+	}
+
+	printJSON(w)
+}
+
+func remoteWebhookRemove(rc *client.Client, id string) {
+	ok, err := rc.RemoveWebhook(id)
+
+	if err != nil {
+		fatal(err)
+	}
+
+	if ok {
+		fmt.Fprintln(os.Stdout, "Removed 1 webhook")
+	} else {
+		fmt.Fprintln(os.Stdout, "Removed 0 webhooks")
+	}
+}
+
+func remoteWebhookList(rc *client.Client) {
+	hooks, err := rc.Webhooks()
+
+	if err != nil {
+		fatal(err)
+	}
+
+	for _, w := range hooks {
+		fmt.Fprintf(os.Stdout, "%s\t%s\n", w.ID, w.URL)
+	}
+}
+
+func remoteWebhookLog(rc *client.Client, id string, limit int) {
+	ds, err := rc.Deliveries(id, limit)
+
+	if err != nil {
+		fatal(err)
+	}
+
+	printJSON(ds)
+}
+
+func remoteAudit(rc *client.Client, q AuditQuery, since string) {
+	entries, err := rc.Audit(client.AuditQuery{
+		Identity:  q.Identity,
+		Operation: q.Operation,
+		Key:       q.Key,
+		Since:     since,
+		Limit:     q.Limit,
+	})
+
+	if err != nil {
+		fatal(err)
+	}
+
+	printJSON(entries)
+}
@@ -0,0 +1,327 @@
+// The scds.SCDS service has the same operations as the HTTP API. Values are
+// JSON documents so they are sent as google.protobuf.Struct.
+//
+// After changing this file, regenerate the Go code with `make proto`.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: scds.proto
+
+package scdspb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	SCDS_Put_FullMethodName      = "/scds.SCDS/Put"
+	SCDS_BatchPut_FullMethodName = "/scds.SCDS/BatchPut"
+	SCDS_Get_FullMethodName      = "/scds.SCDS/Get"
+	SCDS_Log_FullMethodName      = "/scds.SCDS/Log"
+	SCDS_Keys_FullMethodName     = "/scds.SCDS/Keys"
+	SCDS_Watch_FullMethodName    = "/scds.SCDS/Watch"
+)
+
+// SCDSClient is the client API for SCDS service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type SCDSClient interface {
+	// Puts the value of an object.
+	Put(ctx context.Context, in *PutRequest, opts ...grpc.CallOption) (*PutResponse, error)
+	// Puts the values of the objects streamed by the client. The batch stops
+	// at the first failed put; the puts before it are kept.
+	BatchPut(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[PutRequest, BatchPutResponse], error)
+	// Gets the state of an object, optionally at a version or time.
+	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*Object, error)
+	// Gets the revisions of an object.
+	Log(ctx context.Context, in *LogRequest, opts ...grpc.CallOption) (*LogResponse, error)
+	// Gets the keys of the objects the identity can read.
+	Keys(ctx context.Context, in *KeysRequest, opts ...grpc.CallOption) (*KeysResponse, error)
+	// Streams the revisions of the objects as they occur.
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error)
+}
+
+type sCDSClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSCDSClient(cc grpc.ClientConnInterface) SCDSClient {
+	return &sCDSClient{cc}
+}
+
+func (c *sCDSClient) Put(ctx context.Context, in *PutRequest, opts ...grpc.CallOption) (*PutResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PutResponse)
+	err := c.cc.Invoke(ctx, SCDS_Put_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sCDSClient) BatchPut(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[PutRequest, BatchPutResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &SCDS_ServiceDesc.Streams[0], SCDS_BatchPut_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[PutRequest, BatchPutResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SCDS_BatchPutClient = grpc.ClientStreamingClient[PutRequest, BatchPutResponse]
+
+func (c *sCDSClient) Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*Object, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Object)
+	err := c.cc.Invoke(ctx, SCDS_Get_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sCDSClient) Log(ctx context.Context, in *LogRequest, opts ...grpc.CallOption) (*LogResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LogResponse)
+	err := c.cc.Invoke(ctx, SCDS_Log_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sCDSClient) Keys(ctx context.Context, in *KeysRequest, opts ...grpc.CallOption) (*KeysResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(KeysResponse)
+	err := c.cc.Invoke(ctx, SCDS_Keys_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sCDSClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &SCDS_ServiceDesc.Streams[1], SCDS_Watch_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchRequest, Event]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SCDS_WatchClient = grpc.ServerStreamingClient[Event]
+
+// SCDSServer is the server API for SCDS service.
+// All implementations must embed UnimplementedSCDSServer
+// for forward compatibility.
+type SCDSServer interface {
+	// Puts the value of an object.
+	Put(context.Context, *PutRequest) (*PutResponse, error)
+	// Puts the values of the objects streamed by the client. The batch stops
+	// at the first failed put; the puts before it are kept.
+	BatchPut(grpc.ClientStreamingServer[PutRequest, BatchPutResponse]) error
+	// Gets the state of an object, optionally at a version or time.
+	Get(context.Context, *GetRequest) (*Object, error)
+	// Gets the revisions of an object.
+	Log(context.Context, *LogRequest) (*LogResponse, error)
+	// Gets the keys of the objects the identity can read.
+	Keys(context.Context, *KeysRequest) (*KeysResponse, error)
+	// Streams the revisions of the objects as they occur.
+	Watch(*WatchRequest, grpc.ServerStreamingServer[Event]) error
+	mustEmbedUnimplementedSCDSServer()
+}
+
+// UnimplementedSCDSServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedSCDSServer struct{}
+
+func (UnimplementedSCDSServer) Put(context.Context, *PutRequest) (*PutResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Put not implemented")
+}
+func (UnimplementedSCDSServer) BatchPut(grpc.ClientStreamingServer[PutRequest, BatchPutResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method BatchPut not implemented")
+}
+func (UnimplementedSCDSServer) Get(context.Context, *GetRequest) (*Object, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedSCDSServer) Log(context.Context, *LogRequest) (*LogResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Log not implemented")
+}
+func (UnimplementedSCDSServer) Keys(context.Context, *KeysRequest) (*KeysResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Keys not implemented")
+}
+func (UnimplementedSCDSServer) Watch(*WatchRequest, grpc.ServerStreamingServer[Event]) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedSCDSServer) mustEmbedUnimplementedSCDSServer() {}
+func (UnimplementedSCDSServer) testEmbeddedByValue()              {}
+
+// UnsafeSCDSServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SCDSServer will
+// result in compilation errors.
+type UnsafeSCDSServer interface {
+	mustEmbedUnimplementedSCDSServer()
+}
+
+func RegisterSCDSServer(s grpc.ServiceRegistrar, srv SCDSServer) {
+	// If the following call pancis, it indicates UnimplementedSCDSServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&SCDS_ServiceDesc, srv)
+}
+
+func _SCDS_Put_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PutRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SCDSServer).Put(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SCDS_Put_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SCDSServer).Put(ctx, req.(*PutRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SCDS_BatchPut_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(SCDSServer).BatchPut(&grpc.GenericServerStream[PutRequest, BatchPutResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SCDS_BatchPutServer = grpc.ClientStreamingServer[PutRequest, BatchPutResponse]
+
+func _SCDS_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SCDSServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SCDS_Get_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SCDSServer).Get(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SCDS_Log_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LogRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SCDSServer).Log(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SCDS_Log_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SCDSServer).Log(ctx, req.(*LogRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SCDS_Keys_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeysRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SCDSServer).Keys(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SCDS_Keys_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SCDSServer).Keys(ctx, req.(*KeysRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SCDS_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SCDSServer).Watch(m, &grpc.GenericServerStream[WatchRequest, Event]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SCDS_WatchServer = grpc.ServerStreamingServer[Event]
+
+// SCDS_ServiceDesc is the grpc.ServiceDesc for SCDS service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var SCDS_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "scds.SCDS",
+	HandlerType: (*SCDSServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Put",
+			Handler:    _SCDS_Put_Handler,
+		},
+		{
+			MethodName: "Get",
+			Handler:    _SCDS_Get_Handler,
+		},
+		{
+			MethodName: "Log",
+			Handler:    _SCDS_Log_Handler,
+		},
+		{
+			MethodName: "Keys",
+			Handler:    _SCDS_Keys_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "BatchPut",
+			Handler:       _SCDS_BatchPut_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Watch",
+			Handler:       _SCDS_Watch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "scds.proto",
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo"
+	"gopkg.in/labstack/echo.v2/engine/standard"
+)
+
+const (
+	// Interval of heartbeat messages sent on idle streams.
+	streamHeartbeat = 15 * time.Second
+
+	// Interval to check for changes made by other processes, such
+	// as the CLI, which do not publish to the broker.
+	streamPoll = 5 * time.Second
+)
+
+// Broker signals stream listeners when new revisions are written.
+type Broker struct {
+	mu   sync.Mutex
+	subs map[chan struct{}]struct{}
+}
+
+// Subscribe returns a channel that receives a value when revisions
+// are published.
+func (b *Broker) Subscribe() chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.subs == nil {
+		b.subs = make(map[chan struct{}]struct{})
+	}
+
+	ch := make(chan struct{}, 1)
+	b.subs[ch] = struct{}{}
+
+	return ch
+}
+
+// Unsubscribe removes the channel from the broker.
+func (b *Broker) Unsubscribe(ch chan struct{}) {
+	b.mu.Lock()
+	delete(b.subs, ch)
+	b.mu.Unlock()
+}
+
+// Publish wakes all subscribers. Subscribers that have not consumed
+// the previous signal are skipped since they will read all pending
+// changes when they do.
+func (b *Broker) Publish() {
+	// Not running a server.
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// parseKeyPatterns splits a comma-separated list of key patterns and
+// validates each one.
+func parseKeyPatterns(s string) ([]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var pats []string
+
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+
+		if p == "" {
+			continue
+		}
+
+		if err := checkKeyPattern(p); err != nil {
+			return nil, err
+		}
+
+		pats = append(pats, p)
+	}
+
+	return pats, nil
+}
+
+// writeStreamEvent writes a server-sent event.
+func writeStreamEvent(w io.Writer, id, event string, data interface{}) error {
+	b, err := json.Marshal(data)
+
+	if err != nil {
+		return err
+	}
+
+	if id != "" {
+		if _, err = fmt.Fprintf(w, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+
+	return err
+}
+
+func streamHandler(c echo.Context) error {
+	cfg := c.Get("config").(*Config)
+
+	// Resume from the last event the client received when reconnecting.
+	since := c.Request().Header().Get("Last-Event-ID")
+
+	if since == "" {
+		since = c.QueryParam("since")
+	}
+
+	var (
+		err    error
+		cursor Cursor
+	)
+
+	if since != "" {
+		cursor, err = ParseSince(since)
+	} else {
+		// Only stream new changes.
+		cursor = Cursor{Time: time.Now().UTC().Unix()}
+	}
+
+	if err != nil {
+		return ParamError("since", err)
+	}
+
+	pats, err := parseKeyPatterns(c.QueryParam("keys"))
+
+	if err != nil {
+		return ParamError("keys", err)
+	}
+
+	// Fields redacted for the identity.
+	fields := redactedFields(c)
+
+	req := c.Request().(*standard.Request).Request
+	res := c.Response()
+
+	flusher, ok := res.(*standard.Response).ResponseWriter.(http.Flusher)
+
+	if !ok {
+		return c.NoContent(http.StatusNotImplemented)
+	}
+
+	res.Header().Set("Content-Type", "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("Connection", "keep-alive")
+	res.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	wake := cfg.broker.Subscribe()
+	defer cfg.broker.Unsubscribe(wake)
+
+	poll := time.NewTicker(streamPoll)
+	defer poll.Stop()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	var events []*Event
+
+	for {
+		// Read until caught up.
+		for {
+			events, cursor, err = ChangesSince(cfg, cursor, defaultChangesLimit)
+
+			if err != nil {
+				return err
+			}
+
+			for _, e := range events {
+				if len(pats) > 0 && !matchKeyPatterns(pats, e.Key) {
+					continue
+				}
+
+				if !allowed(c, PermRead, e.Key) {
+					continue
+				}
+
+				e.Revision.URL = cfg.HTTP.VersionURL(e.Key, e.Revision.Version)
+				e.Revision = redactRevision(e.Revision, fields)
+
+				if err = writeStreamEvent(res, e.Cursor().String(), "revision", e); err != nil {
+					return nil
+				}
+
+				auditRead(c, OpStream, e.Key, e.Revision.Version, nil)
+			}
+
+			if len(events) < defaultChangesLimit {
+				break
+			}
+		}
+
+		flusher.Flush()
+
+		select {
+		case <-req.Context().Done():
+			return nil
+
+		case <-wake:
+		case <-poll.C:
+
+		case t := <-heartbeat.C:
+			err = writeStreamEvent(res, cursor.String(), "heartbeat", map[string]interface{}{
+				"time":   t.UTC().Unix(),
+				"cursor": cursor.String(),
+			})
+
+			if err != nil {
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import "testing"
+
+func TestBroker(t *testing.T) {
+	var b Broker
+
+	ch := b.Subscribe()
+
+	// Multiple publishes coalesce into a single signal.
+	b.Publish()
+	b.Publish()
+
+	select {
+	case <-ch:
+	default:
+		t.Fatal("expected signal")
+	}
+
+	select {
+	case <-ch:
+		t.Error("expected a single signal")
+	default:
+	}
+
+	b.Unsubscribe(ch)
+	b.Publish()
+
+	select {
+	case <-ch:
+		t.Error("unsubscribed channel should not be signaled")
+	default:
+	}
+
+	// Nil brokers are a no-op.
+	var n *Broker
+	n.Publish()
+}
+
+func TestParseKeyPatterns(t *testing.T) {
+	pats, err := parseKeyPatterns("billing.*, study.1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pats) != 2 {
+		t.Fatalf("expected 2 patterns, got %d", len(pats))
+	}
+
+	if !matchKeyPatterns(pats, "billing.2016.1") {
+		t.Error("expected billing.2016.1 to match")
+	}
+
+	if !matchKeyPatterns(pats, "study.1") {
+		t.Error("expected study.1 to match")
+	}
+
+	if matchKeyPatterns(pats, "study.2") {
+		t.Error("expected study.2 to not match")
+	}
+
+	if _, err = parseKeyPatterns("billing.["); err == nil {
+		t.Error("expected error for malformed pattern")
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	htemplate "html/template"
+	"io/ioutil"
+	ttemplate "text/template"
+
+	"github.com/jordan-wright/email"
+	"gopkg.in/yaml.v2"
+)
+
+// Names of the notification email templates.
+const (
+	templateNew     = "new"
+	templateChanged = "changed"
+	templateDigest  = "digest"
+	templateConfirm = "confirm"
+)
+
+// Functions available to email templates.
+var templateFuncs = map[string]interface{}{
+	"yaml":       toYAML,
+	"abbreviate": abbreviate,
+}
+
+// toYAML returns the YAML encoding of the value.
+func toYAML(v interface{}) string {
+	b, _ := yaml.Marshal(v)
+	return string(b)
+}
+
+// EmailTemplate is the compiled set of templates an email is rendered from.
+type EmailTemplate struct {
+	Subject *ttemplate.Template
+	Text    *ttemplate.Template
+	HTML    *htemplate.Template
+}
+
+// Execute renders the templates with the context into a new email.
+func (t *EmailTemplate) Execute(cxt interface{}) (*email.Email, error) {
+	var buff bytes.Buffer
+
+	e := email.NewEmail()
+
+	if err := t.Subject.Execute(&buff, cxt); err != nil {
+		return nil, err
+	}
+
+	e.Subject = buff.String()
+
+	buff = bytes.Buffer{}
+
+	if err := t.Text.Execute(&buff, cxt); err != nil {
+		return nil, err
+	}
+
+	e.Text = buff.Bytes()
+
+	if t.HTML != nil {
+		buff = bytes.Buffer{}
+
+		if err := t.HTML.Execute(&buff, cxt); err != nil {
+			return nil, err
+		}
+
+		e.HTML = buff.Bytes()
+	}
+
+	return e, nil
+}
+
+func parseText(name, text string) (*ttemplate.Template, error) {
+	return ttemplate.New(name).Funcs(ttemplate.FuncMap(templateFuncs)).Parse(text)
+}
+
+func parseHTML(name, text string) (*htemplate.Template, error) {
+	return htemplate.New(name).Funcs(htemplate.FuncMap(templateFuncs)).Parse(text)
+}
+
+func mustEmailTemplate(subject, text, html string) *EmailTemplate {
+	return &EmailTemplate{
+		Subject: ttemplate.Must(parseText("subject", subject)),
+		Text:    ttemplate.Must(parseText("text", string(MustAsset(text)))),
+		HTML:    htemplate.Must(parseHTML("html", string(MustAsset(html)))),
+	}
+}
+
+// Default email templates compiled from the embedded assets.
+var defaultTemplates map[string]*EmailTemplate
+
+func init() {
+	defaultTemplates = map[string]*EmailTemplate{
+		// Sent when a new object is created.
+		templateNew: mustEmailTemplate(
+			"[SCDS] New Object",
+			"email/new_object_email_body.txt",
+			"email/new_object_email_body.html",
+		),
+
+		// Sent when an object has changed.
+		templateChanged: mustEmailTemplate(
+			"[SCDS] Object Changed",
+			"email/changed_object_email_body.txt",
+			"email/changed_object_email_body.html",
+		),
+
+		// Summarizes multiple changes.
+		templateDigest: mustEmailTemplate(
+			"[SCDS] Digest of {{len .Items}} Changes",
+			"email/digest_email_body.txt",
+			"email/digest_email_body.html",
+		),
+
+		// Asks a new subscriber to confirm their subscription.
+		templateConfirm: mustEmailTemplate(
+			"[SCDS] Confirm Subscription",
+			"email/confirm_email_body.txt",
+			"email/confirm_email_body.html",
+		),
+	}
+}
+
+// EmailTemplateConfig defines overrides of an email template. The subject is
+// a template string and the text and HTML bodies are paths to template files.
+type EmailTemplateConfig struct {
+	Subject string
+	Text    string
+	HTML    string
+
+	template *EmailTemplate
+}
+
+// Load compiles the overrides on top of the default template.
+func (c *EmailTemplateConfig) Load(name string) error {
+	t := *defaultTemplates[name]
+
+	var (
+		err error
+		b   []byte
+	)
+
+	if c.Subject != "" {
+		if t.Subject, err = parseText("subject", c.Subject); err != nil {
+			return err
+		}
+	}
+
+	if c.Text != "" {
+		if b, err = ioutil.ReadFile(c.Text); err != nil {
+			return err
+		}
+
+		if t.Text, err = parseText("text", string(b)); err != nil {
+			return err
+		}
+	}
+
+	if c.HTML != "" {
+		if b, err = ioutil.ReadFile(c.HTML); err != nil {
+			return err
+		}
+
+		if t.HTML, err = parseHTML("html", string(b)); err != nil {
+			return err
+		}
+	}
+
+	c.template = &t
+
+	return nil
+}
+
+// EmailConfig defines configuration fields for notification emails.
+type EmailConfig struct {
+	Templates map[string]*EmailTemplateConfig
+}
+
+// Template returns the email template of the name.
+func (c *EmailConfig) Template(name string) *EmailTemplate {
+	if tc, ok := c.Templates[name]; ok && tc.template != nil {
+		return tc.template
+	}
+
+	return defaultTemplates[name]
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestChangedObjectEmail(t *testing.T) {
+	r := &Revision{
+		Version: 2,
+		Changes: map[string]Change{
+			"name": {Before: "Bob", After: "<Bob Smith>"},
+		},
+	}
+
+	e, err := changedObjectEmail(cfg, &Subscriber{Token: "abc"}, &Object{Key: "bob"}, r)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.Subject != "[SCDS] Object Changed" {
+		t.Errorf("unexpected subject %s", e.Subject)
+	}
+
+	if !strings.Contains(string(e.Text), "after: <Bob Smith>") {
+		t.Errorf("expected change in text:\n%s", e.Text)
+	}
+
+	if !strings.Contains(string(e.Text), "/unsubscribe/abc") {
+		t.Errorf("expected unsubscribe url in text:\n%s", e.Text)
+	}
+
+	// Values are escaped in the diff table.
+	if !strings.Contains(string(e.HTML), "&lt;Bob Smith&gt;") {
+		t.Errorf("expected escaped change in html:\n%s", e.HTML)
+	}
+}
+
+func TestEmailTemplateConfig(t *testing.T) {
+	f, err := ioutil.TempFile("", "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(f.Name())
+
+	f.WriteString("{{.Key}} is now version {{.Revision.Version}}")
+	f.Close()
+
+	tc := EmailTemplateConfig{
+		Subject: "[{{.Event}}] {{.Key}}",
+		Text:    f.Name(),
+	}
+
+	if err = tc.Load(templateChanged); err != nil {
+		t.Fatal(err)
+	}
+
+	c := Config{
+		Email: EmailConfig{
+			Templates: map[string]*EmailTemplateConfig{
+				templateChanged: &tc,
+			},
+		},
+	}
+
+	e, err := changedObjectEmail(&c, &Subscriber{}, &Object{Key: "bob"}, &Revision{Version: 3})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.Subject != "[changed] bob" {
+		t.Errorf("unexpected subject %s", e.Subject)
+	}
+
+	if string(e.Text) != "bob is now version 3" {
+		t.Errorf("unexpected text %s", e.Text)
+	}
+
+	// Default HTML template is used.
+	if len(e.HTML) == 0 {
+		t.Error("expected html body")
+	}
+}
+
+func TestConfirmEmail(t *testing.T) {
+	e, err := confirmEmail(cfg, &Subscriber{Email: "test@example.com", Token: "abc"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(e.Text), cfg.HTTP.ConfirmURL("abc")) {
+		t.Errorf("expected confirm url in text:\n%s", e.Text)
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// Header containing the HMAC-SHA256 signature of the request body.
+	webhookSignatureHeader = "X-SCDS-Signature"
+
+	// Header containing the event type of the request.
+	webhookEventHeader = "X-SCDS-Event"
+)
+
+// Webhook is an endpoint that receives a POST request when objects
+// are created or changed.
+type Webhook struct {
+	ID     bson.ObjectId `bson:"_id,omitempty" json:"_id,omitempty"`
+	URL    string        `json:"url"`
+	Secret string        `bson:",omitempty" json:"secret,omitempty"`
+	Time   time.Time     `json:"time"`
+}
+
+// WebhookPayload is the JSON body sent to webhooks.
+type WebhookPayload struct {
+	Event    string    `json:"event"`
+	Key      string    `json:"key"`
+	Revision *Revision `json:"revision"`
+	URL      string    `json:"url"`
+}
+
+// Delivery is an entry in the delivery log recording a single attempt to
+// send a payload to a webhook.
+type Delivery struct {
+	ID      bson.ObjectId `bson:"_id,omitempty" json:"_id,omitempty"`
+	Webhook bson.ObjectId `json:"webhook"`
+	Event   string        `json:"event"`
+	Key     string        `json:"key"`
+	Version int           `json:"version"`
+	Attempt int           `json:"attempt"`
+	Status  int           `json:"status,omitempty"`
+	Error   string        `bson:",omitempty" json:"error,omitempty"`
+	Time    time.Time     `json:"time"`
+}
+
+// sign returns the hex-encoded HMAC-SHA256 signature of the body.
+func sign(secret string, body []byte) string {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write(body)
+	return "sha256=" + hex.EncodeToString(m.Sum(nil))
+}
+
+// newSecret returns a random secret for signing webhook payloads.
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// AddWebhook registers a webhook. If secret is empty, one is generated. The
+// returned webhook includes the secret so it can be shared with the receiver.
+func AddWebhook(cfg *Config, u, secret string) (*Webhook, error) {
+	p, err := url.Parse(u)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Scheme != "http" && p.Scheme != "https" {
+		return nil, fmt.Errorf("Webhook URL must be http or https: %s", u)
+	}
+
+	if secret == "" {
+		if secret, err = newSecret(); err != nil {
+			return nil, err
+		}
+	}
+
+	w := Webhook{
+		ID:     bson.NewObjectId(),
+		URL:    u,
+		Secret: secret,
+		Time:   time.Now().UTC(),
+	}
+
+	if err = cfg.Mongo.Webhooks().Insert(&w); err != nil {
+		return nil, err
+	}
+
+	return &w, nil
+}
+
+// AllWebhooks returns all registered webhooks without their secrets.
+func AllWebhooks(cfg *Config) ([]*Webhook, error) {
+	p := bson.M{
+		"secret": 0,
+	}
+
+	var hooks []*Webhook
+
+	if err := cfg.Mongo.Webhooks().Find(nil).Select(p).All(&hooks); err != nil {
+		return nil, err
+	}
+
+	return hooks, nil
+}
+
+// RemoveWebhook removes a webhook and its delivery log.
+func RemoveWebhook(cfg *Config, id bson.ObjectId) (bool, error) {
+	err := cfg.Mongo.Webhooks().RemoveId(id)
+
+	// No webhook with the id.
+	if err == mgo.ErrNotFound {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	if _, err = cfg.Mongo.Deliveries().RemoveAll(bson.M{"webhook": id}); err != nil {
+		return true, err
+	}
+
+	return true, nil
+}
+
+// Deliveries returns the most recent delivery attempts for a webhook.
+func Deliveries(cfg *Config, id bson.ObjectId, limit int) ([]*Delivery, error) {
+	q := bson.M{
+		"webhook": id,
+	}
+
+	var ds []*Delivery
+
+	if err := cfg.Mongo.Deliveries().Find(q).Sort("-time").Limit(limit).All(&ds); err != nil {
+		return nil, err
+	}
+
+	return ds, nil
+}
+
+// postWebhook makes a single delivery attempt and returns the response status.
+func postWebhook(cfg *Config, w *Webhook, event string, body []byte) (int, error) {
+	req, err := http.NewRequest("POST", w.URL, bytes.NewReader(body))
+
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookEventHeader, event)
+	req.Header.Set(webhookSignatureHeader, sign(w.Secret, body))
+
+	client := http.Client{
+		Timeout: cfg.Webhooks.Timeout,
+	}
+
+	resp, err := client.Do(req)
+
+	if err != nil {
+		return 0, err
+	}
+
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// retryable returns true if the delivery should be attempted again.
+func retryable(status int) bool {
+	// Network errors and server errors.
+	if status == 0 || status >= 500 {
+		return true
+	}
+
+	return status == http.StatusTooManyRequests
+}
+
+// sendWebhook posts the revision to the webhook and records the attempt
+// in the delivery log. Returns the response status.
+func sendWebhook(cfg *Config, w *Webhook, key string, r *Revision, attempt int) (int, error) {
+	p := WebhookPayload{
+		Event:    eventType(r),
+		Key:      key,
+		Revision: redactRevision(r, cfg.Redact.ChannelFields(ChannelWebhook)),
+		URL:      cfg.HTTP.ObjectURL(key),
+	}
+
+	body, err := json.Marshal(&p)
+
+	if err != nil {
+		return 0, err
+	}
+
+	status, err := postWebhook(cfg, w, p.Event, body)
+
+	d := Delivery{
+		Webhook: w.ID,
+		Event:   p.Event,
+		Key:     key,
+		Version: r.Version,
+		Attempt: attempt,
+		Status:  status,
+		Time:    time.Now().UTC(),
+	}
+
+	if err != nil {
+		d.Error = err.Error()
+	}
+
+	if lerr := cfg.Mongo.Deliveries().Insert(&d); lerr != nil {
+		log.Printf("[webhook] error logging delivery: %s", lerr)
+	}
+
+	return status, err
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPostWebhook(t *testing.T) {
+	body := []byte(`{"event":"new","key":"bob"}`)
+
+	var sig, event string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sig = r.Header.Get(webhookSignatureHeader)
+		event = r.Header.Get(webhookEventHeader)
+
+		b, _ := ioutil.ReadAll(r.Body)
+
+		if string(b) != string(body) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	defer ts.Close()
+
+	c := &Config{
+		Webhooks: WebhooksConfig{
+			Timeout: time.Second,
+		},
+	}
+
+	w := &Webhook{
+		URL:    ts.URL,
+		Secret: "secret",
+	}
+
+	status, err := postWebhook(c, w, "new", body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", status)
+	}
+
+	if event != "new" {
+		t.Errorf("expected event new, got %s", event)
+	}
+
+	if sig != sign("secret", body) {
+		t.Errorf("signature mismatch: %s", sig)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := map[int]bool{
+		0:   true,
+		400: false,
+		404: false,
+		429: true,
+		500: true,
+		503: true,
+	}
+
+	for status, exp := range tests {
+		if retryable(status) != exp {
+			t.Errorf("status %d: expected %v", status, exp)
+		}
+	}
+}